@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// fileCommands 文件管理子命令
+var fileCommands = map[string]bool{"rm": true, "mv": true, "cp": true, "mkdir": true}
+
+// splitRemote 拆分 "server:port/path" 为服务器地址和路径
+func splitRemote(remote string) (serverAddr, filePath string, err error) {
+	parts := strings.SplitN(remote, "/", 2)
+	if len(parts) != 2 || !strings.Contains(parts[0], ":") || strings.Trim(parts[1], "/") == "" {
+		return "", "", fmt.Errorf("invalid remote path %q, use server:port/path", remote)
+	}
+	return parseServerAddr(parts[0]), parts[1], nil
+}
+
+// remoteDestination 目标可以写成 server:port/path 或直接写服务器上的路径；
+// 以 / 结尾表示放入该目录，保留源文件名
+func remoteDestination(dst, src string) string {
+	if parts := strings.SplitN(dst, "/", 2); len(parts) == 2 && strings.Contains(parts[0], ":") {
+		dst = parts[1]
+	}
+	if dst == "" || strings.HasSuffix(dst, "/") {
+		dst += path.Base(strings.TrimSuffix(src, "/"))
+	}
+	return dst
+}
+
+// postFileOp 调用服务器的文件管理接口
+func postFileOp(serverAddr, endpoint string, body interface{}, client *http.Client) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(serverAddr+endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(respBody)), "\n")
+		if resp.StatusCode == http.StatusMethodNotAllowed {
+			return fmt.Errorf("server does not support file management, please upgrade it")
+		}
+		return fmt.Errorf("%s - %s", resp.Status, message)
+	}
+	return nil
+}
+
+// runFileCommand 处理 rm、mv、cp、mkdir 子命令
+func runFileCommand(command string, args []string, client *http.Client) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	var recursive, parents, force *bool
+	switch command {
+	case "rm":
+		recursive = fs.Bool("r", false, "Delete directories and their contents")
+	case "mkdir":
+		parents = fs.Bool("p", false, "Create parent directories as needed, no error if existing")
+	case "mv", "cp":
+		force = fs.Bool("f", false, "Overwrite an existing destination file")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		switch command {
+		case "rm":
+			fmt.Fprintf(os.Stderr, "  %s rm [-r] <server:port>/<path>...\n", os.Args[0])
+		case "mkdir":
+			fmt.Fprintf(os.Stderr, "  %s mkdir [-p] <server:port>/<path>...\n", os.Args[0])
+		default:
+			fmt.Fprintf(os.Stderr, "  %s %s [-f] <server:port>/<source> <destination>\n", os.Args[0], command)
+			fmt.Fprintf(os.Stderr, "  destination is a path on the same server; a trailing / keeps the source name\n")
+		}
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	args = fs.Args()
+
+	switch command {
+	case "rm", "mkdir":
+		if len(args) == 0 {
+			fs.Usage()
+			os.Exit(1)
+		}
+		failed := false
+		for _, remote := range args {
+			serverAddr, filePath, err := splitRemote(remote)
+			if err == nil {
+				if command == "rm" {
+					err = postFileOp(serverAddr, "/api/delete", map[string]interface{}{"path": filePath, "recursive": *recursive}, client)
+				} else {
+					err = postFileOp(serverAddr, "/api/mkdir", map[string]interface{}{"path": filePath, "parents": *parents}, client)
+				}
+			}
+			if err != nil {
+				slog.Error(command+" failed", "path", remote, "error", err)
+				failed = true
+				continue
+			}
+			if command == "rm" {
+				slog.Info("Deleted", "path", filePath)
+			} else {
+				slog.Info("Created directory", "path", filePath)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+
+	case "mv", "cp":
+		if len(args) != 2 {
+			fs.Usage()
+			os.Exit(1)
+		}
+		serverAddr, src, err := splitRemote(args[0])
+		if err != nil {
+			fatal("Invalid source", "error", err)
+		}
+		dst := remoteDestination(args[1], src)
+		endpoint, verb := "/api/move", "Moved"
+		if command == "cp" {
+			endpoint, verb = "/api/copy", "Copied"
+		}
+		if err := postFileOp(serverAddr, endpoint, map[string]interface{}{"from": src, "to": dst, "overwrite": *force}, client); err != nil {
+			fatal(command+" failed", "error", err)
+		}
+		slog.Info(verb, "from", src, "to", dst)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// runFindCommand 处理 find 子命令：ctrans find [options] server:port[/path] [text]
+func runFindCommand(args []string, client *http.Client) {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	name := fs.String("name", "", "Match file names against a glob pattern, e.g. '*.tar.gz'")
+	kind := fs.String("type", "", "Only list files (f) or directories (d)")
+	minSize := fs.String("min-size", "", "Minimum file size, e.g. 10M")
+	maxSize := fs.String("max-size", "", "Maximum file size, e.g. 1G")
+	newer := fs.String("newer", "", "Modified after a time: RFC 3339, YYYY-MM-DD or a duration ago such as 24h")
+	older := fs.String("older", "", "Modified before a time: RFC 3339, YYYY-MM-DD or a duration ago such as 720h")
+	checksum := fs.String("sha256", "", "Find files with this SHA-256 checksum")
+	uploadedBy := fs.String("uploaded-by", "", "Only files uploaded by this identity")
+	var tags stringList
+	fs.Var(&tags, "tag", "Only files with this tag: key=value or key (repeatable)")
+	limit := fs.Int("limit", 1000, "Maximum number of results")
+	long := fs.Bool("l", false, "Long format: type, size, modification time and path")
+	asJSON := fs.Bool("json", false, "Print results as JSON for scripts")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s find [options] <server:port>[/<path>] [text]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\ntext matches anywhere in the file name, case-insensitive.\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) < 1 || len(args) > 2 || !strings.Contains(strings.SplitN(args[0], "/", 2)[0], ":") {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	server, dir, _ := strings.Cut(args[0], "/")
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if dir = strings.Trim(path.Clean("/"+dir), "/"); dir != "" {
+		query.Set("path", dir)
+	}
+	if len(args) == 2 {
+		query.Set("q", args[1])
+	}
+	if len(tags) > 0 {
+		query["tag"] = tags
+	}
+	switch *kind {
+	case "":
+	case "f", "file":
+		query.Set("type", "file")
+	case "d", "dir":
+		query.Set("type", "dir")
+	default:
+		fatal("Invalid -type, use f or d")
+	}
+	for key, value := range map[string]string{
+		"glob":            *name,
+		"min_size":        *minSize,
+		"max_size":        *maxSize,
+		"modified_after":  *newer,
+		"modified_before": *older,
+		"sha256":          *checksum,
+		"uploaded_by":     *uploadedBy,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	resp, err := client.Get(parseServerAddr(server) + "/search?" + query.Encode())
+	if err != nil {
+		fatal("Search failed", "error", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		fatal("Search failed", "status", resp.Status, "error", message)
+	}
+	// 旧版本服务器没有 /search，请求落到网页界面
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		fatal("Server does not support search, please upgrade it")
+	}
+
+	var result struct {
+		Entries   []FileInfo `json:"entries"`
+		Truncated bool       `json:"truncated"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fatal("Invalid server response", "error", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result.Entries)
+	} else if *long {
+		// 长格式显示完整路径而不是名称
+		for i := range result.Entries {
+			result.Entries[i].Name = result.Entries[i].Path
+		}
+		printLong(result.Entries, &lsOptions{human: true}, 0, func(int) string { return "" })
+	} else {
+		for _, e := range result.Entries {
+			if e.IsDir {
+				fmt.Println(color.BlueString(e.Path + "/"))
+			} else {
+				fmt.Println(e.Path)
+			}
+		}
+	}
+	if result.Truncated {
+		slog.Warn("Results truncated, use -limit or narrow the search to see more", "shown", len(result.Entries))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// version 由构建脚本通过 -ldflags "-X main.version=..." 注入
+var version = "dev"
+
+// protocolVersion 客户端支持的协议版本
+const protocolVersion = 1
+
+// ServerInfo /api/info 的响应
+type ServerInfo struct {
+	Version         string   `json:"version"`
+	ProtocolVersion int      `json:"protocol_version"`
+	ChunkSize       int64    `json:"chunk_size"`
+	MaxChunkSize    int64    `json:"max_chunk_size"`
+	MinFreeSpace    int64    `json:"min_free_space"`
+	FreeSpace       int64    `json:"free_space"`
+	Features        []string `json:"features"`
+	ReadOnly        bool     `json:"read_only"`
+	Message         string   `json:"message"`
+	Identity        string   `json:"identity"`
+	Role            string   `json:"role"`
+}
+
+// getServerInfo 获取服务器信息；旧版本服务器没有该接口时返回 nil, nil
+func getServerInfo(serverAddr string, client *http.Client) (*ServerInfo, error) {
+	resp, err := client.Get(serverAddr + "/api/info")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		return nil, fmt.Errorf("%s - %s", resp.Status, message)
+	}
+
+	var info ServerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// checkServer 传输前确认服务器可用、协议兼容；上传时还检查分片大小和剩余空间
+func checkServer(serverAddr string, client *http.Client, upload bool, uploadSize int64) {
+	info, err := getServerInfo(serverAddr, client)
+	if err != nil {
+		fatal("Server check failed", "server", serverAddr, "error", err)
+	}
+	if info == nil {
+		slog.Debug("Server does not provide /api/info, skipping compatibility check", "server", serverAddr)
+		return
+	}
+
+	if info.ProtocolVersion != protocolVersion {
+		fatal("Incompatible server protocol, please upgrade",
+			"server_protocol", info.ProtocolVersion, "client_protocol", protocolVersion, "server_version", info.Version)
+	}
+	if upload {
+		if info.ReadOnly {
+			fatal("Server is in read-only maintenance mode, try again later", "message", info.Message)
+		}
+		if info.ChunkSize != chunkSize {
+			fatal("Server uses a different chunk size", "server_chunk_size", info.ChunkSize, "client_chunk_size", chunkSize)
+		}
+		if info.FreeSpace >= 0 && uploadSize+info.MinFreeSpace > info.FreeSpace {
+			fatal("Not enough free space on server",
+				"required", formatSize(uploadSize+info.MinFreeSpace), "available", formatSize(info.FreeSpace))
+		}
+	}
+}
+
+// showInfo 处理 "ctrans info server:port"
+func showInfo(serverAddr string, client *http.Client) {
+	start := time.Now()
+	info, err := getServerInfo(serverAddr, client)
+	if err != nil {
+		fatal("Failed to get server info", "server", serverAddr, "error", err)
+	}
+	if info == nil {
+		fatal("Server does not support /api/info (version too old)", "server", serverAddr)
+	}
+	latency := time.Since(start)
+
+	compatible := color.GreenString("compatible")
+	if info.ProtocolVersion != protocolVersion {
+		compatible = color.RedString("incompatible (client supports %d)", protocolVersion)
+	}
+	freeSpace := "unknown"
+	if info.FreeSpace >= 0 {
+		freeSpace = formatSize(info.FreeSpace)
+	}
+
+	fmt.Printf("Server:          %s\n", color.CyanString(serverAddr))
+	fmt.Printf("Server version:  %s\n", info.Version)
+	fmt.Printf("Client version:  %s\n", version)
+	fmt.Printf("Protocol:        %d, %s\n", info.ProtocolVersion, compatible)
+	fmt.Printf("Chunk size:      %s (max %s)\n", formatSize(info.ChunkSize), formatSize(info.MaxChunkSize))
+	fmt.Printf("Free space:      %s (keeps %s in reserve)\n", freeSpace, formatSize(info.MinFreeSpace))
+	fmt.Printf("Features:        %s\n", strings.Join(info.Features, ", "))
+	if info.ReadOnly {
+		mode := "read-only maintenance"
+		if info.Message != "" {
+			mode += ": " + info.Message
+		}
+		fmt.Printf("Mode:            %s\n", color.YellowString(mode))
+	}
+	fmt.Printf("Identity:        %s (%s)\n", info.Identity, info.Role)
+	fmt.Printf("Latency:         %s\n", latency.Round(time.Millisecond))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// initLogging 设置默认的 slog 日志器，日志输出到标准错误，format 为 text 或 json
+func initLogging(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q (expected text or json)", format)
+	}
+	return nil
+}
+
+// fatal 记录错误并退出
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// responseError 返回描述失败响应的日志属性：状态、服务器的错误信息和请求 ID
+func responseError(resp *http.Response, body []byte) []any {
+	message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+	return []any{
+		"status", resp.Status,
+		"error", message,
+		"request_id", resp.Header.Get(requestIDHeader),
+	}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
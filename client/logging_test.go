@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captureStderr 在 fn 执行期间把标准错误重定向到临时文件，返回写入的内容；结束后恢复默认日志器
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stderr, logger := os.Stderr, slog.Default()
+	os.Stderr = file
+	defer func() {
+		os.Stderr = stderr
+		slog.SetDefault(logger)
+	}()
+	fn()
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInitLogging(t *testing.T) {
+	out := captureStderr(t, func() {
+		if err := initLogging("json", "warn"); err != nil {
+			t.Fatal(err)
+		}
+		slog.Info("hidden")
+		slog.Warn("shown", "file", "app.tar")
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("json output = %q, want one warn line", out)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("json output %q: %v", lines[0], err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "shown" || entry["file"] != "app.tar" {
+		t.Errorf("json entry = %v", entry)
+	}
+
+	out = captureStderr(t, func() {
+		if err := initLogging("text", "debug"); err != nil {
+			t.Fatal(err)
+		}
+		slog.Debug("HTTP request", "method", "GET")
+	})
+	if !strings.Contains(out, `level=DEBUG msg="HTTP request" method=GET`) {
+		t.Errorf("text output = %q", out)
+	}
+
+	captureStderr(t, func() {
+		if err := initLogging("xml", "info"); err == nil {
+			t.Error("invalid format accepted")
+		}
+		if err := initLogging("text", "loud"); err == nil {
+			t.Error("invalid level accepted")
+		}
+	})
+}
+
+func TestResponseError(t *testing.T) {
+	resp := &http.Response{Status: "404 Not Found", Header: http.Header{}}
+	resp.Header.Set(requestIDHeader, "abc123")
+	got := responseError(resp, []byte("File not found\nrequest_id: abc123\n"))
+	want := []any{"status", "404 Not Found", "error", "File not found", "request_id", "abc123"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("responseError = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// lsOptions ls 子命令的选项
+type lsOptions struct {
+	long      bool
+	recursive bool
+	human     bool
+	sortBy    string // name、size、modified
+	desc      bool   // 与 ls 一致：按名称升序，按大小和时间时大的、新的在前，-r 反转
+	json      bool
+	tags      stringList // 只列出带这些标签的文件：key=value 或 key
+}
+
+// defaultListOptions 不带子命令的 ctrans server:port[/path] 使用的选项：
+// 和旧版本一样递归列出所有文件，相当于 ls -l -R -h
+func defaultListOptions() *lsOptions {
+	return &lsOptions{long: true, recursive: true, human: true, sortBy: "name"}
+}
+
+// listPage /files 分页接口的响应
+type listPage struct {
+	Entries    []FileInfo `json:"entries"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+// fetchDirectory 获取目录的全部直接子项（自动翻页）。
+// 旧版本服务器忽略查询参数并返回整个上传目录，此时在本地筛选出该目录的子项并排序。
+func fetchDirectory(serverAddr, dir string, opts *lsOptions, client *http.Client) ([]FileInfo, error) {
+	query := url.Values{"path": {dir}, "sort": {opts.sortBy}, "limit": {"1000"}}
+	if opts.desc {
+		query.Set("order", "desc")
+	}
+	if len(opts.tags) > 0 {
+		query["tag"] = opts.tags
+	}
+
+	var entries []FileInfo
+	for {
+		resp, err := client.Get(serverAddr + "/files?" + query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+			return nil, fmt.Errorf("%s - %s", resp.Status, message)
+		}
+
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+			if len(opts.tags) > 0 {
+				return nil, fmt.Errorf("server does not support tag filters, please upgrade it")
+			}
+			var all []FileInfo
+			if err := json.Unmarshal(body, &all); err != nil {
+				return nil, err
+			}
+			return filterLegacyListing(all, dir, opts), nil
+		}
+
+		var page listPage
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Entries...)
+		if page.NextCursor == "" {
+			return entries, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// filterLegacyListing 从旧版本服务器返回的完整列表中取出 dir 的直接子项
+func filterLegacyListing(all []FileInfo, dir string, opts *lsOptions) []FileInfo {
+	var entries []FileInfo
+	for _, f := range all {
+		parent := path.Dir(f.Path)
+		if parent == "." {
+			parent = ""
+		}
+		if parent == dir {
+			entries = append(entries, f)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		var less bool
+		switch opts.sortBy {
+		case "size":
+			less = a.Size < b.Size || (a.Size == b.Size && a.Path < b.Path)
+		case "modified":
+			less = a.Modified.Before(b.Modified) || (a.Modified.Equal(b.Modified) && a.Path < b.Path)
+		default:
+			less = a.Path < b.Path
+		}
+		if opts.desc {
+			return !less && (a.Path != b.Path)
+		}
+		return less
+	})
+	return entries
+}
+
+// lsSize 按 -h 选择可读大小或字节数
+func lsSize(f FileInfo, opts *lsOptions) string {
+	if f.IsDir {
+		return "-"
+	}
+	if opts.human {
+		return formatSize(f.Size)
+	}
+	return strconv.FormatInt(f.Size, 10)
+}
+
+func lsName(f FileInfo) string {
+	if f.IsDir {
+		return color.BlueString(f.Name + "/")
+	}
+	return f.Name
+}
+
+// printLong 输出长格式：类型、大小、修改时间、名称和标签，大小列右对齐且至少 width 宽
+func printLong(entries []FileInfo, opts *lsOptions, width int, prefix func(i int) string) {
+	for _, f := range entries {
+		width = max(width, len(lsSize(f, opts)))
+	}
+	for i, f := range entries {
+		kind := "-"
+		if f.IsDir {
+			kind = "d"
+		}
+		tags := ""
+		if len(f.Tags) > 0 {
+			tags = "  " + color.CyanString("[%s]", formatTags(f.Tags))
+		}
+		fmt.Printf("%s %*s  %s  %s%s%s\n", kind, width, lsSize(f, opts),
+			f.Modified.Local().Format("2006-01-02 15:04"), prefix(i), lsName(f), tags)
+	}
+}
+
+// printTree 以树形输出目录，子目录逐个请求
+func printTree(serverAddr, dir, indent string, opts *lsOptions, client *http.Client) {
+	entries, err := fetchDirectory(serverAddr, dir, opts, client)
+	if err != nil {
+		slog.Error("Failed to list directory", "path", dir, "error", err)
+		return
+	}
+	for i, f := range entries {
+		branch, next := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, next = "└── ", "    "
+		}
+		if opts.long {
+			// 树形输出逐行打印，大小列用固定宽度对齐
+			printLong([]FileInfo{f}, opts, 10, func(int) string { return indent + branch })
+		} else {
+			fmt.Printf("%s%s%s\n", indent, branch, lsName(f))
+		}
+		if f.IsDir {
+			printTree(serverAddr, f.Path, indent+next, opts, client)
+		}
+	}
+}
+
+// collectTree 递归获取目录下的所有条目（用于 -R --json）
+func collectTree(serverAddr, dir string, opts *lsOptions, client *http.Client) ([]FileInfo, error) {
+	entries, err := fetchDirectory(serverAddr, dir, opts, client)
+	if err != nil {
+		return nil, err
+	}
+	var all []FileInfo
+	for _, f := range entries {
+		all = append(all, f)
+		if f.IsDir {
+			children, err := collectTree(serverAddr, f.Path, opts, client)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, children...)
+		}
+	}
+	return all, nil
+}
+
+// listDirectory 列出服务器上的目录
+func listDirectory(serverAddr, dir string, opts *lsOptions, client *http.Client) {
+	if opts.json {
+		var entries []FileInfo
+		var err error
+		if opts.recursive {
+			entries, err = collectTree(serverAddr, dir, opts, client)
+		} else {
+			entries, err = fetchDirectory(serverAddr, dir, opts, client)
+		}
+		if err != nil {
+			fatal("List failed", "path", dir, "error", err)
+		}
+		if entries == nil {
+			entries = []FileInfo{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(entries)
+		return
+	}
+
+	if opts.recursive {
+		root := dir
+		if root == "" {
+			root = "/"
+		}
+		fmt.Println(color.BlueString(root))
+		printTree(serverAddr, dir, "", opts, client)
+		return
+	}
+
+	entries, err := fetchDirectory(serverAddr, dir, opts, client)
+	if err != nil {
+		fatal("List failed", "path", dir, "error", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No files available")
+		return
+	}
+	if opts.long {
+		printLong(entries, opts, 0, func(int) string { return "" })
+		return
+	}
+	for _, f := range entries {
+		fmt.Println(lsName(f))
+	}
+}
+
+// runLsCommand 处理 ls 子命令：ctrans ls [-l] [-R] [-h] [-S|-t] [-r] [--json] server:port[/path]
+func runLsCommand(args []string, client *http.Client) {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	opts := &lsOptions{sortBy: "name"}
+	fs.BoolVar(&opts.long, "l", false, "Long format: type, size, modification time and name")
+	fs.BoolVar(&opts.recursive, "R", false, "List subdirectories recursively as a tree")
+	fs.BoolVar(&opts.human, "h", false, "Print sizes in human readable units (default: bytes)")
+	bySize := fs.Bool("S", false, "Sort by size, largest first")
+	byTime := fs.Bool("t", false, "Sort by modification time, newest first")
+	reverse := fs.Bool("r", false, "Reverse the sort order")
+	fs.BoolVar(&opts.json, "json", false, "Print entries as JSON for scripts")
+	fs.Var(&opts.tags, "tag", "Only list files with this tag: key=value or key (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s ls [-l] [-R] [-h] [-S|-t] [-r] [--json] [-tag key=value]... <server:port>[/<path>]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 || !strings.Contains(strings.SplitN(args[0], "/", 2)[0], ":") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *bySize && *byTime {
+		fatal("Use either -S or -t")
+	}
+	if *bySize {
+		opts.sortBy = "size"
+	} else if *byTime {
+		opts.sortBy = "modified"
+	}
+	opts.desc = (opts.sortBy != "name") != *reverse
+
+	server, dir, _ := strings.Cut(args[0], "/")
+	listDirectory(parseServerAddr(server), strings.Trim(path.Clean("/"+dir), "/"), opts, client)
+}
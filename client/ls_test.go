@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// captureStdout 在 fn 执行期间把标准输出重定向到临时文件，返回写入的内容
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stdout := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = stdout }()
+	fn()
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDefaultListing(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = noColor })
+
+	modified := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tree := map[string][]FileInfo{
+		"": {
+			{Name: "builds", Path: "builds", IsDir: true, Modified: modified},
+			{Name: "readme.txt", Path: "readme.txt", Size: 2048, Modified: modified, Tags: map[string]string{"env": "prod"}},
+		},
+		"builds": {
+			{Name: "app.tar", Path: "builds/app.tar", Size: 5 << 20, Modified: modified},
+			{Name: "nightly", Path: "builds/nightly", IsDir: true, Modified: modified},
+		},
+		"builds/nightly": {},
+	}
+
+	stamp := modified.Local().Format("2006-01-02 15:04")
+	line := func(kind, size, name string) string {
+		return fmt.Sprintf("%s %10s  %s  %s\n", kind, size, stamp, name)
+	}
+	want := "/\n" +
+		line("d", "-", "├── builds/") +
+		line("-", "5.0 MB", "│   ├── app.tar") +
+		line("d", "-", "│   └── nightly/") +
+		line("-", "2.0 KB", "└── readme.txt  [env=prod]")
+
+	t.Run("paged listing", func(t *testing.T) {
+		var mu sync.Mutex
+		var requests []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			mu.Lock()
+			requests = append(requests, fmt.Sprintf("%s %s sort=%s order=%s limit=%s cursor=%s key=%s",
+				r.URL.Path, q.Get("path"), q.Get("sort"), q.Get("order"), q.Get("limit"), q.Get("cursor"), r.Header.Get(authHeader)))
+			mu.Unlock()
+
+			// 根目录分两页返回
+			entries, page := tree[q.Get("path")], listPage{}
+			switch {
+			case q.Get("path") == "" && q.Get("cursor") == "":
+				page = listPage{Entries: entries[:1], NextCursor: "page2"}
+			case q.Get("path") == "":
+				page = listPage{Entries: entries[1:]}
+			default:
+				page = listPage{Entries: entries}
+			}
+			json.NewEncoder(w).Encode(page)
+		}))
+		defer srv.Close()
+
+		client := createClient("secret", "", nil)
+		out := captureStdout(t, func() {
+			listDirectory(parseServerAddr(strings.TrimPrefix(srv.URL, "http://")), "", defaultListOptions(), client)
+		})
+		if out != want {
+			t.Errorf("output:\n%s\nwant:\n%s", out, want)
+		}
+
+		wantRequests := []string{
+			"/files  sort=name order= limit=1000 cursor= key=secret",
+			"/files  sort=name order= limit=1000 cursor=page2 key=secret",
+			"/files builds sort=name order= limit=1000 cursor= key=secret",
+			"/files builds/nightly sort=name order= limit=1000 cursor= key=secret",
+		}
+		if strings.Join(requests, "\n") != strings.Join(wantRequests, "\n") {
+			t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(requests, "\n"), strings.Join(wantRequests, "\n"))
+		}
+	})
+
+	// 旧版本服务器忽略查询参数，返回整个上传目录的数组
+	t.Run("legacy server", func(t *testing.T) {
+		var all []FileInfo
+		for _, entries := range tree {
+			all = append(all, entries...)
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(all)
+		}))
+		defer srv.Close()
+
+		out := captureStdout(t, func() {
+			listDirectory(parseServerAddr(strings.TrimPrefix(srv.URL, "http://")), "", defaultListOptions(), createClient("", "", nil))
+		})
+		if out != want {
+			t.Errorf("output:\n%s\nwant:\n%s", out, want)
+		}
+	})
+}
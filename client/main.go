@@ -2,33 +2,46 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/fatih/color"
 	"github.com/schollz/progressbar/v3"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	chunkSize  = 10 * 1024 * 1024 // 10MB per chunk
-	maxRetries = 3
-	stateDir   = ".upload_state" // 状态文件目录
-	authHeader = "X-Service-Key" // 认证头
+	chunkSize         = 10 * 1024 * 1024 // 10MB per chunk
+	maxRetries        = 3
+	maxBusyWait       = 5 * time.Minute  // 服务器繁忙（429/503）时每个分片累计最多等待的时间
+	stateDir          = ".upload_state"  // 状态文件目录
+	authHeader        = "X-Service-Key"  // 认证头
+	tokenHeader       = "X-Upload-Token" // 上传令牌头
+	maintenanceHeader = "X-Maintenance"  // 只读维护模式时服务器在 503 响应中带上该头，值为 read-only
 )
 
 var (
 	stateMutex sync.Mutex // 用于保护状态文件的并发访问
+	scheme     = "http"   // 未显式指定协议时使用的默认协议
+
+	uploadConcurrency   = 5     // 每个文件同时上传的分片数
+	adaptiveConcurrency = false // 根据吞吐量和错误率自动调整并发数
 )
 
 type UploadState struct {
@@ -59,9 +72,17 @@ type UploadStatus struct {
 }
 
 type FileInfo struct {
-	Name     string    `json:"name"`
-	Size     int64     `json:"size"`
-	Modified time.Time `json:"modified"`
+	Name        string            `json:"name"`
+	Path        string            `json:"path"`
+	Size        int64             `json:"size"`
+	Modified    time.Time         `json:"modified"`
+	IsDir       bool              `json:"is_dir"`
+	SHA256      string            `json:"sha256,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	UploadedBy  string            `json:"uploaded_by,omitempty"`
+	UploadedAt  *time.Time        `json:"uploaded_at,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
 }
 
 type ChunkStatus struct {
@@ -176,46 +197,92 @@ func (pw *progressWriter) Write(p []byte) (int, error) {
 }
 
 // 创建带认证的HTTP客户端
-func createClient(serverKey string) *http.Client {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+func createClient(serverKey, uploadToken string, tlsConfig *tls.Config) *http.Client {
+	// 不设置整体超时：限速时一个分片就可能传输几分钟。
+	// 连接和 TLS 握手沿用默认超时，等待响应头和传输停滞分别由 ResponseHeaderTimeout 和看门狗限制
+	client := &http.Client{}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
 	}
+	var base http.RoundTripper = &watchdogTransport{base: transport, idle: stallTimeout}
 
-	// 如果设置了服务密钥，添加默认传输器
-	if serverKey != "" {
-		client.Transport = &authTransport{
-			key:  serverKey,
-			base: http.DefaultTransport,
-		}
+	// 为每个请求创建客户端 span 并注入 traceparent 头
+	base = otelhttp.NewTransport(base)
+	client.Transport = base
+
+	// 添加认证头和请求 ID
+	client.Transport = &authTransport{
+		key:   serverKey,
+		token: uploadToken,
+		base:  base,
 	}
 
 	return client
 }
 
-// 认证传输器
+// 认证传输器：添加认证头和请求 ID
 type authTransport struct {
-	key  string
-	base http.RoundTripper
+	key   string
+	token string
+	base  http.RoundTripper
 }
 
 func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Set(authHeader, t.key)
+	// RoundTrip 不应修改调用方的请求
+	req = req.Clone(req.Context())
+	if req.Header.Get(requestIDHeader) == "" {
+		req.Header.Set(requestIDHeader, newRequestID())
+	}
+	slog.Debug("HTTP request", "method", req.Method, "url", req.URL.String(), "request_id", req.Header.Get(requestIDHeader))
+	if t.key != "" {
+		req.Header.Set(authHeader, t.key)
+	}
+	if t.token != "" {
+		req.Header.Set(tokenHeader, t.token)
+	}
 	return t.base.RoundTrip(req)
 }
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
-		fmt.Fprintf(os.Stderr, "  Upload:   %s <local-file> <server:port>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Upload:   %s [-tag key=value]... [-description text] <local-file> <server:port>\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  Download: %s <server:port>/<filename> [local-path]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  List:     %s <server:port>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  List:     %s <server:port>[/<path>]   (recursive, same as ls -l -R -h)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "            %s ls [-l] [-R] [-h] [-S|-t] [-r] [--json] <server:port>[/<path>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Search:   %s find [-name <glob>] [-type f|d] [-min-size N] [-newer T] [-sha256 H] <server:port>[/<path>] [text]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Info:     %s info <server:port>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Delete:   %s rm [-r] <server:port>/<path>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Move:     %s mv [-f] <server:port>/<path> <new-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Copy:     %s cp [-f] <server:port>/<path> <new-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Mkdir:    %s mkdir [-p] <server:port>/<path>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Trash:    %s trash ls|restore|purge <server:port> [<id>...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Versions: %s versions <server:port>/<path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Tags:     %s tag [-d text] [-rm key]... [-replace] <server:port>/<path> [key=value...]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
 		flag.PrintDefaults()
 	}
 
 	// 定义可选参数
-	serverKey := flag.String("key", "", "Service key for authentication (optional)")
+	serverKey := flag.String("key", "", "Service key for authentication (optional); with -cert, the private key of the client certificate")
+	uploadToken := flag.String("token", "", "Upload-only token issued by the server admin (optional)")
+	certFile := flag.String("cert", "", "Client certificate for mutual TLS (implies HTTPS)")
+	certKeyFile := flag.String("cert-key", "", "Private key for the client certificate (same as -key when used with -cert)")
+	caFile := flag.String("ca", "", "CA bundle used to verify the server certificate (implies HTTPS)")
+	useTLS := flag.Bool("tls", false, "Connect to the server over HTTPS")
 	resumeUpload := flag.String("resume", "", "Resume upload with file ID (optional)")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	limitRate := flag.String("limit-rate", "", "Limit total transfer rate across all chunks, e.g. 500K or 2M (bytes per second)")
+	concurrency := flag.Int("concurrency", uploadConcurrency, "Number of chunks uploaded in parallel")
+	adaptive := flag.Bool("adaptive", false, "Tune the number of parallel chunks based on throughput and errors")
+	flag.Var(uploadTags, "tag", "Tag the uploaded file, e.g. -tag build=1234 (repeatable)")
+	flag.StringVar(&uploadDescription, "description", "", "Description of the uploaded file")
+	flag.StringVar(&downloadVersion, "version-id", "", "Download this previous version of the file (see the versions command)")
+	traceTarget := flag.String("trace", "", "Export OpenTelemetry traces: stdout, otlp, or a collector endpoint such as localhost:4318")
 	help := flag.Bool("help", false, "Show help message")
 	flag.Parse()
 
@@ -231,19 +298,54 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 日志
+	if err := initLogging(*logFormat, *logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 限速与并发
+	if err := initRateLimit(*limitRate); err != nil {
+		fatal("Invalid -limit-rate", "error", err)
+	}
+	if *concurrency < 1 {
+		fatal("Invalid -concurrency, must be at least 1")
+	}
+	uploadConcurrency = *concurrency
+	adaptiveConcurrency = *adaptive
+
+	// TLS 配置：与 -cert 一起使用时 -key 是证书私钥（与 curl 相同），不再作为服务密钥发送
+	if *certFile != "" && *certKeyFile == "" {
+		*certKeyFile, *serverKey = *serverKey, ""
+	}
+	tlsConfig, err := loadTLSConfig(*certFile, *certKeyFile, *caFile)
+	if err != nil {
+		fatal("Invalid TLS options", "error", err)
+	}
+	if *useTLS || tlsConfig != nil {
+		scheme = "https"
+	}
+
+	// 链路追踪
+	shutdownTracing, err := initTracing(*traceTarget)
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// 创建HTTP客户端
-	client := createClient(*serverKey)
+	client := createClient(*serverKey, *uploadToken, tlsConfig)
 
 	// 创建状态目录
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
-		log.Fatal("Failed to create state directory:", err)
+		fatal("Failed to create state directory", "error", err)
 	}
 
 	// 解析命令类型
 	if *resumeUpload != "" {
 		// Resume模式
 		if len(args) != 1 {
-			fmt.Fprintf(os.Stderr, "Error: Resume mode requires server:port\n")
+			slog.Error("Resume mode requires server:port")
 			flag.Usage()
 			os.Exit(1)
 		}
@@ -252,22 +354,49 @@ func main() {
 		return
 	}
 
+	// 文件管理: ctrans rm/mv/cp/mkdir ...
+	if fileCommands[args[0]] {
+		runFileCommand(args[0], args[1:], client)
+		return
+	}
+	if args[0] == "trash" {
+		runTrashCommand(args[1:], client)
+		return
+	}
+	if args[0] == "ls" {
+		runLsCommand(args[1:], client)
+		return
+	}
+	if args[0] == "find" {
+		runFindCommand(args[1:], client)
+		return
+	}
+	if args[0] == "tag" {
+		runTagCommand(args[1:], client)
+		return
+	}
+
 	if len(args) == 1 {
-		// 列表模式: ctrans server:port
-		arg := args[0]
-		if !strings.Contains(arg, ":") {
-			fmt.Fprintf(os.Stderr, "Error: Invalid server format. Use server:port\n")
+		// 列表模式: ctrans server:port[/path]，和旧版本一样递归列出所有文件
+		server, dir, _ := strings.Cut(args[0], "/")
+		if !strings.Contains(server, ":") {
+			slog.Error("Invalid server format, use server:port")
 			flag.Usage()
 			os.Exit(1)
 		}
-		serverAddr := parseServerAddr(arg)
-		list(serverAddr, client)
+		listDirectory(parseServerAddr(server), strings.Trim(path.Clean("/"+dir), "/"), defaultListOptions(), client)
 	} else if len(args) == 2 {
 		// 两个参数：可能是上传或下载
 		first := args[0]
 		second := args[1]
 
-		if strings.Contains(first, ":") && strings.Contains(first, "/") {
+		if first == "info" {
+			// 服务器信息: ctrans info server:port
+			showInfo(parseServerAddr(second), client)
+		} else if first == "versions" {
+			// 历史版本: ctrans versions server:port/path
+			showVersions(second, client)
+		} else if strings.Contains(first, ":") && strings.Contains(first, "/") {
 			// 下载模式: ctrans server:port/filename localpath
 			downloadFromRemote(first, second, client)
 		} else if strings.Contains(second, ":") && !strings.Contains(second, "/") {
@@ -275,30 +404,47 @@ func main() {
 			uploadFile := first
 			serverAddr := parseServerAddr(second)
 
+			fileInfo, err := os.Stat(uploadFile)
+			if err != nil {
+				fatal("Error getting file info", "error", err)
+			}
+			checkServer(serverAddr, client, true, fileInfo.Size())
+
 			// 检查是否有未完成的上传任务
 			if state := findIncompleteUpload(uploadFile, serverAddr, client); state != nil {
-				color.Yellow("Found incomplete upload for %s", uploadFile)
-				color.Yellow("Resuming upload with file ID: %s", state.FileID)
+				slog.Info("Resuming incomplete upload", "file", uploadFile, "file_id", state.FileID)
 				uploadChunks(serverAddr, state.FileID, state.FilePath, state.TotalSize, client)
 			} else {
 				upload(serverAddr, uploadFile, client)
 			}
 		} else {
-			fmt.Fprintf(os.Stderr, "Error: Invalid arguments. Check usage.\n")
+			slog.Error("Invalid arguments, check usage")
 			flag.Usage()
 			os.Exit(1)
 		}
 	} else {
-		fmt.Fprintf(os.Stderr, "Error: Too many arguments\n")
+		slog.Error("Too many arguments")
 		flag.Usage()
 		os.Exit(1)
 	}
 }
 
+// retryAfter 返回服务器繁忙（429/503）时建议的等待时间，其他响应返回 0
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 // 解析服务器地址，确保格式正确
 func parseServerAddr(addr string) string {
 	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
-		addr = "http://" + addr
+		addr = scheme + "://" + addr
 	}
 	return addr
 }
@@ -308,8 +454,7 @@ func downloadFromRemote(remote string, localPath string, client *http.Client) {
 	// 解析远程路径: server:port/filename
 	parts := strings.SplitN(remote, "/", 2)
 	if len(parts) != 2 {
-		fmt.Fprintf(os.Stderr, "Error: Invalid remote path format. Use server:port/filename\n")
-		os.Exit(1)
+		fatal("Invalid remote path format, use server:port/filename")
 	}
 
 	serverAddr := parseServerAddr(parts[0])
@@ -320,31 +465,45 @@ func downloadFromRemote(remote string, localPath string, client *http.Client) {
 		localPath = filename
 	}
 
+	checkServer(serverAddr, client, false, 0)
 	downloadFile(serverAddr, filename, localPath, client)
 }
 
 // 修改下载函数以支持自定义本地路径
 func downloadFile(serverAddr, filename, localPath string, client *http.Client) {
+	ctx, span := tracer.Start(context.Background(), "downloadFile", trace.WithAttributes(
+		attribute.String("ctrans.server", serverAddr),
+		attribute.String("ctrans.path", filename),
+	))
+	defer span.End()
+
 	// 获取文件信息
-	resp, err := client.Head(fmt.Sprintf("%s/download/%s", serverAddr, filename))
+	headReq, err := http.NewRequestWithContext(ctx, "HEAD", downloadURL(serverAddr, filename), nil)
 	if err != nil {
-		log.Fatal("Error getting file info:", err)
+		fatal("Error creating request", "error", err)
+	}
+	resp, err := client.Do(headReq)
+	if err != nil {
+		spanError(span, err)
+		fatal("Error getting file info", "error", err)
 	}
 	resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("File not found: %s", resp.Status)
+		spanError(span, fmt.Errorf("file info: %s", resp.Status))
+		fatal("File not found", "status", resp.Status, "request_id", resp.Header.Get(requestIDHeader))
 	}
 
 	fileSize := resp.ContentLength
 	if fileSize == -1 {
-		log.Fatal("Server did not provide file size")
+		fatal("Server did not provide file size")
 	}
+	span.SetAttributes(attribute.Int64("ctrans.size", fileSize))
 
 	// 创建目标文件
 	out, err := os.Create(localPath)
 	if err != nil {
-		log.Fatal("Error creating file:", err)
+		fatal("Error creating file", "error", err)
 	}
 	defer out.Close()
 
@@ -388,46 +547,61 @@ func downloadFile(serverAddr, filename, localPath string, client *http.Client) {
 		// 获取已下载的大小
 		downloaded := fileInfo.Size()
 		if downloaded >= fileSize {
-			color.Green("File already downloaded!")
+			slog.Info("File already downloaded", "path", localPath)
 			return
 		}
 
 		// 设置Range头
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/download/%s", serverAddr, filename), nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", downloadURL(serverAddr, filename), nil)
 		if err != nil {
-			log.Fatal("Error creating request:", err)
+			fatal("Error creating request", "error", err)
 		}
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", downloaded))
+		span.SetAttributes(attribute.Int64("ctrans.resume_offset", downloaded))
 
 		resp, err := client.Do(req)
 		if err != nil {
-			log.Fatal("Error resuming download:", err)
+			spanError(span, err)
+			fatal("Error resuming download", "error", err)
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusPartialContent {
-			log.Fatal("Server does not support resume")
+			spanError(span, fmt.Errorf("resume: %s", resp.Status))
+			fatal("Server does not support resume")
 		}
 
 		bar.Add64(downloaded)
-		_, err = io.Copy(progressWriter, resp.Body)
+		_, err = io.Copy(progressWriter, throttle(ctx, resp.Body))
+		if err != nil {
+			spanError(span, err)
+		}
 	} else {
 		// 从头开始下载
-		resp, err := client.Get(fmt.Sprintf("%s/download/%s", serverAddr, filename))
+		req, err := http.NewRequestWithContext(ctx, "GET", downloadURL(serverAddr, filename), nil)
+		if err != nil {
+			fatal("Error creating request", "error", err)
+		}
+		resp, err := client.Do(req)
 		if err != nil {
-			log.Fatal("Error downloading file:", err)
+			spanError(span, err)
+			fatal("Error downloading file", "error", err)
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
-			log.Fatalf("Download failed: %s - %s", resp.Status, string(body))
+			spanError(span, fmt.Errorf("download: %s", resp.Status))
+			fatal("Download failed", responseError(resp, body)...)
 		}
 
-		_, err = io.Copy(progressWriter, resp.Body)
+		_, err = io.Copy(progressWriter, throttle(ctx, resp.Body))
+		if err != nil {
+			spanError(span, err)
+		}
 	}
 
-	color.Green("Download completed successfully!")
+	slog.Info("Download completed", "path", localPath)
 }
 
 func findIncompleteUpload(filePath, serverAddr string, client *http.Client) *UploadState {
@@ -459,18 +633,18 @@ func findIncompleteUpload(filePath, serverAddr string, client *http.Client) *Upl
 
 			// 忽略fileID为空的状态文件
 			if state.FileID == "" {
-				log.Printf("Warning: Found state file with empty file ID, removing: %s", statePath)
+				slog.Warn("Found state file with empty file ID, removing", "file", statePath)
 				os.Remove(statePath)
 				continue
 			}
 
 			if state.FilePath == absPath && state.ServerAddr == serverAddr && !state.Completed {
 				// 获取服务器上的分片状态
-				serverStatus, err := getServerChunkStatus(serverAddr, state.FileID, client)
+				serverStatus, err := getServerChunkStatus(context.Background(), serverAddr, state.FileID, client)
 				if err != nil {
-					log.Printf("Warning: Failed to get server chunk status: %v", err)
+					slog.Warn("Failed to get server chunk status", "error", err)
 					// 如果服务器上没有这个上传会话，删除本地状态文件
-					log.Printf("Removing invalid state file: %s", statePath)
+					slog.Info("Removing invalid state file", "file", statePath)
 					os.Remove(statePath)
 					continue
 				}
@@ -515,24 +689,24 @@ func upload(serverAddr, filePath string, client *http.Client) {
 	// 获取文件信息
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
-		log.Fatal("Error getting file info:", err)
+		fatal("Error getting file info", "error", err)
 	}
 
 	// 获取文件的绝对路径
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		log.Fatal("Error getting absolute path:", err)
+		fatal("Error getting absolute path", "error", err)
 	}
 
 	// 初始化上传
-	initResp, err := initUpload(serverAddr, filePath, fileInfo.Size(), client)
+	initResp, err := initUpload(serverAddr, filePath, fileInfo, client)
 	if err != nil {
-		log.Fatal("Failed to initialize upload:", err)
+		fatal("Failed to initialize upload", "error", err)
 	}
 
 	// 验证返回的fileID不为空
 	if initResp.FileID == "" {
-		log.Fatal("Server returned empty file ID")
+		fatal("Server returned empty file ID")
 	}
 
 	// 获取文件名
@@ -554,7 +728,7 @@ func upload(serverAddr, filePath string, client *http.Client) {
 	// 只有在fileID不为空时才保存状态
 	if state.FileID != "" {
 		if err := saveUploadState(state); err != nil {
-			log.Printf("Warning: Failed to save upload state: %v", err)
+			slog.Warn("Failed to save upload state", "error", err)
 		}
 	}
 
@@ -562,18 +736,24 @@ func upload(serverAddr, filePath string, client *http.Client) {
 	uploadChunks(serverAddr, state.FileID, filePath, fileInfo.Size(), client)
 }
 
-func initUpload(serverAddr, filePath string, fileSize int64, client *http.Client) (struct {
+func initUpload(serverAddr, filePath string, fileInfo os.FileInfo, client *http.Client) (struct {
 	FileID string `json:"file_id"`
 }, error) {
 	// 获取文件名
 	_, fileName := filepath.Split(filePath)
 
 	reqBody := struct {
-		FileName  string `json:"file_name"`
-		TotalSize int64  `json:"total_size"`
+		FileName    string            `json:"file_name"`
+		TotalSize   int64             `json:"total_size"`
+		Modified    time.Time         `json:"modified"` // 服务器记录到文件元数据
+		Tags        map[string]string `json:"tags,omitempty"`
+		Description string            `json:"description,omitempty"`
 	}{
-		FileName:  fileName,
-		TotalSize: fileSize,
+		FileName:    fileName,
+		TotalSize:   fileInfo.Size(),
+		Modified:    fileInfo.ModTime().UTC(),
+		Tags:        uploadTags,
+		Description: uploadDescription,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -611,21 +791,30 @@ func initUpload(serverAddr, filePath string, fileSize int64, client *http.Client
 }
 
 func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *http.Client) {
+	ctx, span := tracer.Start(context.Background(), "uploadChunks", trace.WithAttributes(
+		attribute.String("ctrans.server", serverAddr),
+		attribute.String("ctrans.file_id", fileID),
+		attribute.String("ctrans.path", filePath),
+		attribute.Int64("ctrans.size", fileSize),
+	))
+	defer span.End()
+
 	// 获取上传状态
-	status, err := getUploadStatus(serverAddr, fileID, client)
+	status, err := getUploadStatus(ctx, serverAddr, fileID, client)
 	if err != nil {
-		log.Fatal("Failed to get upload status:", err)
+		spanError(span, err)
+		fatal("Failed to get upload status", "error", err)
 	}
 
 	// 获取服务器上的分片状态
-	serverStatus, err := getServerChunkStatus(serverAddr, fileID, client)
+	serverStatus, err := getServerChunkStatus(ctx, serverAddr, fileID, client)
 	if err != nil {
-		log.Printf("Warning: Failed to get server chunk status: %v", err)
+		slog.Warn("Failed to get server chunk status", "error", err)
 	} else {
 		// 比较本地文件和服务器状态
 		neededChunks := compareChunks(filePath, serverStatus)
 		if len(neededChunks) > 0 {
-			color.Yellow("Found %d chunks that need to be uploaded", len(neededChunks))
+			slog.Info("Found chunks that need to be uploaded", "count", len(neededChunks))
 			status.Uploaded = neededChunks
 		}
 	}
@@ -634,7 +823,7 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 	stateFile := filepath.Join(stateDir, fileID+".json")
 	stateData, err := os.ReadFile(stateFile)
 	if err != nil {
-		log.Printf("Warning: Failed to read state file: %v", err)
+		slog.Warn("Failed to read state file", "error", err)
 	} else {
 		var localState UploadState
 		if err := json.Unmarshal(stateData, &localState); err == nil {
@@ -646,7 +835,7 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 	// 打开文件
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Fatal("Error opening file:", err)
+		fatal("Error opening file", "error", err)
 	}
 	defer file.Close()
 
@@ -691,7 +880,7 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 	// 创建等待组和错误通道
 	var wg sync.WaitGroup
 	errChan := make(chan error, status.TotalChunks)
-	semaphore := make(chan struct{}, 5) // 限制并发数
+	scheduler := newChunkScheduler(uploadConcurrency, adaptiveConcurrency)
 
 	// 更新本地状态
 	state := &UploadState{
@@ -722,11 +911,16 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 		}
 
 		wg.Add(1)
-		semaphore <- struct{}{} // 获取信号量
+		scheduler.acquire()
 
 		go func(chunkNum int) {
 			defer wg.Done()
-			defer func() { <-semaphore }() // 释放信号量
+			var sent int64
+			defer func() { scheduler.release(sent, sent > 0) }()
+
+			chunkCtx, chunkSpan := tracer.Start(ctx, "upload chunk",
+				trace.WithAttributes(attribute.Int("ctrans.chunk", chunkNum)))
+			defer chunkSpan.End()
 
 			// 计算分片大小
 			start := int64(chunkNum) * chunkSize
@@ -740,33 +934,63 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 			chunk := make([]byte, chunkSize)
 			if _, err := file.ReadAt(chunk, start); err != nil {
 				errChan <- fmt.Errorf("error reading chunk %d: %v", chunkNum, err)
+				spanError(chunkSpan, err)
 				return
 			}
 
-			// 上传分片
+			// 上传分片；服务器繁忙（429/503）时按 Retry-After 等待，不计入重试次数，累计不超过 maxBusyWait。
+			// 只读维护模式可能持续很久，直接失败，稍后可以续传
+			var busyWaited time.Duration
 			for retry := 0; retry < maxRetries; retry++ {
-				req, err := http.NewRequest("POST",
+				chunkSpan.SetAttributes(attribute.Int("ctrans.attempts", retry+1))
+				req, err := http.NewRequestWithContext(chunkCtx, "POST",
 					fmt.Sprintf("%s/upload/chunk/%s/%d", serverAddr, fileID, chunkNum),
-					bytes.NewReader(chunk))
+					throttle(chunkCtx, bytes.NewReader(chunk)))
 				if err != nil {
 					errChan <- fmt.Errorf("error creating request for chunk %d: %v", chunkNum, err)
 					return
 				}
+				req.ContentLength = int64(len(chunk))
 
 				resp, err := client.Do(req)
 				if err != nil {
+					scheduler.failure()
 					if retry == maxRetries-1 {
 						errChan <- fmt.Errorf("error uploading chunk %d: %v", chunkNum, err)
+						spanError(chunkSpan, err)
 						return
 					}
 					time.Sleep(time.Second * time.Duration(retry+1))
 					continue
 				}
+				body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 				resp.Body.Close()
 
+				if resp.StatusCode != http.StatusOK {
+					scheduler.failure()
+				}
+				if resp.Header.Get(maintenanceHeader) == "read-only" {
+					message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+					errChan <- fmt.Errorf("error uploading chunk %d: %s", chunkNum, message)
+					spanError(chunkSpan, fmt.Errorf("chunk upload: %s", resp.Status))
+					return
+				}
+				if delay := retryAfter(resp); delay > 0 {
+					if busyWaited+delay > maxBusyWait {
+						errChan <- fmt.Errorf("error uploading chunk %d: server still busy after waiting %s: %s", chunkNum, busyWaited, resp.Status)
+						spanError(chunkSpan, fmt.Errorf("chunk upload: %s", resp.Status))
+						return
+					}
+					busyWaited += delay
+					retry--
+					slog.Debug("Server busy, waiting", "chunk", chunkNum, "retry_after", delay)
+					time.Sleep(delay)
+					continue
+				}
 				if resp.StatusCode != http.StatusOK {
 					if retry == maxRetries-1 {
 						errChan <- fmt.Errorf("error uploading chunk %d: %s", chunkNum, resp.Status)
+						spanError(chunkSpan, fmt.Errorf("chunk upload: %s", resp.Status))
 						return
 					}
 					time.Sleep(time.Second * time.Duration(retry+1))
@@ -778,12 +1002,13 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 				state.Uploaded = append(state.Uploaded, chunkNum)
 				state.LastUpdate = time.Now()
 				if err := saveUploadState(state); err != nil {
-					log.Printf("Warning: Failed to save upload state: %v", err)
+					slog.Warn("Failed to save upload state", "error", err)
 				}
 				stateMutex.Unlock()
 
 				// 使用进度写入器更新进度
 				progressWriter.Write(chunk)
+				sent = int64(len(chunk))
 				break
 			}
 		}(i)
@@ -795,21 +1020,27 @@ func uploadChunks(serverAddr, fileID, filePath string, fileSize int64, client *h
 
 	// 检查错误
 	for err := range errChan {
-		log.Printf("Upload error: %v", err)
-		log.Fatal("Upload failed, you can resume later by running the same upload command")
+		slog.Error("Upload error", "error", err)
+		spanError(span, err)
+		span.End()
+		fatal("Upload failed, you can resume later by running the same upload command")
 	}
 
 	// 完成上传
-	completeUpload(serverAddr, fileID, client)
+	completeUpload(ctx, serverAddr, fileID, client)
 
 	// 删除状态文件
 	if err := deleteUploadState(fileID); err != nil {
-		log.Printf("Warning: Failed to delete state file: %v", err)
+		slog.Warn("Failed to delete state file", "error", err)
 	}
 }
 
-func getUploadStatus(serverAddr, fileID string, client *http.Client) (*UploadStatus, error) {
-	resp, err := client.Get(fmt.Sprintf("%s/upload/status/%s", serverAddr, fileID))
+func getUploadStatus(ctx context.Context, serverAddr, fileID string, client *http.Client) (*UploadStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/upload/status/%s", serverAddr, fileID), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -828,16 +1059,20 @@ func getUploadStatus(serverAddr, fileID string, client *http.Client) (*UploadSta
 	return &status, nil
 }
 
-func completeUpload(serverAddr, fileID string, client *http.Client) {
-	resp, err := client.Post(fmt.Sprintf("%s/upload/complete/%s", serverAddr, fileID), "", nil)
+func completeUpload(ctx context.Context, serverAddr, fileID string, client *http.Client) {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/upload/complete/%s", serverAddr, fileID), nil)
 	if err != nil {
-		log.Fatal("Failed to complete upload:", err)
+		fatal("Failed to complete upload", "error", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fatal("Failed to complete upload", "error", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		log.Fatalf("Failed to complete upload: %s - %s", resp.Status, string(body))
+		fatal("Failed to complete upload", responseError(resp, body)...)
 	}
 
 	var result struct {
@@ -845,61 +1080,31 @@ func completeUpload(serverAddr, fileID string, client *http.Client) {
 		Checksum string `json:"checksum"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Fatal("Failed to decode response:", err)
+		fatal("Failed to decode response", "error", err)
 	}
 
-	color.Green("Upload completed successfully!")
-	color.Cyan("File checksum: %s", result.Checksum)
+	slog.Info("Upload completed", "file_id", fileID, "checksum", result.Checksum)
 }
 
 func resumeUploadFile(serverAddr, fileID string, client *http.Client) {
 	// 获取上传状态
-	status, err := getUploadStatus(serverAddr, fileID, client)
+	status, err := getUploadStatus(context.Background(), serverAddr, fileID, client)
 	if err != nil {
-		log.Fatal("Failed to get upload status:", err)
+		fatal("Failed to get upload status", "error", err)
 	}
 
 	if status.Completed {
-		color.Green("Upload already completed!")
+		slog.Info("Upload already completed", "file_id", fileID)
 		return
 	}
 
+	remaining := status.TotalSize - int64(len(status.Uploaded))*chunkSize
+	checkServer(serverAddr, client, true, remaining)
+
 	// 继续上传
 	uploadChunks(serverAddr, fileID, status.FileName, status.TotalSize, client)
 }
 
-func list(serverAddr string, client *http.Client) {
-	resp, err := client.Get(serverAddr + "/files")
-	if err != nil {
-		log.Fatal("Error listing files:", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Fatalf("List failed: %s - %s", resp.Status, string(body))
-	}
-
-	var files []FileInfo
-	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
-		log.Fatal("Error parsing response:", err)
-	}
-
-	if len(files) == 0 {
-		fmt.Println("No files available")
-		return
-	}
-
-	fmt.Println("\nAvailable files:")
-	fmt.Println("----------------")
-	for _, file := range files {
-		fmt.Printf("Name: %s\n", color.CyanString(file.Name))
-		fmt.Printf("Size: %s\n", formatSize(file.Size))
-		fmt.Printf("Modified: %s\n", file.Modified.Format(time.RFC3339))
-		fmt.Println("----------------")
-	}
-}
-
 func formatSize(size int64) string {
 	const unit = 1024
 	if size < unit {
@@ -913,8 +1118,12 @@ func formatSize(size int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-func getServerChunkStatus(serverAddr, fileID string, client *http.Client) (*ServerChunkStatus, error) {
-	resp, err := client.Get(fmt.Sprintf("%s/upload/status/%s/chunks", serverAddr, fileID))
+func getServerChunkStatus(ctx context.Context, serverAddr, fileID string, client *http.Client) (*ServerChunkStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/upload/status/%s/chunks", serverAddr, fileID), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -936,7 +1145,7 @@ func getServerChunkStatus(serverAddr, fileID string, client *http.Client) (*Serv
 func compareChunks(filePath string, serverStatus *ServerChunkStatus) []int {
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Printf("Error opening file for comparison: %v", err)
+		slog.Error("Error opening file for comparison", "error", err)
 		return nil
 	}
 	defer file.Close()
@@ -956,13 +1165,13 @@ func compareChunks(filePath string, serverStatus *ServerChunkStatus) []int {
 
 		// 读取分片数据
 		if _, err := file.Seek(start, 0); err != nil {
-			log.Printf("Error seeking to chunk %d: %v", i, err)
+			slog.Error("Error seeking to chunk", "chunk", i, "error", err)
 			continue
 		}
 
 		n, err := io.ReadFull(file, buffer[:chunkSize])
 		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Printf("Error reading chunk %d: %v", i, err)
+			slog.Error("Error reading chunk", "chunk", i, "error", err)
 			continue
 		}
 
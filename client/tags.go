@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// 上传时由 -tag 和 -description 指定，记录到服务器的文件元数据
+var (
+	uploadTags        = tagList{}
+	uploadDescription string
+)
+
+// tagList 可重复的 -tag key=value 参数
+type tagList map[string]string
+
+func (t tagList) String() string {
+	return formatTags(t)
+}
+
+func (t tagList) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("use key=value")
+	}
+	t[key] = v
+	return nil
+}
+
+// stringList 可重复的字符串参数
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// formatTags 按名称排序输出 key=value
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + tags[key]
+	}
+	return strings.Join(parts, " ")
+}
+
+// FileMeta /api/metadata 的响应
+type FileMeta struct {
+	Path        string            `json:"path"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	UploadedBy  string            `json:"uploaded_by"`
+	ContentType string            `json:"content_type"`
+	Tags        map[string]string `json:"tags"`
+	Description string            `json:"description"`
+}
+
+// showFileMeta 显示文件的标签和描述
+func showFileMeta(serverAddr, filePath string, client *http.Client) {
+	resp, err := client.Get(serverAddr + "/api/metadata?path=" + url.QueryEscape(filePath))
+	if err != nil {
+		fatal("Failed to get file metadata", "error", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		fatal("Failed to get file metadata", "status", resp.Status, "error", message)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		fatal("Server does not support tags, please upgrade it")
+	}
+
+	var meta FileMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		fatal("Invalid server response", "error", err)
+	}
+	fmt.Printf("Path:        %s\n", meta.Path)
+	fmt.Printf("Size:        %s\n", formatSize(meta.Size))
+	fmt.Printf("SHA256:      %s\n", meta.SHA256)
+	if meta.UploadedBy != "" {
+		fmt.Printf("Uploaded by: %s\n", meta.UploadedBy)
+	}
+	fmt.Printf("Tags:        %s\n", color.CyanString(formatTags(meta.Tags)))
+	if meta.Description != "" {
+		fmt.Printf("Description: %s\n", meta.Description)
+	}
+}
+
+// runTagCommand 处理 tag 子命令：ctrans tag [-d text] [-rm key] [-replace] server:port/path [key=value...]
+// 不带修改时显示文件当前的标签和描述
+func runTagCommand(args []string, client *http.Client) {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	var remove stringList
+	description := fs.String("d", "", "Set the file description (use -d '' to clear it)")
+	fs.Var(&remove, "rm", "Remove a tag (repeatable)")
+	replace := fs.Bool("replace", false, "Replace all existing tags instead of adding to them")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s tag [-d <description>] [-rm <key>]... [-replace] <server:port>/<path> [key=value...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	serverAddr, filePath, err := splitRemote(args[0])
+	if err != nil {
+		fatal("Invalid remote path", "error", err)
+	}
+
+	setDescription := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "d" {
+			setDescription = true
+		}
+	})
+	if len(args) == 1 && len(remove) == 0 && !setDescription && !*replace {
+		showFileMeta(serverAddr, filePath, client)
+		return
+	}
+
+	tags := make(map[string]*string)
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			fatal("Invalid tag, use key=value", "tag", arg)
+		}
+		tags[key] = &value
+	}
+	for _, key := range remove {
+		tags[key] = nil
+	}
+	body := map[string]interface{}{"path": filePath, "tags": tags, "replace_tags": *replace}
+	if setDescription {
+		body["description"] = *description
+	}
+	if err := postFileOp(serverAddr, "/api/metadata/update", body, client); err != nil {
+		fatal("Failed to update tags", "path", filePath, "error", err)
+	}
+	slog.Info("Updated tags", "path", filePath)
+	showFileMeta(serverAddr, filePath, client)
+}
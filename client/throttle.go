@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	throttleBlock          = 32 * 1024 // 限速时每次读取的最大字节数
+	maxAdaptiveConcurrency = 16        // 自适应模式下的并发上限
+)
+
+// rateLimiter 所有并发分片上传和下载共享的令牌桶，nil 表示不限速
+var rateLimiter *rate.Limiter
+
+// parseByteSize 解析 "512K"、"2MB"、"1.5G" 等大小，不带单位时为字节
+func parseByteSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	units := []struct {
+		suffix string
+		mult   float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}}
+	mult := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid rate %q (expected e.g. 500K, 2M or 1.5G)", size)
+	}
+	return int64(v * mult), nil
+}
+
+// initRateLimit 根据 -limit-rate 设置全局限速，空字符串表示不限速
+func initRateLimit(limit string) error {
+	if limit == "" {
+		return nil
+	}
+	bytesPerSecond, err := parseByteSize(limit)
+	if err != nil {
+		return err
+	}
+	// 令牌桶容量取 1 秒的量，避免并发分片同时开始时瞬间突发过多
+	rateLimiter = rate.NewLimiter(rate.Limit(bytesPerSecond), max(int(bytesPerSecond), throttleBlock))
+	return nil
+}
+
+// throttledReader 按全局令牌桶限速读取
+type throttledReader struct {
+	r   io.Reader
+	ctx context.Context
+}
+
+// throttle 未设置 -limit-rate 时原样返回
+func throttle(ctx context.Context, r io.Reader) io.Reader {
+	if rateLimiter == nil {
+		return r
+	}
+	return &throttledReader{r: r, ctx: ctx}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleBlock {
+		p = p[:throttleBlock]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := rateLimiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// chunkScheduler 控制同时上传的分片数。
+// 固定模式下等同于容量为 limit 的信号量；自适应模式下根据每个统计窗口的吞吐量和错误率调整 limit：
+// 出现错误或服务器繁忙时减半，否则逐个增减并在吞吐量下降时反向（爬山法）。
+type chunkScheduler struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	inFlight int
+	adaptive bool
+
+	// 当前统计窗口
+	windowStart  time.Time
+	windowBytes  int64
+	windowChunks int
+	windowErrors int
+
+	lastThroughput float64
+	direction      int       // +1 增加并发，-1 减少并发
+	cooldownUntil  time.Time // 减半后短时间内忽略错误，同一批并发请求的失败只减半一次
+}
+
+func newChunkScheduler(concurrency int, adaptive bool) *chunkScheduler {
+	s := &chunkScheduler{
+		limit:       max(concurrency, 1),
+		adaptive:    adaptive,
+		windowStart: time.Now(),
+		direction:   1,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// acquire 等待空闲的上传名额
+func (s *chunkScheduler) acquire() {
+	s.mu.Lock()
+	for s.inFlight >= s.limit {
+		s.cond.Wait()
+	}
+	s.inFlight++
+	s.mu.Unlock()
+}
+
+// release 归还名额并记录该分片的结果
+func (s *chunkScheduler) release(bytes int64, ok bool) {
+	s.mu.Lock()
+	s.inFlight--
+	if ok {
+		s.windowBytes += bytes
+		s.windowChunks++
+	} else {
+		s.windowErrors++
+	}
+	s.adjust()
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// failure 记录一次失败的尝试（网络错误、错误状态码或服务器繁忙），分片会重试
+func (s *chunkScheduler) failure() {
+	s.mu.Lock()
+	s.windowErrors++
+	s.adjust()
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// adjust 窗口结束时调整并发数；调用方持有 s.mu
+func (s *chunkScheduler) adjust() {
+	if !s.adaptive {
+		return
+	}
+	if s.windowErrors > 0 && time.Now().Before(s.cooldownUntil) {
+		s.windowErrors = 0
+		return
+	}
+	elapsed := time.Since(s.windowStart)
+	if s.windowErrors == 0 && (s.windowChunks < s.limit || elapsed < 2*time.Second) {
+		return
+	}
+
+	previous := s.limit
+	throughput := float64(s.windowBytes) / elapsed.Seconds()
+	switch {
+	case s.windowErrors > 0:
+		s.limit = max(s.limit/2, 1)
+		s.direction = 1
+		s.lastThroughput = 0
+		s.cooldownUntil = time.Now().Add(2 * time.Second)
+	case throughput < s.lastThroughput*0.95:
+		s.direction = -s.direction
+		s.limit += s.direction
+	case throughput > s.lastThroughput*1.05:
+		s.limit += s.direction
+	}
+	s.limit = min(max(s.limit, 1), maxAdaptiveConcurrency)
+
+	if s.limit != previous {
+		slog.Debug("Adjusted upload concurrency", "from", previous, "to", s.limit,
+			"throughput", formatSpeed(throughput), "errors", s.windowErrors)
+	}
+	if s.windowErrors == 0 {
+		s.lastThroughput = throughput
+	}
+	s.windowStart = time.Now()
+	s.windowBytes, s.windowChunks, s.windowErrors = 0, 0, 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingPropagation(t *testing.T) {
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	if _, err := initTracing(""); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	// 服务器按 W3C traceparent 解析出的上游 span
+	var received trace.SpanContext
+	var requestID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		received = trace.SpanContextFromContext(ctx)
+		requestID = r.Header.Get(requestIDHeader)
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "upload")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/info", nil)
+	resp, err := createClient("", "", nil).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	parent.End()
+
+	var client sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.SpanKind() == trace.SpanKindClient {
+			client = s
+		}
+	}
+	if client == nil {
+		t.Fatalf("no client span recorded among %d spans", len(recorder.Ended()))
+	}
+	if client.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("client span parent = %s, want %s", client.Parent().SpanID(), parent.SpanContext().SpanID())
+	}
+	if !received.IsValid() || received.TraceID() != parent.SpanContext().TraceID() || received.SpanID() != client.SpanContext().SpanID() {
+		t.Errorf("server received span %s/%s, want client span %s/%s",
+			received.TraceID(), received.SpanID(), client.SpanContext().TraceID(), client.SpanContext().SpanID())
+	}
+	if requestID == "" {
+		t.Error("request sent without X-Request-ID")
+	}
+}
+
+func TestInitTracingTargets(t *testing.T) {
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	for _, target := range []string{"otlp", "collector:4318", "https://collector.example.com:4318"} {
+		shutdown, err := initTracing(target)
+		if err != nil {
+			t.Errorf("initTracing(%q): %v", target, err)
+			continue
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("initTracing(%q) shutdown: %v", target, err)
+		}
+	}
+}
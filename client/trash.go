@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TrashEntry 服务器回收站中的一项
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	IsDir     bool      `json:"is_dir"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by"`
+	Reason    string    `json:"reason"`
+}
+
+// getTrash 获取回收站内容
+func getTrash(serverAddr string, client *http.Client) ([]TrashEntry, error) {
+	resp, err := client.Get(serverAddr + "/api/trash")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("server does not support the trash, please upgrade it")
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		return nil, fmt.Errorf("%s - %s", resp.Status, message)
+	}
+
+	var entries []TrashEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// trashPurgeResult 清除回收站的结果，部分条目失败时服务器返回 207
+type trashPurgeResult struct {
+	Purged []string `json:"purged"`
+	Failed []struct {
+		ID    string `json:"id"`
+		Error string `json:"error"`
+	} `json:"failed"`
+}
+
+// purgeTrash 永久删除回收站条目，all 为 true 时清空回收站
+func purgeTrash(serverAddr string, ids []string, all bool, client *http.Client) (*trashPurgeResult, error) {
+	data, err := json.Marshal(map[string]interface{}{"ids": ids, "all": all})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(serverAddr+"/api/trash/purge", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		body, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		return nil, fmt.Errorf("%s - %s", resp.Status, message)
+	}
+
+	var result trashPurgeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// runTrashCommand 处理 trash ls/restore/purge 子命令
+func runTrashCommand(args []string, client *http.Client) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s trash ls <server:port>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s trash restore [-f] [-to <path>] <server:port> <id>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s trash purge [-all] <server:port> [<id>...]\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet("trash "+command, flag.ExitOnError)
+	var force, all *bool
+	var to *string
+	switch command {
+	case "ls":
+	case "restore":
+		force = fs.Bool("f", false, "Overwrite an existing file at the restore path (it is moved to the trash)")
+		to = fs.String("to", "", "Restore to this path instead of the original one (single entry only)")
+	case "purge":
+		all = fs.Bool("all", false, "Empty the whole trash")
+	default:
+		usage()
+		os.Exit(1)
+	}
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	args = fs.Args()
+
+	if len(args) == 0 || !strings.Contains(args[0], ":") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	serverAddr := parseServerAddr(strings.TrimSuffix(args[0], "/"))
+	ids := args[1:]
+
+	switch command {
+	case "ls":
+		entries, err := getTrash(serverAddr, client)
+		if err != nil {
+			fatal("Failed to list trash", "error", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Trash is empty")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tDELETED\tREASON\tBY\tSIZE\tPATH")
+		for _, e := range entries {
+			name := e.Path
+			if e.IsDir {
+				name += "/"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.DeletedAt.Local().Format("2006-01-02 15:04:05"),
+				e.Reason, e.DeletedBy, formatSize(e.Size), name)
+		}
+		tw.Flush()
+
+	case "restore":
+		if len(ids) == 0 || (*to != "" && len(ids) > 1) {
+			fs.Usage()
+			os.Exit(1)
+		}
+		failed := false
+		for _, id := range ids {
+			err := postFileOp(serverAddr, "/api/trash/restore", map[string]interface{}{"id": id, "to": *to, "overwrite": *force}, client)
+			if err != nil {
+				slog.Error("Failed to restore", "id", id, "error", err)
+				failed = true
+				continue
+			}
+			slog.Info("Restored", "id", id)
+		}
+		if failed {
+			os.Exit(1)
+		}
+
+	case "purge":
+		if len(ids) == 0 && !*all {
+			fs.Usage()
+			os.Exit(1)
+		}
+		result, err := purgeTrash(serverAddr, ids, *all, client)
+		if err != nil {
+			fatal("Failed to purge trash", "error", err)
+		}
+		for _, f := range result.Failed {
+			slog.Error("Failed to purge", "id", f.ID, "error", f.Error)
+		}
+		if len(result.Failed) > 0 {
+			fatal("Some trash entries were not purged", "purged", len(result.Purged), "failed", len(result.Failed))
+		}
+		if *all {
+			slog.Info("Trash emptied")
+		} else {
+			slog.Info("Purged trash entries", "count", len(result.Purged))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// downloadVersion 由 -version-id 指定，下载文件的历史版本
+var downloadVersion string
+
+// FileVersion 文件的一个历史版本
+type FileVersion struct {
+	ID         string    `json:"id"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	Modified   time.Time `json:"modified"`
+	ArchivedAt time.Time `json:"archived_at"`
+	ArchivedBy string    `json:"archived_by"`
+}
+
+// FileVersions /versions/<path> 的响应
+type FileVersions struct {
+	Path       string `json:"path"`
+	Versioning bool   `json:"versioning"`
+	Current    *struct {
+		Size     int64     `json:"size"`
+		Modified time.Time `json:"modified"`
+	} `json:"current"`
+	Versions []FileVersion `json:"versions"`
+}
+
+// downloadURL 下载地址，指定了 -version-id 时下载该版本。文件名按路径转义，% ? # 等字符原样传给服务器
+func downloadURL(serverAddr, filename string) string {
+	u := fmt.Sprintf("%s/download/%s", serverAddr, (&url.URL{Path: filename}).EscapedPath())
+	if downloadVersion != "" {
+		u += "?version=" + url.QueryEscape(downloadVersion)
+	}
+	return u
+}
+
+// showVersions 列出文件的历史版本：ctrans versions server:port/path
+func showVersions(remote string, client *http.Client) {
+	serverAddr, filePath, err := splitRemote(remote)
+	if err != nil {
+		fatal("Invalid remote path", "error", err)
+	}
+
+	resp, err := client.Get(serverAddr + "/versions/" + (&url.URL{Path: filePath}).EscapedPath())
+	if err != nil {
+		fatal("Failed to list versions", "error", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		message, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+		fatal("Failed to list versions", "status", resp.Status, "error", message)
+	}
+
+	var result FileVersions
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fatal("Invalid server response", "error", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tMODIFIED\tREPLACED BY\tSIZE\tSHA256")
+	if result.Current != nil {
+		fmt.Fprintf(tw, "current\t%s\t\t%s\t\n", result.Current.Modified.Local().Format("2006-01-02 15:04:05"), formatSize(result.Current.Size))
+	}
+	for _, v := range result.Versions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.ID, v.Modified.Local().Format("2006-01-02 15:04:05"),
+			v.ArchivedBy, formatSize(v.Size), v.SHA256[:min(len(v.SHA256), 12)])
+	}
+	tw.Flush()
+	if !result.Versioning {
+		fmt.Println("\nVersioning is not enabled for this directory")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// stallTimeout 发送请求体或读取响应体时，超过该时间没有任何数据流动就中止请求
+	stallTimeout = 60 * time.Second
+	// responseHeaderTimeout 请求发送完毕后等待响应头的最长时间，服务器合并大文件需要一些时间
+	responseHeaderTimeout = 2 * time.Minute
+)
+
+var errStalled = fmt.Errorf("no data transferred for %s", stallTimeout)
+
+// watchdogTransport 代替整体超时：限速或大文件的传输可以持续很久，只要数据在流动就不中止。
+// 等待响应头的阶段由 Transport.ResponseHeaderTimeout 负责，此时看门狗暂停
+type watchdogTransport struct {
+	base http.RoundTripper
+	idle time.Duration
+}
+
+func (t *watchdogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(t.idle, func() { cancel(errStalled) })
+	timer.Stop()
+
+	req = req.WithContext(ctx)
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &watchedBody{ReadCloser: req.Body, ctx: ctx, timer: timer, idle: t.idle}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		timer.Stop()
+		if errors.Is(context.Cause(ctx), errStalled) {
+			err = errStalled
+		}
+		cancel(nil)
+		return nil, err
+	}
+
+	timer.Reset(t.idle)
+	resp.Body = &watchedBody{ReadCloser: resp.Body, ctx: ctx, timer: timer, idle: t.idle, cancel: cancel}
+	return resp, nil
+}
+
+// watchedBody 每次读到数据时重置看门狗；读完后暂停看门狗
+type watchedBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	timer  *time.Timer
+	idle   time.Duration
+	cancel context.CancelCauseFunc // 只有响应体设置，关闭时释放请求的 context
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.idle)
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.timer.Stop()
+		if errors.Is(context.Cause(b.ctx), errStalled) {
+			err = errStalled
+		}
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.cancel != nil {
+		b.timer.Stop()
+		b.cancel(nil)
+	}
+	return err
+}
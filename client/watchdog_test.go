@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		switch r.URL.Path {
+		case "/slow":
+			// 持续有数据，但总时间远超看门狗的空闲时间
+			for i := 0; i < 10; i++ {
+				io.WriteString(w, "x")
+				w.(http.Flusher).Flush()
+				time.Sleep(30 * time.Millisecond)
+			}
+		case "/stall":
+			io.WriteString(w, "x")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &watchdogTransport{base: http.DefaultTransport, idle: 100 * time.Millisecond}}
+
+	tests := []struct {
+		path    string
+		stalled bool
+	}{
+		{"/slow", false},
+		{"/stall", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := client.Post(srv.URL+tt.path, "text/plain", strings.NewReader("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+			if tt.stalled != errors.Is(err, errStalled) {
+				t.Errorf("read error = %v, want stalled %v", err, tt.stalled)
+			}
+		})
+	}
+}
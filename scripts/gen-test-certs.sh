@@ -0,0 +1,41 @@
+#!/bin/bash
+
+# 生成本地测试用的 CA、服务器证书和客户端证书，用于验证 mTLS 认证
+# 用法: ./scripts/gen-test-certs.sh [输出目录] [客户端 CN]
+
+set -e
+
+OUT_DIR=${1:-certs}
+CLIENT_CN=${2:-builder-01}
+DAYS=30
+
+mkdir -p "${OUT_DIR}"
+cd "${OUT_DIR}"
+
+echo "[INFO] 生成测试 CA..."
+openssl req -x509 -newkey rsa:2048 -nodes -days ${DAYS} \
+    -keyout ca.key -out ca.crt -subj "/CN=ctrans test CA" 2>/dev/null
+
+echo "[INFO] 生成服务器证书 (localhost)..."
+openssl req -newkey rsa:2048 -nodes -keyout server.key -out server.csr \
+    -subj "/CN=localhost" 2>/dev/null
+openssl x509 -req -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+    -days ${DAYS} -out server.crt \
+    -extfile <(printf "subjectAltName=DNS:localhost,IP:127.0.0.1\nextendedKeyUsage=serverAuth") 2>/dev/null
+
+echo "[INFO] 生成客户端证书 (CN=${CLIENT_CN})..."
+openssl req -newkey rsa:2048 -nodes -keyout client.key -out client.csr \
+    -subj "/CN=${CLIENT_CN}" 2>/dev/null
+openssl x509 -req -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+    -days ${DAYS} -out client.crt \
+    -extfile <(printf "subjectAltName=DNS:${CLIENT_CN}.farm.local\nextendedKeyUsage=clientAuth") 2>/dev/null
+
+rm -f server.csr client.csr ca.srl
+
+echo "[SUCCESS] 证书已生成到 ${OUT_DIR}/"
+echo ""
+echo "启动服务器:"
+echo "  ./ctrans-server -tls-cert ${OUT_DIR}/server.crt -tls-key ${OUT_DIR}/server.key -client-ca ${OUT_DIR}/ca.crt -config server.json"
+echo ""
+echo "使用客户端:"
+echo "  ./ctrans -ca ${OUT_DIR}/ca.crt -cert ${OUT_DIR}/client.crt -cert-key ${OUT_DIR}/client.key localhost:9000"
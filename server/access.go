@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipNetList 一组网段
+type ipNetList []*net.IPNet
+
+// parseCIDRs 解析 CIDR 列表，单个 IP 视为 /32 或 /128
+func parseCIDRs(list []string) (ipNetList, error) {
+	var nets ipNetList
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %s", s)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			s = fmt.Sprintf("%s/%d", s, bits)
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %s", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (l ipNetList) contains(ip net.IP) bool {
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessRule 编译后的访问规则
+type accessRule struct {
+	allow ipNetList
+	deny  ipNetList
+}
+
+func compileAccessRules(rules AccessRules) (accessRule, error) {
+	allow, err := parseCIDRs(rules.Allow)
+	if err != nil {
+		return accessRule{}, err
+	}
+	deny, err := parseCIDRs(rules.Deny)
+	if err != nil {
+		return accessRule{}, err
+	}
+	return accessRule{allow: allow, deny: deny}, nil
+}
+
+// permits deny 优先；allow 为空时允许所有未被拒绝的地址
+func (a accessRule) permits(ip net.IP) bool {
+	if ip == nil {
+		return len(a.allow) == 0 && len(a.deny) == 0
+	}
+	if a.deny.contains(ip) {
+		return false
+	}
+	return len(a.allow) == 0 || a.allow.contains(ip)
+}
+
+var (
+	trustedProxies ipNetList
+	globalAccess   accessRule
+	roleAccess     = make(map[string]accessRule)
+	lockoutPolicy  LockoutConfig
+)
+
+// initAccess 根据配置编译访问规则
+func initAccess(cfg *Config) error {
+	apply, err := prepareAccess(cfg)
+	if err != nil {
+		return err
+	}
+	apply()
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			pruneAuthFailures()
+		}
+	}()
+	return nil
+}
+
+// prepareAccess 编译访问规则，返回的函数在持有 configMutex 写锁时替换当前规则
+func prepareAccess(cfg *Config) (func(), error) {
+	proxies, err := parseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %v", err)
+	}
+	global, err := compileAccessRules(cfg.Access)
+	if err != nil {
+		return nil, fmt.Errorf("access: %v", err)
+	}
+	roles := make(map[string]accessRule)
+	for role, rules := range cfg.RoleAccess {
+		rule, err := compileAccessRules(rules)
+		if err != nil {
+			return nil, fmt.Errorf("role_access.%s: %v", role, err)
+		}
+		roles[role] = rule
+	}
+
+	metricsRules := cfg.MetricsAccess
+	if len(metricsRules.Allow) == 0 {
+		metricsRules.Allow = defaultMetricsAllow
+	}
+	metrics, err := compileAccessRules(metricsRules)
+	if err != nil {
+		return nil, fmt.Errorf("metrics_access: %v", err)
+	}
+
+	return func() {
+		trustedProxies = proxies
+		globalAccess = global
+		metricsAccess = metrics
+		roleAccess = roles
+		lockoutPolicy = cfg.Lockout
+	}, nil
+}
+
+// clientIP 返回请求方的真实 IP。
+// 只有直接连接方是受信任的代理时才解析 X-Forwarded-For，并从右向左跳过受信任的代理。
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	configMutex.RLock()
+	proxies := trustedProxies
+	configMutex.RUnlock()
+	if ip == nil || !proxies.contains(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !proxies.contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// accessMiddleware 全局 IP 访问控制
+func accessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		configMutex.RLock()
+		rule := globalAccess
+		configMutex.RUnlock()
+		if !rule.permits(clientIP(r)) {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rolePermits 检查角色的 IP 访问规则，未配置的角色不受限制
+func rolePermits(role string, ip net.IP) bool {
+	configMutex.RLock()
+	rule, exists := roleAccess[role]
+	configMutex.RUnlock()
+	return !exists || rule.permits(ip)
+}
+
+// 认证失败记录
+type failureRecord struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+var (
+	authFailures = make(map[string]*failureRecord)
+	failureMutex sync.Mutex
+)
+
+// currentLockout 返回当前的锁定策略
+func currentLockout() LockoutConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return lockoutPolicy
+}
+
+// lockedOut 返回该 IP 剩余的锁定时间
+func lockedOut(ip net.IP) (time.Duration, bool) {
+	if ip == nil || currentLockout().MaxFailures <= 0 {
+		return 0, false
+	}
+
+	failureMutex.Lock()
+	defer failureMutex.Unlock()
+
+	rec, exists := authFailures[ip.String()]
+	if !exists {
+		return 0, false
+	}
+	if remaining := time.Until(rec.lockedUntil); remaining > 0 {
+		return remaining, true
+	}
+	return 0, false
+}
+
+// recordAuthFailure 记录一次认证失败，超过阈值后锁定该 IP
+func recordAuthFailure(ip net.IP) {
+	authFailuresTotal.Inc()
+	policy := currentLockout()
+	if ip == nil || policy.MaxFailures <= 0 {
+		return
+	}
+
+	failureMutex.Lock()
+	defer failureMutex.Unlock()
+
+	now := time.Now()
+	rec, exists := authFailures[ip.String()]
+	if !exists || now.Sub(rec.first) > policy.Window.Duration {
+		rec = &failureRecord{first: now}
+		authFailures[ip.String()] = rec
+	}
+	rec.count++
+	if rec.count >= policy.MaxFailures {
+		rec.lockedUntil = now.Add(policy.Duration.Duration)
+		rec.count = 0
+		rec.first = now
+	}
+}
+
+// clearAuthFailures 认证成功后清除失败计数
+func clearAuthFailures(ip net.IP) {
+	if ip == nil {
+		return
+	}
+	failureMutex.Lock()
+	if rec, exists := authFailures[ip.String()]; exists && time.Now().After(rec.lockedUntil) {
+		delete(authFailures, ip.String())
+	}
+	failureMutex.Unlock()
+}
+
+// pruneAuthFailures 清理过期的失败记录
+func pruneAuthFailures() {
+	window := currentLockout().Window.Duration
+
+	failureMutex.Lock()
+	defer failureMutex.Unlock()
+
+	now := time.Now()
+	for ip, rec := range authFailures {
+		if now.After(rec.lockedUntil) && now.Sub(rec.first) > window {
+			delete(authFailures, ip)
+		}
+	}
+}
+
+// rejectLockedOut 如果该 IP 处于锁定状态，返回 429 并带上 Retry-After
+func rejectLockedOut(w http.ResponseWriter, r *http.Request) bool {
+	remaining, locked := lockedOut(clientIP(r))
+	if !locked {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+	http.Error(w, "Too many failed authentication attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// authFailed 记录认证失败并返回 401
+func authFailed(w http.ResponseWriter, r *http.Request, msg string) {
+	recordAuthFailure(clientIP(r))
+	http.Error(w, msg, http.StatusUnauthorized)
+}
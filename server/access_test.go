@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// applyAccess 按配置替换当前的访问规则，测试结束后恢复
+func applyAccess(t *testing.T, cfg *Config) {
+	t.Helper()
+	configMutex.Lock()
+	proxies, global, metrics, roles, lockout := trustedProxies, globalAccess, metricsAccess, roleAccess, lockoutPolicy
+	configMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		trustedProxies, globalAccess, metricsAccess, roleAccess, lockoutPolicy = proxies, global, metrics, roles, lockout
+		configMutex.Unlock()
+	})
+
+	apply, err := prepareAccess(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMutex.Lock()
+	apply()
+	configMutex.Unlock()
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := parseCIDRs([]string{"10.0.0.0/8", " 192.168.1.5 ", "", "2001:db8::1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.5/32", "2001:db8::1/128", "fd00::/8"}
+	if len(nets) != len(want) {
+		t.Fatalf("got %d networks, want %d", len(nets), len(want))
+	}
+	for i, n := range nets {
+		if n.String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, n, want[i])
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0/8", "::1/129"} {
+		if _, err := parseCIDRs([]string{bad}); err == nil {
+			t.Errorf("parseCIDRs(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAccessRulePermits(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules AccessRules
+		ip    string
+		want  bool
+	}{
+		{"no rules", AccessRules{}, "203.0.113.7", true},
+		{"no rules unknown address", AccessRules{}, "", true},
+		{"allowed", AccessRules{Allow: []string{"10.0.0.0/8"}}, "10.1.2.3", true},
+		{"not in allow list", AccessRules{Allow: []string{"10.0.0.0/8"}}, "192.168.1.1", false},
+		{"denied", AccessRules{Deny: []string{"10.9.0.0/16"}}, "10.9.1.1", false},
+		{"not denied", AccessRules{Deny: []string{"10.9.0.0/16"}}, "10.8.1.1", true},
+		{"deny wins over allow", AccessRules{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.9.0.0/16"}}, "10.9.1.1", false},
+		{"single address", AccessRules{Allow: []string{"192.168.1.5"}}, "192.168.1.5", true},
+		{"single address neighbour", AccessRules{Allow: []string{"192.168.1.5"}}, "192.168.1.6", false},
+		{"ipv6", AccessRules{Allow: []string{"2001:db8::/32"}}, "2001:db8::42", true},
+		{"ipv4 rule ipv6 client", AccessRules{Allow: []string{"10.0.0.0/8"}}, "2001:db8::42", false},
+		{"ipv4-mapped ipv6 client", AccessRules{Allow: []string{"10.0.0.0/8"}}, "::ffff:10.1.2.3", true},
+		{"unknown address with rules", AccessRules{Allow: []string{"10.0.0.0/8"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compileAccessRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.permits(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("permits(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolePermits(t *testing.T) {
+	applyAccess(t, &Config{RoleAccess: map[string]AccessRules{
+		roleAdmin:     {Allow: []string{"10.0.0.0/8"}},
+		roleReadWrite: {Deny: []string{"192.168.0.0/16"}},
+	}})
+
+	tests := []struct {
+		role string
+		ip   string
+		want bool
+	}{
+		{roleAdmin, "10.1.1.1", true},
+		{roleAdmin, "192.168.1.1", false},
+		{roleReadWrite, "192.168.1.1", false},
+		{roleReadWrite, "172.16.0.1", true},
+		{roleReadOnly, "192.168.1.1", true}, // 未配置的角色不受限制
+	}
+	for _, tt := range tests {
+		if got := rolePermits(tt.role, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("rolePermits(%s, %s) = %v, want %v", tt.role, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	applyAccess(t, &Config{TrustedProxies: []string{"10.0.0.1", "172.16.0.0/12"}})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer ignores header", "203.0.113.7:5000", []string{"1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", []string{"198.51.100.9"}, "198.51.100.9"},
+		{"trusted proxy without header", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"spoofed leftmost hop", "10.0.0.1:5000", []string{"1.2.3.4, 198.51.100.9"}, "198.51.100.9"},
+		{"chain of trusted proxies", "10.0.0.1:5000", []string{"198.51.100.9, 172.16.5.5, 172.20.0.1"}, "198.51.100.9"},
+		{"multiple headers", "10.0.0.1:5000", []string{"1.2.3.4", "198.51.100.9, 172.16.5.5"}, "198.51.100.9"},
+		{"garbage hop stops parsing", "10.0.0.1:5000", []string{"198.51.100.9, garbage, 172.16.5.5"}, "172.16.5.5"},
+		{"all hops trusted", "10.0.0.1:5000", []string{"172.16.5.5"}, "172.16.5.5"},
+		{"ipv6 peer", "[2001:db8::1]:5000", []string{"1.2.3.4"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(req); got.String() != tt.want {
+				t.Errorf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockout(t *testing.T) {
+	applyAccess(t, &Config{Lockout: LockoutConfig{
+		MaxFailures: 3,
+		Window:      Duration{time.Minute},
+		Duration:    Duration{time.Minute},
+	}})
+	ip := net.ParseIP("198.51.100.20")
+	other := net.ParseIP("198.51.100.21")
+	t.Cleanup(func() {
+		failureMutex.Lock()
+		delete(authFailures, ip.String())
+		delete(authFailures, other.String())
+		failureMutex.Unlock()
+	})
+
+	// 成功认证清除之前的失败计数
+	recordAuthFailure(ip)
+	recordAuthFailure(ip)
+	clearAuthFailures(ip)
+	recordAuthFailure(ip)
+	recordAuthFailure(ip)
+	if _, locked := lockedOut(ip); locked {
+		t.Fatal("locked out before reaching the failure limit")
+	}
+
+	recordAuthFailure(ip)
+	remaining, locked := lockedOut(ip)
+	if !locked || remaining <= 0 || remaining > time.Minute {
+		t.Fatalf("lockedOut = %v, %v, want locked for up to a minute", remaining, locked)
+	}
+	if _, locked := lockedOut(other); locked {
+		t.Error("lockout applied to another address")
+	}
+
+	// 锁定期间成功认证也不能解除锁定
+	clearAuthFailures(ip)
+	if _, locked := lockedOut(ip); !locked {
+		t.Error("successful authentication lifted the lockout")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = ip.String() + ":5000"
+	rec := httptest.NewRecorder()
+	if !rejectLockedOut(rec, req) || rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("locked out request got status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// 锁定到期后恢复
+	failureMutex.Lock()
+	authFailures[ip.String()].lockedUntil = time.Now().Add(-time.Second)
+	failureMutex.Unlock()
+	if _, locked := lockedOut(ip); locked {
+		t.Error("still locked out after the lockout expired")
+	}
+
+	// 窗口期之外的失败不累计
+	failureMutex.Lock()
+	authFailures[other.String()] = &failureRecord{count: 2, first: time.Now().Add(-2 * time.Minute)}
+	failureMutex.Unlock()
+	recordAuthFailure(other)
+	if _, locked := lockedOut(other); locked {
+		t.Error("failures outside the window were counted")
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	applyAccess(t, &Config{})
+	ip := net.ParseIP("198.51.100.30")
+	for i := 0; i < 100; i++ {
+		recordAuthFailure(ip)
+	}
+	if _, locked := lockedOut(ip); locked {
+		t.Error("locked out with max_failures 0")
+	}
+}
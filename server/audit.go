@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	File       string   `json:"file"`        // 审计日志文件，为空表示不记录
+	MaxSize    int64    `json:"max_size_mb"` // 超过该大小（MB）后轮转，0 表示不按大小轮转
+	MaxAge     Duration `json:"max_age"`     // 当前文件写入超过该时长后轮转，0 表示不按时间轮转
+	MaxBackups int      `json:"max_backups"` // 保留的历史文件数量，0 表示全部保留
+}
+
+// AuditEntry 审计日志中的一条记录（JSON Lines，每行一条）
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	IP         string    `json:"ip"`
+	Identity   string    `json:"identity,omitempty"`
+	Action     string    `json:"action"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path,omitempty"`     // 涉及的文件或目录（相对上传目录）
+	Size       int64     `json:"size,omitempty"`     // 文件大小
+	Checksum   string    `json:"checksum,omitempty"` // 上传完成后的 SHA-256
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	Status     int       `json:"status"`
+	Result     string    `json:"result"` // ok、denied 或 error
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// auditLogger 只追加写入的审计日志，按大小和时间轮转
+type auditLogger struct {
+	mu       sync.Mutex
+	cfg      AuditConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+var auditLog *auditLogger // nil 表示未启用审计日志
+
+// initAudit 打开审计日志文件
+func initAudit(cfg AuditConfig) error {
+	if cfg.File == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.File), 0755); err != nil {
+		return err
+	}
+	logger := &auditLogger{cfg: cfg}
+	if err := logger.open(); err != nil {
+		return err
+	}
+	auditLog = logger
+	return nil
+}
+
+func (l *auditLogger) open() error {
+	file, err := os.OpenFile(l.cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	l.openedAt = time.Now()
+	if info.Size() > 0 {
+		l.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// rotate 将当前文件改名为 <名称>-<时间>.jsonl 并打开新文件
+func (l *auditLogger) rotate() error {
+	l.file.Close()
+
+	ext := filepath.Ext(l.cfg.File)
+	base := strings.TrimSuffix(l.cfg.File, ext)
+	stamp := time.Now().Format("20060102-150405")
+	// 同一秒内已有轮转文件时序号接在最大的序号之后，保留数量清理掉前面的文件后也不会重用
+	rotated := fmt.Sprintf("%s-%s%s", base, stamp, ext)
+	seq := -1
+	for _, backup := range auditBackups(l.cfg.File) {
+		if s, n := auditBackupKey(l.cfg.File, backup); s == stamp {
+			seq = max(seq, n)
+		}
+	}
+	if seq >= 0 {
+		rotated = fmt.Sprintf("%s-%s.%d%s", base, stamp, seq+1, ext)
+	}
+	if err := os.Rename(l.cfg.File, rotated); err != nil {
+		slog.Error("Failed to rotate audit log", "error", err)
+	}
+
+	if l.cfg.MaxBackups > 0 {
+		backups := auditBackups(l.cfg.File)
+		for len(backups) > l.cfg.MaxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return l.open()
+}
+
+func (l *auditLogger) write(entry *AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tooBig := l.cfg.MaxSize > 0 && l.size+int64(len(line)) > l.cfg.MaxSize<<20
+	tooOld := l.cfg.MaxAge.Duration > 0 && time.Since(l.openedAt) > l.cfg.MaxAge.Duration
+	if l.size > 0 && (tooBig || tooOld) {
+		if err := l.rotate(); err != nil {
+			slog.Error("Failed to reopen audit log", "error", err)
+			return
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		slog.Error("Failed to write audit log", "error", err)
+	}
+}
+
+// close 退出前同步并关闭日志文件
+func (l *auditLogger) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.Sync()
+	l.file.Close()
+}
+
+// auditBackups 按时间顺序返回轮转后的历史文件。同一秒内轮转的文件带有序号（<名称>-<时间>.<序号>.jsonl），
+// 按时间和序号的数值排序，不能直接按文件名排序（.10 会排在 .2 之前）
+func auditBackups(path string) []string {
+	ext := filepath.Ext(path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext)
+	sort.Slice(matches, func(i, j int) bool {
+		si, ni := auditBackupKey(path, matches[i])
+		sj, nj := auditBackupKey(path, matches[j])
+		if si != sj {
+			return si < sj
+		}
+		return ni < nj
+	})
+	return matches
+}
+
+// auditBackupKey 返回轮转文件名中的时间和序号，没有序号时为 0
+func auditBackupKey(path, backup string) (string, int) {
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(strings.TrimPrefix(backup, strings.TrimSuffix(path, ext)+"-"), ext)
+	stamp, seq, _ := strings.Cut(name, ".")
+	n, _ := strconv.Atoi(seq)
+	return stamp, n
+}
+
+type auditKey struct{}
+
+// auditFrom 返回当前请求的审计记录，供处理函数补充路径、大小等信息；未启用时返回 nil
+func auditFrom(r *http.Request) *AuditEntry {
+	entry, _ := r.Context().Value(auditKey{}).(*AuditEntry)
+	return entry
+}
+
+// setAuditFile 记录请求涉及的文件
+func setAuditFile(r *http.Request, path string, size int64) {
+	if entry := auditFrom(r); entry != nil {
+		entry.Path = path
+		entry.Size = size
+	}
+}
+
+// uploadRelPath 将上传目录下的完整路径转换为相对路径
+func uploadRelPath(full string) string {
+	rel, err := filepath.Rel(uploadDir, full)
+	if err != nil {
+		return full
+	}
+	return filepath.ToSlash(rel)
+}
+
+// countingReader 统计读取的请求体字节数
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// auditResponseWriter 记录状态码、响应字节数和错误信息
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+	errBody []byte
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && len(w.errBody) < 200 {
+		w.errBody = append(w.errBody, b...)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// audited 中间件：请求结束后写入一条审计记录
+func audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auditLog == nil {
+			next(w, r)
+			return
+		}
+
+		start := time.Now()
+		ip := r.RemoteAddr
+		if parsed := clientIP(r); parsed != nil {
+			ip = parsed.String()
+		}
+		entry := &AuditEntry{
+			Time:      start,
+			RequestID: requestFrom(r).ID,
+			IP:        ip,
+			Action:    action,
+			Method:    r.Method,
+		}
+		if r.Body != nil {
+			r.Body = countingReader{r.Body, &entry.BytesIn}
+		}
+		rw := &auditResponseWriter{ResponseWriter: w}
+
+		next(rw, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+
+		entry.Status = rw.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.BytesOut = rw.written
+		entry.DurationMs = time.Since(start).Milliseconds()
+		switch {
+		case entry.Status < 400:
+			entry.Result = "ok"
+		case entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden || entry.Status == http.StatusTooManyRequests:
+			entry.Result = "denied"
+		default:
+			entry.Result = "error"
+		}
+		if entry.Status >= 400 {
+			msg := strings.TrimSpace(string(rw.errBody))
+			if len(msg) > 200 {
+				msg = msg[:200]
+			}
+			entry.Error = msg
+		}
+		auditLog.write(entry)
+	}
+}
+
+// auditFilter audit 子命令的查询条件，空值表示不限
+type auditFilter struct {
+	from, to                           time.Time
+	identity, ip, action, path, result string // identity 和 path 按子串匹配
+}
+
+func (f *auditFilter) match(e *AuditEntry) bool {
+	return (f.from.IsZero() || !e.Time.Before(f.from)) && (f.to.IsZero() || !e.Time.After(f.to)) &&
+		(f.identity == "" || strings.Contains(e.Identity, f.identity)) &&
+		(f.ip == "" || e.IP == f.ip) &&
+		(f.action == "" || e.Action == f.action) &&
+		(f.path == "" || strings.Contains(e.Path, f.path)) &&
+		(f.result == "" || e.Result == f.result)
+}
+
+// queryAudit 按时间顺序读取审计日志（含轮转后的文件）中满足条件的记录，limit > 0 时只返回最后 limit 条
+func queryAudit(file string, filter *auditFilter, limit int) ([]AuditEntry, error) {
+	var matched []AuditEntry
+	for _, path := range append(auditBackups(file), file) {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || !filter.match(&e) {
+				continue
+			}
+			matched = append(matched, e)
+		}
+		f.Close()
+	}
+
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+	return matched, nil
+}
+
+// runAuditCommand 处理 "ctrans-server audit" 子命令：按条件查询审计日志
+func runAuditCommand(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	file := fs.String("file", filepath.Join(dataDir, "audit.jsonl"), "Audit log file (rotated files are included)")
+	since := fs.String("since", "", "Only entries after this time (RFC 3339, date, or duration such as 24h)")
+	until := fs.String("until", "", "Only entries before this time (RFC 3339, date, or duration)")
+	identity := fs.String("identity", "", "Only entries for this identity (substring match)")
+	ip := fs.String("ip", "", "Only entries from this client IP")
+	action := fs.String("action", "", "Only entries with this action, e.g. download or upload_complete")
+	pathFilter := fs.String("path", "", "Only entries whose path contains this string")
+	result := fs.String("result", "", "Only entries with this result: ok, denied or error")
+	limit := fs.Int("limit", 0, "Show only the last N matching entries")
+	asJSON := fs.Bool("json", false, "Print matching entries as JSON lines")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s audit [options]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	filter := &auditFilter{identity: *identity, ip: *ip, action: *action, path: *pathFilter, result: *result}
+	var err error
+	if *since != "" {
+		if filter.from, err = parseTimeArg(*since); err != nil {
+			fatal("Invalid -since", "error", err)
+		}
+	}
+	if *until != "" {
+		if filter.to, err = parseTimeArg(*until); err != nil {
+			fatal("Invalid -until", "error", err)
+		}
+	}
+
+	matched, err := queryAudit(*file, filter, *limit)
+	if err != nil {
+		fatal("Failed to read audit log", "error", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for i := range matched {
+			enc.Encode(&matched[i])
+		}
+		return
+	}
+
+	for _, e := range matched {
+		name := e.Identity
+		if name == "" {
+			name = "-"
+		}
+		fmt.Printf("%s  %-15s  %-20s  %-16s  %-6s  %3d  %10s  %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.IP, name, e.Action, e.Result, e.Status,
+			formatAuditSize(e), e.Path)
+	}
+}
+
+// formatAuditSize 显示文件大小，没有文件大小时显示实际传输量
+func formatAuditSize(e AuditEntry) string {
+	size := e.Size
+	if size == 0 {
+		size = e.BytesIn + e.BytesOut
+	}
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
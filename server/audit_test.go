@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAudit 启用审计日志，测试结束后关闭
+func useAudit(t *testing.T, cfg AuditConfig) {
+	t.Helper()
+	if err := initAudit(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		auditLog.close()
+		auditLog = nil
+	})
+}
+
+// readAudit 读取审计日志文件中的所有记录
+func readAudit(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	entries, err := queryAudit(path, &auditFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestAuditBackupsNumericOrder(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"audit-20240102-000000.jsonl",
+		"audit-20240101-120000.10.jsonl",
+		"audit-20240101-120000.2.jsonl",
+		"audit-20240101-120000.jsonl",
+		"audit-20240101-120000.1.jsonl",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for _, p := range auditBackups(filepath.Join(dir, "audit.jsonl")) {
+		got = append(got, filepath.Base(p))
+	}
+	want := []string{
+		"audit-20240101-120000.jsonl",
+		"audit-20240101-120000.1.jsonl",
+		"audit-20240101-120000.2.jsonl",
+		"audit-20240101-120000.10.jsonl",
+		"audit-20240102-000000.jsonl",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("auditBackups = %v, want %v", got, want)
+	}
+}
+
+func TestAuditRotationKeepsNewestBackups(t *testing.T) {
+	chdirTemp(t)
+	file := filepath.Join(dataDir, "audit.jsonl")
+	// 每条记录写入后都已超过 max_age，下一条写入前轮转；同一秒内的轮转文件带序号
+	useAudit(t, AuditConfig{File: file, MaxAge: Duration{time.Nanosecond}, MaxBackups: 2})
+	for _, action := range []string{"a0", "a1", "a2", "a3", "a4"} {
+		auditLog.write(&AuditEntry{Time: time.Now(), Action: action})
+		time.Sleep(time.Millisecond)
+	}
+
+	backups := auditBackups(file)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2 files", backups)
+	}
+	var got []string
+	for _, e := range readAudit(t, file) {
+		got = append(got, e.Action)
+	}
+	if strings.Join(got, ",") != "a2,a3,a4" {
+		t.Errorf("entries after retention = %v, want the newest backups a2,a3 and current a4", got)
+	}
+}
+
+func TestAuditRecordFields(t *testing.T) {
+	chdirTemp(t)
+	file := filepath.Join(dataDir, "audit.jsonl")
+	useAudit(t, AuditConfig{File: file})
+
+	handler := audited("upload_complete", func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		setRequestIdentity(r, "user:alice")
+		setAuditFile(r, "builds/app.tar.gz", 42)
+		auditFrom(r).Checksum = "5891b5"
+		http.Error(w, "disk full", http.StatusInternalServerError)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/upload/complete/abc", strings.NewReader("hello"))
+	req.RemoteAddr = "10.0.0.7:40000"
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	entries := readAudit(t, file)
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v, want 1", entries)
+	}
+	e := entries[0]
+	if e.Action != "upload_complete" || e.Method != http.MethodPost || e.IP != "10.0.0.7" || e.Identity != "user:alice" {
+		t.Errorf("request fields = %+v", e)
+	}
+	if e.Path != "builds/app.tar.gz" || e.Size != 42 || e.Checksum != "5891b5" {
+		t.Errorf("file fields = %+v", e)
+	}
+	if e.BytesIn != 5 || e.BytesOut != int64(rec.Body.Len()) {
+		t.Errorf("bytes in/out = %d/%d, want 5/%d", e.BytesIn, e.BytesOut, rec.Body.Len())
+	}
+	if e.Status != http.StatusInternalServerError || e.Result != "error" || e.Error != "disk full" {
+		t.Errorf("result fields = %+v", e)
+	}
+}
+
+func TestAuditAllRoutes(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	setServiceKey(t, "secret")
+	file := filepath.Join(dataDir, "audit.jsonl")
+	useAudit(t, AuditConfig{File: file})
+	srv := newTestServer(t)
+
+	get := func(path, key string) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if key != "" {
+			req.Header.Set(authHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	get("/download/missing.txt", "secret")
+	get("/download/missing.txt", "")
+	get("/healthz", "")
+	get("/session", "")
+
+	entries := readAudit(t, file)
+	want := []struct {
+		action, identity, result string
+		status                   int
+	}{
+		{"download", "service-key", "error", http.StatusNotFound},
+		{"download", "", "denied", http.StatusUnauthorized},
+		{"healthz", "", "ok", http.StatusOK},
+		{"session", "", "ok", http.StatusOK},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %d", entries, len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Action != w.action || e.Identity != w.identity || e.Result != w.result || e.Status != w.status || e.RequestID == "" {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestQueryAudit(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "audit.jsonl")
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	write := func(path string, entries ...AuditEntry) {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, e := range entries {
+			json.NewEncoder(f).Encode(e)
+		}
+		f.WriteString("not json\n")
+	}
+	write(filepath.Join(dir, "audit-20240601-120000.jsonl"),
+		AuditEntry{Time: base, IP: "10.0.0.1", Identity: "user:alice", Action: "upload_complete", Path: "builds/a.tar", Result: "ok"},
+		AuditEntry{Time: base.Add(time.Hour), IP: "10.0.0.2", Identity: "token:ci", Action: "download", Path: "builds/a.tar", Result: "denied"})
+	write(file,
+		AuditEntry{Time: base.Add(2 * time.Hour), IP: "10.0.0.1", Identity: "user:alice", Action: "download", Path: "docs/b.md", Result: "ok"},
+		AuditEntry{Time: base.Add(3 * time.Hour), IP: "10.0.0.1", Identity: "user:bob", Action: "delete", Path: "builds/a.tar", Result: "error"})
+
+	tests := []struct {
+		name   string
+		filter auditFilter
+		limit  int
+		want   string
+	}{
+		{"all files in order", auditFilter{}, 0, "upload_complete,download,download,delete"},
+		{"identity substring", auditFilter{identity: "alice"}, 0, "upload_complete,download"},
+		{"ip", auditFilter{ip: "10.0.0.2"}, 0, "download"},
+		{"action", auditFilter{action: "download"}, 0, "download,download"},
+		{"path substring", auditFilter{path: "builds/"}, 0, "upload_complete,download,delete"},
+		{"result", auditFilter{result: "denied"}, 0, "download"},
+		{"time range", auditFilter{from: base.Add(time.Hour), to: base.Add(2 * time.Hour)}, 0, "download,download"},
+		{"last n", auditFilter{identity: "user:"}, 2, "download,delete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := queryAudit(file, &tt.filter, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Action)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
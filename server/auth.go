@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Identity 表示请求方身份
+type Identity struct {
+	Name  string
+	Role  string
+	Token *UploadToken // 仅上传令牌身份有值
+
+	userHash string // 用户文件身份认证时的密码哈希，用户文件重新加载后据此判断会话是否仍然有效
+}
+
+const (
+	roleAdmin     = "admin"     // 服务密钥持有者，拥有全部权限
+	roleReadWrite = "readwrite" // 可以上传、下载和列出文件
+	roleReadOnly  = "readonly"  // 只能下载和列出文件
+	roleUpload    = "upload"    // 上传令牌，只能上传到绑定目录
+)
+
+// validRole 判断角色名是否有效
+func validRole(role string) bool {
+	switch role {
+	case roleAdmin, roleReadWrite, roleReadOnly, roleUpload:
+		return true
+	}
+	return false
+}
+
+// canWrite 是否允许上传
+func (id *Identity) canWrite() bool {
+	return id.Role == roleAdmin || id.Role == roleReadWrite || id.Role == roleUpload
+}
+
+// authEnabled 是否启用了任一认证方式；都未启用时所有请求视为匿名管理员
+func authEnabled() bool {
+	configMutex.RLock()
+	keySet := serviceKey != ""
+	configMutex.RUnlock()
+	return keySet || clientCertAuth || usersEnabled() || oidcEnabled()
+}
+
+// rejectCrossSite 浏览器会自动携带证书和 Basic 凭据，拒绝跨站发起的写请求
+func rejectCrossSite(w http.ResponseWriter, r *http.Request) bool {
+	if checkCSRF(r, nil) || r.Header.Get("Sec-Fetch-Site") != "cross-site" {
+		return false
+	}
+	http.Error(w, "Cross-site request rejected", http.StatusForbidden)
+	return true
+}
+
+// challenge 返回 401；启用用户文件时附带 Basic 认证质询，
+// 网页界面的脚本请求（带 X-Requested-With）除外，以免弹出浏览器原生登录框
+func challenge(w http.ResponseWriter, r *http.Request, msg string) {
+	if usersEnabled() && r.Header.Get("X-Requested-With") == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ctrans", charset="UTF-8"`)
+	}
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+type identityKey struct{}
+
+// withIdentity 将身份信息写入请求上下文
+func withIdentity(r *http.Request, id *Identity) *http.Request {
+	setRequestIdentity(r, id.Name)
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("ctrans.identity", id.Name),
+		attribute.String("ctrans.role", id.Role),
+	)
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+// identityFrom 从请求上下文中取出身份信息
+func identityFrom(r *http.Request) *Identity {
+	if id, ok := r.Context().Value(identityKey{}).(*Identity); ok {
+		return id
+	}
+	return &Identity{Name: "anonymous", Role: roleAdmin}
+}
+
+// validServiceKey 以常量时间比较服务密钥；未设置服务密钥时总是返回 false
+func validServiceKey(key string) bool {
+	configMutex.RLock()
+	expected := serviceKey
+	configMutex.RUnlock()
+	return expected != "" && subtle.ConstantTimeCompare([]byte(key), []byte(expected)) == 1
+}
+
+// grant 检查角色的 IP 访问规则，通过后携带身份继续处理
+func grant(w http.ResponseWriter, r *http.Request, id *Identity, next http.HandlerFunc) {
+	if !rolePermits(id.Role, clientIP(r)) {
+		http.Error(w, "Access denied for this role from your address", http.StatusForbidden)
+		return
+	}
+	next(w, withIdentity(r, id))
+}
+
+// 中间件：依次尝试服务密钥、网页会话和客户端证书
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 如果未启用任何认证方式，跳过验证
+		if !authEnabled() {
+			grant(w, r, &Identity{Name: "anonymous", Role: roleAdmin}, next)
+			return
+		}
+
+		// 被锁定的 IP 直接拒绝
+		if rejectLockedOut(w, r) {
+			return
+		}
+
+		// 获取请求头中的服务密钥
+		if key := r.Header.Get(authHeader); key != "" {
+			if !validServiceKey(key) {
+				authFailed(w, r, "Invalid service key")
+				return
+			}
+			clearAuthFailures(clientIP(r))
+			grant(w, r, &Identity{Name: "service-key", Role: roleAdmin}, next)
+			return
+		}
+
+		// HTTP Basic 认证（用户文件）
+		if name, password, ok := r.BasicAuth(); ok {
+			id, valid := checkUserPassword(name, password)
+			if !valid {
+				recordAuthFailure(clientIP(r))
+				challenge(w, r, "Invalid username or password")
+				return
+			}
+			if rejectCrossSite(w, r) {
+				return
+			}
+			clearAuthFailures(clientIP(r))
+			grant(w, r, id, next)
+			return
+		}
+
+		// 网页会话：改变状态的请求必须携带 CSRF 令牌
+		if sess := sessionFromRequest(r); sess != nil {
+			if !checkCSRF(r, sess) {
+				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			grant(w, r, sess.Identity, next)
+			return
+		}
+
+		// 客户端证书（mTLS）
+		id, err := certIdentity(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if id != nil {
+			if rejectCrossSite(w, r) {
+				return
+			}
+			grant(w, r, id, next)
+			return
+		}
+
+		challenge(w, r, "Authentication required")
+	}
+}
+
+// 中间件：上传接口既接受有写权限的身份，也接受上传令牌
+func uploadAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return withUploadToken(next, authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if !identityFrom(r).canWrite() {
+			http.Error(w, "Write permission required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}))
+}
+
+// 中间件：服务器信息接口接受所有身份，包括上传令牌（客户端传输前都会先查询）
+func infoAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return withUploadToken(next, authMiddleware(next))
+}
+
+// withUploadToken 请求携带上传令牌时以令牌身份交给 next，否则交给 fallback
+func withUploadToken(next, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(tokenHeader)
+		if value == "" {
+			value = r.URL.Query().Get("token")
+		}
+		if value == "" {
+			fallback(w, r)
+			return
+		}
+
+		if rejectLockedOut(w, r) {
+			return
+		}
+
+		token, err := lookupToken(value)
+		if err != nil {
+			authFailed(w, r, err.Error())
+			return
+		}
+
+		grant(w, r, &Identity{
+			Name:  token.displayName(),
+			Role:  roleUpload,
+			Token: token,
+		}, next)
+	}
+}
+
+// 中间件：仅允许管理员访问
+func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if identityFrom(r).Role != roleAdmin {
+			http.Error(w, "Admin privileges required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration 在 JSON 中以字符串表示的时间间隔，例如 "15m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// ByteSize 在 JSON 中可以写成字节数或带单位的字符串，例如 "50MB"、"1.5GB"（按 1024 换算）
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("size must be a number or a string like \"50MB\"")
+	}
+	v, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(v)
+	return nil
+}
+
+// parseByteSize 解析 "512KB"、"50MB"、"1.5G" 等大小，不带单位时为字节
+func parseByteSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	units := []struct {
+		suffix string
+		mult   float64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}}
+	mult := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return int64(v * mult), nil
+}
+
+// parseTimeArg 解析搜索和审计日志查询中的时间：RFC 3339 时间、日期（2006-01-02，本地时区）
+// 或相对现在的时长（如 24h 表示 24 小时前）
+func parseTimeArg(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339, YYYY-MM-DD or a duration such as 24h", s)
+}
+
+// AccessRules IP 访问规则，支持 CIDR 或单个 IP；deny 优先于 allow，allow 为空表示允许所有
+type AccessRules struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// LockoutConfig 认证失败锁定策略
+type LockoutConfig struct {
+	MaxFailures int      `json:"max_failures"` // 窗口期内允许的失败次数，0 表示不限制
+	Window      Duration `json:"window"`       // 统计窗口
+	Duration    Duration `json:"duration"`     // 锁定时长
+}
+
+// Config 服务器配置，可由 -config 指定的 JSON 文件提供，命令行参数优先
+type Config struct {
+	Host           string                 `json:"host"`
+	Port           string                 `json:"port"`
+	Key            string                 `json:"key"`
+	SessionTTL     Duration               `json:"session_ttl"`
+	TrustedProxies []string               `json:"trusted_proxies"` // 允许设置 X-Forwarded-For 的反向代理
+	Access         AccessRules            `json:"access"`          // 全局 IP 访问规则
+	RoleAccess     map[string]AccessRules `json:"role_access"`     // 按角色的 IP 访问规则
+	Lockout        LockoutConfig          `json:"lockout"`
+	MetricsAccess  AccessRules            `json:"metrics_access"` // /metrics 的 IP 访问规则，allow 为空时只允许本机
+	UsersFile      string                 `json:"users_file"`     // htpasswd 格式的用户文件（bcrypt），修改后自动重新加载
+
+	// TLS 与客户端证书认证
+	TLSCert           string        `json:"tls_cert"`
+	TLSKey            string        `json:"tls_key"`
+	ClientCA          string        `json:"client_ca"`           // 客户端证书 CA（PEM，可包含多个）
+	RequireClientCert bool          `json:"require_client_cert"` // 强制要求客户端证书
+	ClientCerts       []CertMapping `json:"client_certs"`        // 证书到身份/角色的映射，按顺序匹配
+
+	// 网页 OIDC 单点登录
+	OIDC *OIDCConfig `json:"oidc"`
+
+	// 审计日志
+	Audit AuditConfig `json:"audit"`
+
+	// OpenTelemetry 链路追踪
+	Tracing TracingConfig `json:"tracing"`
+
+	// 日志
+	LogFormat string `json:"log_format"` // text 或 json
+	LogLevel  string `json:"log_level"`  // debug、info、warn、error
+	AccessLog string `json:"access_log"` // nginx combined 格式的访问日志，"-" 为标准输出，空字符串关闭
+
+	ShutdownTimeout Duration `json:"shutdown_timeout"` // 退出时等待进行中传输的最长时间
+
+	MinFreeSpaceMB int64 `json:"min_free_space_mb"` // 上传后磁盘至少保留的剩余空间（MB）
+	ReadOnly       bool  `json:"read_only"`         // 只读维护模式：拒绝上传，下载和列表不受影响
+
+	// 准入控制与带宽限制
+	Limits LimitsConfig `json:"limits"`
+
+	// 回收站
+	Trash TrashConfig `json:"trash"`
+
+	// 按目录保留被覆盖文件的历史版本
+	Versioning []VersionRule `json:"versioning"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Port:            "8080",
+		LogFormat:       "text",
+		LogLevel:        "info",
+		AccessLog:       "-",
+		SessionTTL:      Duration{8 * time.Hour},
+		ShutdownTimeout: Duration{30 * time.Second},
+		MinFreeSpaceMB:  1024,
+		Limits: LimitsConfig{
+			SessionIdle: Duration{time.Hour},
+		},
+		Trash: TrashConfig{
+			Enabled:   true,
+			Retention: Duration{7 * 24 * time.Hour},
+		},
+		Lockout: LockoutConfig{
+			MaxFailures: 10,
+			Window:      Duration{5 * time.Minute},
+			Duration:    Duration{15 * time.Minute},
+		},
+		Audit: AuditConfig{
+			File:       filepath.Join(dataDir, "audit.jsonl"),
+			MaxSize:    100,
+			MaxAge:     Duration{24 * time.Hour},
+			MaxBackups: 30,
+		},
+	}
+}
+
+// validate 检查无法在解析时发现的错误
+func (cfg *Config) validate() error {
+	if cfg.MinFreeSpaceMB < 0 {
+		return fmt.Errorf("min_free_space_mb must not be negative")
+	}
+	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+		return err
+	}
+	if cfg.Trash.Retention.Duration < 0 {
+		return fmt.Errorf("trash.retention must not be negative")
+	}
+	if err := validateVersionRules(cfg.Versioning); err != nil {
+		return err
+	}
+	return cfg.Limits.validate()
+}
+
+// loadConfig 读取配置文件；path 为空时返回默认配置
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extensionTypes 补充系统 MIME 表中经常缺少的类型，不同系统上的 /etc/mime.types 差别很大
+var extensionTypes = map[string]string{
+	".log":  "text/plain; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".out":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".yaml": "text/yaml; charset=utf-8",
+	".yml":  "text/yaml; charset=utf-8",
+	".toml": "text/plain; charset=utf-8",
+	".ini":  "text/plain; charset=utf-8",
+	".conf": "text/plain; charset=utf-8",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+}
+
+// typeByExtension 按文件名的扩展名判断类型，未知时返回空字符串
+func typeByExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ct, ok := extensionTypes[ext]; ok {
+		return ct
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// sniffContentType 按文件开头 512 字节判断类型
+func sniffContentType(fullPath string) string {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+	buf := make([]byte, 512)
+	n, _ := file.Read(buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// detectContentType 按扩展名判断文件类型，未知扩展名时按内容判断
+func detectContentType(fullPath string) string {
+	if ct := typeByExtension(fullPath); ct != "" {
+		return ct
+	}
+	return sniffContentType(fullPath)
+}
+
+// inlineContentType 返回在浏览器中直接打开时使用的类型和是否需要沙箱，不适合直接打开的类型返回空字符串。
+// 文本（包括 HTML、脚本）一律按纯文本显示，上传的网页不会以本站的身份执行
+func inlineContentType(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "application/xml",
+		mediaType == "application/javascript", mediaType == "application/x-sh":
+		charset := params["charset"]
+		if charset == "" {
+			charset = "utf-8"
+		}
+		return "text/plain; charset=" + charset, false
+	case mediaType == "image/svg+xml":
+		// SVG 可以包含脚本，放在沙箱中显示
+		return contentType, true
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"), mediaType == "application/pdf":
+		return contentType, false
+	}
+	return "", false
+}
+
+// contentDisposition 按 RFC 6266 生成 Content-Disposition：filename 为只含 ASCII 的回退名，
+// 原名含有其他字符时另外用 filename*（RFC 5987）给出 UTF-8 编码的原名
+func contentDisposition(disposition, name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, name)
+	value := fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback)
+	if fallback != name {
+		value += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return value
+}
+
+// encodeRFC5987 按 RFC 5987 的 attr-char 对 UTF-8 字节做百分号编码
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
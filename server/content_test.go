@@ -0,0 +1,135 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeRFC5987(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"report.txt", "report.txt"},
+		{"a b&c", "a%20b&c"},
+		{`say "hi".txt`, "say%20%22hi%22.txt"},
+		{"100%.txt", "100%25.txt"},
+		{"报告.pdf", "%E6%8A%A5%E5%91%8A.pdf"},
+		{"naïve'1.txt", "na%C3%AFve%271.txt"},
+	}
+	for _, tt := range tests {
+		if got := encodeRFC5987(tt.in); got != tt.want {
+			t.Errorf("encodeRFC5987(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition, name, want string
+	}{
+		{"attachment", "app.tar.gz", `attachment; filename="app.tar.gz"`},
+		{"inline", "build log.txt", `inline; filename="build log.txt"`},
+		{"attachment", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"attachment", `a\b.txt`, `attachment; filename="a_b.txt"; filename*=UTF-8''a%5Cb.txt`},
+		{"attachment", "报告.pdf", `attachment; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`},
+		{"attachment", "line\nbreak.txt", `attachment; filename="line_break.txt"; filename*=UTF-8''line%0Abreak.txt`},
+	}
+	for _, tt := range tests {
+		got := contentDisposition(tt.disposition, tt.name)
+		if got != tt.want {
+			t.Errorf("contentDisposition(%q, %q) = %q, want %q", tt.disposition, tt.name, got, tt.want)
+			continue
+		}
+		// 标准解析器能取回原名
+		if _, params, err := mime.ParseMediaType(got); err != nil || params["filename"] != tt.name {
+			t.Errorf("parsed %q: filename = %q, %v; want %q", got, params["filename"], err, tt.name)
+		}
+	}
+}
+
+func TestInlineContentType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		sandbox bool
+	}{
+		{"text/plain; charset=utf-8", "text/plain; charset=utf-8", false},
+		{"text/html; charset=iso-8859-1", "text/plain; charset=iso-8859-1", false},
+		{"text/html", "text/plain; charset=utf-8", false},
+		{"application/javascript", "text/plain; charset=utf-8", false},
+		{"application/json", "text/plain; charset=utf-8", false},
+		{"image/svg+xml", "image/svg+xml", true},
+		{"image/png", "image/png", false},
+		{"video/mp4", "video/mp4", false},
+		{"application/pdf", "application/pdf", false},
+		{"application/zip", "", false},
+		{"application/octet-stream", "", false},
+		{"not a type", "", false},
+	}
+	for _, tt := range tests {
+		got, sandbox := inlineContentType(tt.in)
+		if got != tt.want || sandbox != tt.sandbox {
+			t.Errorf("inlineContentType(%q) = %q, %v; want %q, %v", tt.in, got, sandbox, tt.want, tt.sandbox)
+		}
+	}
+}
+
+func TestDownloadInlineHeaders(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	files := map[string]string{
+		"page.html":     "<script>alert(1)</script>",
+		"logo.svg":      `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`,
+		"app.zip":       "PK\x03\x04",
+		"报告 \"v1\".txt": "report",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(uploadDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		inline      bool
+		contentType string
+		disposition string
+		csp         string
+	}{
+		{"page.html", true, "text/plain; charset=utf-8", "inline", ""},
+		{"page.html", false, "text/html; charset=utf-8", "attachment", ""},
+		{"logo.svg", true, "image/svg+xml", "inline", "sandbox"},
+		{"app.zip", true, "application/zip", "attachment", ""},
+		{"报告 \"v1\".txt", true, "text/plain; charset=utf-8", "inline", ""},
+	}
+	for _, tt := range tests {
+		target := "/download/" + url.PathEscape(tt.name)
+		if tt.inline {
+			target += "?inline=1"
+		}
+		t.Run(target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleDownload(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			h := rec.Header()
+			if h.Get("Content-Type") != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", h.Get("Content-Type"), tt.contentType)
+			}
+			if h.Get("Content-Security-Policy") != tt.csp {
+				t.Errorf("Content-Security-Policy = %q, want %q", h.Get("Content-Security-Policy"), tt.csp)
+			}
+			if h.Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", h.Get("X-Content-Type-Options"))
+			}
+			disposition, params, err := mime.ParseMediaType(h.Get("Content-Disposition"))
+			if err != nil || disposition != tt.disposition || params["filename"] != tt.name {
+				t.Errorf("Content-Disposition = %q, want %s with filename %q", h.Get("Content-Disposition"), tt.disposition, tt.name)
+			}
+		})
+	}
+}
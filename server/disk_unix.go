@@ -7,20 +7,29 @@ import (
 	"syscall"
 )
 
-// checkDiskSpace 检查磁盘空间（Unix系统版本）
-func checkDiskSpace(requiredSize int64) error {
+// diskFreeSpace 返回上传目录所在磁盘的可用空间（Unix系统版本）
+func diskFreeSpace() (uint64, error) {
 	var stat syscall.Statfs_t
 	if err := syscall.Statfs(uploadDir, &stat); err != nil {
-		return fmt.Errorf("failed to get disk space info: %v", err)
+		return 0, fmt.Errorf("failed to get disk space info: %v", err)
 	}
 
 	// 计算可用空间（以字节为单位）
-	availableSpace := stat.Bavail * uint64(stat.Bsize)
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// checkDiskSpace 检查磁盘空间（Unix系统版本）
+func checkDiskSpace(requiredSize int64) error {
+	availableSpace, err := diskFreeSpace()
+	if err != nil {
+		return err
+	}
 
 	// 检查是否有足够的空间（文件大小 + 最小剩余空间）
-	if uint64(requiredSize)+minDiskSpace > availableSpace {
+	required := requiredSize + minFreeSpace.Load()
+	if uint64(required) > availableSpace {
 		return fmt.Errorf("not enough disk space. Required: %d bytes, Available: %d bytes",
-			requiredSize+minDiskSpace, availableSpace)
+			required, availableSpace)
 	}
 
 	return nil
@@ -13,14 +13,14 @@ var (
 	getDiskFreeSpace = kernel32.MustFindProc("GetDiskFreeSpaceExW")
 )
 
-// checkDiskSpace 检查磁盘空间（Windows系统版本）
-func checkDiskSpace(requiredSize int64) error {
+// diskFreeSpace 返回上传目录所在磁盘的可用空间（Windows系统版本）
+func diskFreeSpace() (uint64, error) {
 	var freeBytesAvailable, totalNumberOfBytes, totalNumberOfFreeBytes uint64
 
 	// 将路径转换为UTF-16
 	pathPtr, err := syscall.UTF16PtrFromString(uploadDir)
 	if err != nil {
-		return fmt.Errorf("failed to convert path: %v", err)
+		return 0, fmt.Errorf("failed to convert path: %v", err)
 	}
 
 	// 调用 GetDiskFreeSpaceEx
@@ -32,13 +32,24 @@ func checkDiskSpace(requiredSize int64) error {
 	)
 
 	if ret == 0 {
-		return fmt.Errorf("failed to get disk space info: %v", err)
+		return 0, fmt.Errorf("failed to get disk space info: %v", err)
+	}
+
+	return freeBytesAvailable, nil
+}
+
+// checkDiskSpace 检查磁盘空间（Windows系统版本）
+func checkDiskSpace(requiredSize int64) error {
+	freeBytesAvailable, err := diskFreeSpace()
+	if err != nil {
+		return err
 	}
 
 	// 检查是否有足够的空间（文件大小 + 最小剩余空间）
-	if uint64(requiredSize)+minDiskSpace > freeBytesAvailable {
+	required := requiredSize + minFreeSpace.Load()
+	if uint64(required) > freeBytesAvailable {
 		return fmt.Errorf("not enough disk space. Required: %d bytes, Available: %d bytes",
-			requiredSize+minDiskSpace, freeBytesAvailable)
+			required, freeBytesAvailable)
 	}
 
 	return nil
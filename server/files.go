@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// canManage 是否允许删除、移动、复制文件和创建目录
+func (id *Identity) canManage() bool {
+	return id.Role == roleAdmin || id.Role == roleReadWrite
+}
+
+// 中间件：文件管理接口需要读写或管理员角色，上传令牌不能使用
+func manageMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if !identityFrom(r).canManage() {
+			http.Error(w, "Write permission required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// safeUploadPath 把相对路径解析为上传目录内的完整路径。
+// 绝对路径、上传目录本身、越出上传目录的路径以及经符号链接指向上传目录之外的路径返回 false
+func safeUploadPath(rel string) (string, bool) {
+	rel = filepath.FromSlash(rel)
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || strings.HasPrefix(rel, string(os.PathSeparator)) {
+		return "", false
+	}
+	fullPath := filepath.Join(uploadDir, rel)
+	if !strings.HasPrefix(fullPath, filepath.Clean(uploadDir)+string(os.PathSeparator)) {
+		return "", false
+	}
+	if !insideUploadDir(fullPath) {
+		return "", false
+	}
+	return fullPath, true
+}
+
+// insideUploadDir 解析路径中已存在部分的符号链接，确认实际位置仍在上传目录内。
+// 悬空的符号链接无法确定最终位置，视为越界
+func insideUploadDir(fullPath string) bool {
+	root, err := filepath.EvalSymlinks(uploadDir)
+	if err != nil {
+		return false
+	}
+	existing, rest := fullPath, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			resolved = filepath.Join(resolved, rest)
+			return resolved == root || strings.HasPrefix(resolved, root+string(os.PathSeparator))
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		if _, err := os.Lstat(existing); err == nil {
+			return false
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return false
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// fileOpError 文件管理操作的错误及对应的状态码
+type fileOpError struct {
+	status int
+	msg    string
+}
+
+func (e *fileOpError) Error() string { return e.msg }
+
+func opError(status int, format string, args ...interface{}) *fileOpError {
+	return &fileOpError{status, fmt.Sprintf(format, args...)}
+}
+
+// writeFileOpError 把文件系统错误转换为 HTTP 状态码
+func writeFileOpError(w http.ResponseWriter, r *http.Request, err error) {
+	var opErr *fileOpError
+	switch {
+	case errors.As(err, &opErr):
+		http.Error(w, opErr.msg, opErr.status)
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "File not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrExist):
+		http.Error(w, "Destination already exists", http.StatusConflict)
+	default:
+		logFrom(r).Error("File operation failed", "error", err)
+		http.Error(w, "File operation failed", http.StatusInternalServerError)
+	}
+}
+
+// decodeFileOp 解析文件管理请求的 JSON 正文
+func decodeFileOp(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(v); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeFileOpResult 返回操作结果
+func writeFileOpResult(w http.ResponseWriter, result map[string]interface{}) {
+	result["status"] = "ok"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleDelete 删除文件或目录；非空目录需要 recursive。启用回收站时移入回收站而不是直接删除
+//
+//	POST /api/delete {"path": "builds/old", "recursive": true}
+func handleDelete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path      string `json:"path"`
+		Recursive bool   `json:"recursive"`
+	}
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+	setRequestFile(r, req.Path, 0)
+
+	fullPath, ok := safeUploadPath(req.Path)
+	if !ok {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+	entry, err := deletePath(fullPath, req.Recursive, identityFrom(r).Name)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	removeMeta(uploadRelPath(fullPath))
+
+	result := map[string]interface{}{"path": req.Path}
+	if entry != nil {
+		result["trash_id"] = entry.ID
+	}
+	logFrom(r).Info("Deleted", "path", req.Path, "trash_id", result["trash_id"], "identity", identityFrom(r).Name)
+	writeFileOpResult(w, result)
+}
+
+// deletePath 删除文件或目录，启用回收站时返回回收站条目
+func deletePath(fullPath string, recursive bool, identity string) (*TrashEntry, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() && !recursive {
+		entries, err := os.ReadDir(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			return nil, opError(http.StatusConflict, "Directory not empty, use recursive delete")
+		}
+	}
+	if trashEnabled() {
+		return moveToTrash(fullPath, "delete", identity)
+	}
+	return nil, os.RemoveAll(fullPath)
+}
+
+// handleMkdir 创建目录，parents 为 true 时同时创建上级目录且目录已存在不报错
+//
+//	POST /api/mkdir {"path": "builds/2024", "parents": true}
+func handleMkdir(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path    string `json:"path"`
+		Parents bool   `json:"parents"`
+	}
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+	setRequestFile(r, req.Path, 0)
+
+	fullPath, ok := safeUploadPath(req.Path)
+	if !ok {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Parents {
+		if info, statErr := os.Stat(fullPath); statErr == nil && !info.IsDir() {
+			err = opError(http.StatusConflict, "A file with that name already exists")
+		} else {
+			err = os.MkdirAll(fullPath, 0755)
+		}
+	} else {
+		err = os.Mkdir(fullPath, 0755)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = opError(http.StatusNotFound, "Parent directory does not exist")
+		}
+	}
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+
+	logFrom(r).Info("Created directory", "path", req.Path, "identity", identityFrom(r).Name)
+	writeFileOpResult(w, map[string]interface{}{"path": req.Path})
+}
+
+// fileTransferRequest 移动和复制的请求
+type fileTransferRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite"` // 目标是已存在的文件时覆盖；目录不会被覆盖
+}
+
+// resolveTransfer 校验源和目标路径
+func resolveTransfer(req fileTransferRequest) (src, dst string, srcInfo os.FileInfo, err error) {
+	src, ok := safeUploadPath(req.From)
+	if !ok {
+		return "", "", nil, opError(http.StatusBadRequest, "Invalid source path")
+	}
+	dst, ok = safeUploadPath(req.To)
+	if !ok {
+		return "", "", nil, opError(http.StatusBadRequest, "Invalid destination path")
+	}
+	if srcInfo, err = os.Lstat(src); err != nil {
+		return "", "", nil, err
+	}
+	if src == dst {
+		return "", "", nil, opError(http.StatusBadRequest, "Source and destination are the same")
+	}
+	if srcInfo.IsDir() && strings.HasPrefix(dst, src+string(os.PathSeparator)) {
+		return "", "", nil, opError(http.StatusBadRequest, "Cannot move or copy a directory into itself")
+	}
+
+	if dstInfo, statErr := os.Lstat(dst); statErr == nil {
+		if dstInfo.IsDir() || srcInfo.IsDir() || !req.Overwrite {
+			return "", "", nil, opError(http.StatusConflict, "Destination already exists")
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", "", nil, err
+	}
+	return src, dst, srcInfo, nil
+}
+
+// handleMove 移动或重命名文件和目录
+//
+//	POST /api/move {"from": "a.txt", "to": "archive/a.txt", "overwrite": false}
+func handleMove(w http.ResponseWriter, r *http.Request) {
+	var req fileTransferRequest
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+	setRequestFile(r, req.From, 0)
+
+	src, dst, info, err := resolveTransfer(req)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	setRequestFile(r, req.From, info.Size())
+	if err := preserveExisting(r, dst); err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	if err := os.Rename(src, dst); err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	renameMeta(uploadRelPath(src), uploadRelPath(dst))
+	if err := moveVersions(uploadRelPath(src), uploadRelPath(dst), info.IsDir()); err != nil {
+		logFrom(r).Warn("Failed to move file versions", "from", req.From, "to", req.To, "error", err)
+	}
+
+	logFrom(r).Info("Moved", "from", req.From, "to", req.To, "identity", identityFrom(r).Name)
+	writeFileOpResult(w, map[string]interface{}{"from": req.From, "to": req.To})
+}
+
+// handleCopy 在服务器上复制文件或目录，复制前检查磁盘空间
+//
+//	POST /api/copy {"from": "release.tar", "to": "backup/release.tar"}
+func handleCopy(w http.ResponseWriter, r *http.Request) {
+	var req fileTransferRequest
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+	setRequestFile(r, req.From, 0)
+
+	src, dst, info, err := resolveTransfer(req)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+
+	size, err := treeSize(src)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	setRequestFile(r, req.From, size)
+	if err := checkDiskSpace(size); err != nil {
+		http.Error(w, fmt.Sprintf("Insufficient disk space: %v", err), http.StatusInsufficientStorage)
+		return
+	}
+
+	if info.IsDir() {
+		err = copyDir(src, dst)
+	} else if err = preserveExisting(r, dst); err == nil {
+		err = copyFile(src, dst, info.Mode())
+	}
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	copyMeta(uploadRelPath(src), uploadRelPath(dst))
+
+	logFrom(r).Info("Copied", "from", req.From, "to", req.To, "size", size, "identity", identityFrom(r).Name)
+	writeFileOpResult(w, map[string]interface{}{"from": req.From, "to": req.To, "size": size})
+}
+
+// treeSize 计算文件或目录的总大小
+func treeSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// 复制和上传写入的临时文件名前缀，完成后重命名为目标文件
+const (
+	copyingPrefix   = ".copying-"
+	uploadingPrefix = ".uploading-"
+)
+
+// isPartialName 是否是正在写入的临时文件：列表、搜索和扫描都跳过这些文件
+func isPartialName(name string) bool {
+	return strings.HasPrefix(name, copyingPrefix) || strings.HasPrefix(name, uploadingPrefix)
+}
+
+// copyFile 先写入临时文件再重命名，复制中途失败不会留下不完整的目标文件
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// 每次复制使用独立的临时文件，同时复制到同一目标时不会互相覆盖
+	out, err := os.CreateTemp(filepath.Dir(dst), copyingPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Chmod(mode.Perm()); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// pendingFile 上传先写入目标目录下的临时文件，写完后再替换目标文件，
+// 写入失败或客户端断开时已有的文件保持不变
+type pendingFile struct {
+	*os.File
+	dst       string
+	committed bool
+}
+
+func createPending(dst string) (*pendingFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(dst), uploadingPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &pendingFile{File: f, dst: dst}, nil
+}
+
+// commit 关闭临时文件，保留已有的目标文件（历史版本或回收站）后改名为目标文件
+func (p *pendingFile) commit(r *http.Request) error {
+	if err := p.Chmod(0644); err != nil {
+		return err
+	}
+	if err := p.Close(); err != nil {
+		return err
+	}
+	if err := preserveExisting(r, p.dst); err != nil {
+		return fmt.Errorf("preserve existing file: %w", err)
+	}
+	if err := os.Rename(p.Name(), p.dst); err != nil {
+		return err
+	}
+	p.committed = true
+	return nil
+}
+
+// discard 没有提交时删除临时文件
+func (p *pendingFile) discard() {
+	if !p.committed {
+		p.Close()
+		os.Remove(p.Name())
+	}
+}
+
+// copyDir 递归复制目录，跳过符号链接
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return copyFile(path, target, info.Mode())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setupEscapes 在上传目录中创建指向外部目录的符号链接和悬空链接，返回外部目录
+func setupEscapes(t *testing.T) string {
+	t.Helper()
+	dir := chdirTemp(t)
+	outside := filepath.Join(dir, "outside")
+	if err := os.MkdirAll(filepath.Join(outside, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(uploadDir, "builds"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(uploadDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"escape":        outside,
+		"builds/inner":  "..",
+		"dangling":      filepath.Join(outside, "missing"),
+		"secret-link":   filepath.Join(outside, "secret.txt"),
+		"builds/parent": "../..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(uploadDir, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	return outside
+}
+
+func TestSafeUploadPath(t *testing.T) {
+	setupEscapes(t)
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{"builds/new/file.bin", true},
+		{"builds/../a.txt", true},
+		{"builds/inner/a.txt", true}, // 链接指回上传目录内
+		{"", false},
+		{".", false},
+		{"builds/..", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{"builds/../../etc/passwd", false},
+		{`..\etc\passwd`, filepath.Separator == '/'}, // 反斜杠只在 Windows 上是分隔符
+		{"/etc/passwd", false},
+		{"//etc/passwd", false},
+		{"escape", false},
+		{"escape/secret.txt", false},
+		{"escape/sub/new.txt", false},
+		{"escape/missing/new.txt", false},
+		{"secret-link", false},
+		{"builds/parent/outside/secret.txt", false},
+		{"dangling", false},
+		{"a.txt.versions", true},
+		{"builds.versions/a.txt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			fullPath, ok := safeUploadPath(tt.path)
+			if ok != tt.ok {
+				t.Fatalf("safeUploadPath(%q) = %q, %v, want ok %v", tt.path, fullPath, ok, tt.ok)
+			}
+			if ok && !strings.HasPrefix(fullPath, filepath.Clean(uploadDir)+string(os.PathSeparator)) {
+				t.Errorf("safeUploadPath(%q) = %q outside the upload directory", tt.path, fullPath)
+			}
+		})
+	}
+}
+
+func TestCleanRelPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"/builds/a.txt", filepath.FromSlash("builds/a.txt"), true},
+		{`builds\a.txt`, filepath.FromSlash("builds/a.txt"), true},
+		{"builds/./x/../a.txt", filepath.FromSlash("builds/a.txt"), true},
+		{"", "", true},
+		{"..", "", false},
+		{"../a.txt", "", false},
+		{`..\a.txt`, "", false},
+		{"builds/../../a.txt", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := cleanRelPath(tt.path)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("cleanRelPath(%q) = %q, %v, want %q, ok %v", tt.path, got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestResolveUploadPathSymlinkEscape(t *testing.T) {
+	outside := setupEscapes(t)
+	id := &Identity{Name: "test", Role: roleReadWrite}
+
+	for _, name := range []string{"escape/new.txt", "dangling", "builds/parent/outside/x"} {
+		if fullPath, err := resolveUploadPath(id, name); err == nil {
+			t.Errorf("resolveUploadPath(%q) = %q, want error", name, fullPath)
+		}
+	}
+	if _, err := resolveUploadPath(id, "builds/new.txt"); err != nil {
+		t.Errorf("resolveUploadPath(builds/new.txt): %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 2 {
+		t.Errorf("outside directory was modified: %d entries", len(entries))
+	}
+}
+
+func TestFileOpsRejectInvalidPaths(t *testing.T) {
+	outside := setupEscapes(t)
+
+	tests := []struct {
+		name     string
+		endpoint string
+		handler  http.HandlerFunc
+		body     string
+	}{
+		{"delete traversal", "/api/delete", handleDelete, `{"path": "../outside/secret.txt"}`},
+		{"delete absolute", "/api/delete", handleDelete, `{"path": "/etc/passwd"}`},
+		{"delete root", "/api/delete", handleDelete, `{"path": "", "recursive": true}`},
+		{"delete through symlink", "/api/delete", handleDelete, `{"path": "escape/secret.txt"}`},
+		{"delete symlinked dir", "/api/delete", handleDelete, `{"path": "escape", "recursive": true}`},
+		{"mkdir through symlink", "/api/mkdir", handleMkdir, `{"path": "escape/sub/new", "parents": true}`},
+		{"mkdir traversal", "/api/mkdir", handleMkdir, `{"path": "../created", "parents": true}`},
+		{"move source traversal", "/api/move", handleMove, `{"from": "../outside/secret.txt", "to": "stolen.txt"}`},
+		{"move source through symlink", "/api/move", handleMove, `{"from": "escape/secret.txt", "to": "stolen.txt"}`},
+		{"move destination traversal", "/api/move", handleMove, `{"from": "a.txt", "to": "../outside/a.txt"}`},
+		{"move destination absolute", "/api/move", handleMove, `{"from": "a.txt", "to": "/tmp/a.txt"}`},
+		{"move destination through symlink", "/api/move", handleMove, `{"from": "a.txt", "to": "escape/a.txt"}`},
+		{"move destination dangling", "/api/move", handleMove, `{"from": "a.txt", "to": "dangling", "overwrite": true}`},
+		{"copy source traversal", "/api/copy", handleCopy, `{"from": "../outside/secret.txt", "to": "stolen.txt"}`},
+		{"copy source through symlink", "/api/copy", handleCopy, `{"from": "escape", "to": "stolen"}`},
+		{"copy destination absolute", "/api/copy", handleCopy, `{"from": "a.txt", "to": "/tmp/a.txt"}`},
+		{"copy destination through symlink", "/api/copy", handleCopy, `{"from": "a.txt", "to": "escape/sub/a.txt"}`},
+		{"copy destination parent link", "/api/copy", handleCopy, `{"from": "a.txt", "to": "builds/parent/outside/a.txt"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.endpoint, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+		})
+	}
+
+	// 外部目录和上传目录中的文件都没有被改动
+	entries, err := os.ReadDir(outside)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("outside directory was modified: %v entries, %v", len(entries), err)
+	}
+	if data, err := os.ReadFile(filepath.Join(uploadDir, "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("a.txt was modified: %q, %v", data, err)
+	}
+}
+
+func TestCopyFileConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst.bin")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		src := filepath.Join(dir, fmt.Sprintf("src%d.bin", i))
+		data := []byte(strings.Repeat(fmt.Sprint(i), 256*1024))
+		if err := os.WriteFile(src, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := copyFile(src, dst, 0640); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 目标是某一次完整的复制，没有残留的临时文件
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 256*1024 || strings.Count(string(data), string(data[:1])) != len(data) {
+		t.Error("destination mixes the contents of several copies")
+	}
+	info, err := os.Stat(dst)
+	if err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("destination mode = %v, %v, want 0640", info.Mode().Perm(), err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".copying-") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
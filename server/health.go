@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// version 由构建脚本通过 -ldflags "-X main.version=..." 注入
+var version = "dev"
+
+// protocolVersion 上传/下载协议版本，接口发生不兼容变化时递增
+const protocolVersion = 1
+
+// checkWritable 在目录中创建并删除一个临时文件，确认目录可写
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".ctrans-probe-*")
+	if err != nil {
+		return err
+	}
+	name := file.Name()
+	file.Close()
+	return os.Remove(filepath.Clean(name))
+}
+
+// handleHealthz 存活检查：进程能处理请求即返回 200
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz 就绪检查：上传目录和临时目录可写、磁盘剩余空间充足且不在排空状态时返回 200
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	ready := true
+	fail := func(name string, err error) {
+		checks[name] = err.Error()
+		ready = false
+	}
+
+	if draining.Load() {
+		fail("draining", fmt.Errorf("server is shutting down"))
+	}
+	for name, dir := range map[string]string{"upload_dir": uploadDir, "temp_dir": tempDir} {
+		if err := checkWritable(dir); err != nil {
+			fail(name, err)
+		} else {
+			checks[name] = "ok"
+		}
+	}
+	if err := checkDiskSpace(0); err != nil {
+		fail("disk_space", err)
+	} else {
+		checks["disk_space"] = "ok"
+	}
+	// 只读模式下下载和列表仍然可用，只作为提示，不影响就绪状态
+	if currentMaintenance().ReadOnly {
+		checks["maintenance"] = "read-only"
+	}
+
+	status := "ready"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ready {
+		status = "not ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// serverFeatures 列出当前启用的功能，客户端据此判断能否使用
+func serverFeatures() []string {
+	features := []string{"chunked_upload", "resume", "range_download", "upload_tokens", "web_sessions", "metrics", "file_management"}
+	if trashEnabled() {
+		features = append(features, "trash")
+	}
+	features = append(features, "versions", "search", "metadata", "tags")
+	if usersEnabled() {
+		features = append(features, "basic_auth")
+	}
+	if clientCertAuth {
+		features = append(features, "client_certs")
+	}
+	if oidcEnabled() {
+		features = append(features, "oidc")
+	}
+	if auditLog != nil {
+		features = append(features, "audit_log")
+	}
+	return features
+}
+
+// handleInfo 返回服务器版本、协议版本、分片限制、功能和剩余空间
+func handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var freeSpace int64 = -1
+	if free, err := diskFreeSpace(); err == nil {
+		freeSpace = int64(free)
+	}
+
+	id := identityFrom(r)
+	state := currentMaintenance()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":          version,
+		"protocol_version": protocolVersion,
+		"chunk_size":       chunkSize,
+		"max_chunk_size":   chunkSize,
+		"min_free_space":   minFreeSpace.Load(),
+		"free_space":       freeSpace,
+		"features":         serverFeatures(),
+		"read_only":        state.ReadOnly,
+		"message":          state.Message,
+		"identity":         id.Name,
+		"role":             id.Role,
+	})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// LimitsConfig 准入控制与带宽限制，0 表示不限制
+type LimitsConfig struct {
+	MaxSessions            int                 `json:"max_sessions"`              // 同时进行的上传会话
+	MaxSessionsPerIdentity int                 `json:"max_sessions_per_identity"` // 每个身份同时进行的上传会话
+	MaxChunks              int                 `json:"max_chunks"`                // 同时写入的分片和网页上传
+	MaxChunksPerIdentity   int                 `json:"max_chunks_per_identity"`   // 每个身份同时写入的分片
+	SessionIdle            Duration            `json:"session_idle"`              // 超过该时间没有新分片的会话不再计入并发数（仍可继续上传）
+	Bandwidth              ByteSize            `json:"bandwidth"`                 // 全局每秒字节数，上传和下载分别计算
+	BandwidthPerIdentity   ByteSize            `json:"bandwidth_per_identity"`    // 每个身份每秒字节数
+	IdentityBandwidth      map[string]ByteSize `json:"identity_bandwidth"`        // 按身份覆盖，例如 {"cert:builder": "200MB"}
+}
+
+func (l LimitsConfig) validate() error {
+	if l.MaxSessions < 0 || l.MaxSessionsPerIdentity < 0 || l.MaxChunks < 0 || l.MaxChunksPerIdentity < 0 {
+		return fmt.Errorf("limits: concurrency limits must not be negative")
+	}
+	if l.Bandwidth < 0 || l.BandwidthPerIdentity < 0 {
+		return fmt.Errorf("limits: bandwidth must not be negative")
+	}
+	for name, bw := range l.IdentityBandwidth {
+		if bw <= 0 {
+			return fmt.Errorf("limits: identity_bandwidth for %q must be positive", name)
+		}
+	}
+	return nil
+}
+
+// throttleBlock 限速时每次读写的最大字节数，令牌桶容量不小于该值
+const throttleBlock = 32 * 1024
+
+// identityLimiterIdle 没有请求使用超过该时间的身份令牌桶会被删除，此时令牌桶早已重新装满，删除后重建没有区别
+const identityLimiterIdle = 10 * time.Minute
+
+// bandwidthLimiters 一个方向（上传或下载）的令牌桶
+type bandwidthLimiters struct {
+	in, out  *rate.Limiter // nil 表示不限制
+	users    int           // 正在使用的请求数，由 limitsMutex 保护
+	lastUsed time.Time     // 最后一个请求结束的时间
+}
+
+func newBandwidthLimiters(bytesPerSecond ByteSize) *bandwidthLimiters {
+	if bytesPerSecond <= 0 {
+		return &bandwidthLimiters{}
+	}
+	burst := max(int(bytesPerSecond), throttleBlock)
+	return &bandwidthLimiters{
+		in:  rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+		out: rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+	}
+}
+
+var (
+	limitsMutex      sync.Mutex
+	limits           LimitsConfig
+	activeChunks     int
+	chunksByIdentity = make(map[string]int)
+	globalBandwidth  = &bandwidthLimiters{}
+	identityLimiters = make(map[string]*bandwidthLimiters)
+)
+
+// applyLimits 应用新的限制；令牌桶重新创建，正在进行的分片写入继续计数
+func applyLimits(cfg LimitsConfig) {
+	limitsMutex.Lock()
+	defer limitsMutex.Unlock()
+	limits = cfg
+	globalBandwidth = newBandwidthLimiters(cfg.Bandwidth)
+	identityLimiters = make(map[string]*bandwidthLimiters)
+}
+
+// limitError 超出限制时返回给客户端的错误
+type limitError struct {
+	status     int // 429 表示该身份超限，503 表示服务器整体繁忙
+	retryAfter int // 秒
+	limit      string
+	msg        string
+}
+
+func (e *limitError) Error() string { return e.msg }
+
+// rejectLimit 返回 429/503 和 Retry-After，而不是让请求无限排队
+func rejectLimit(w http.ResponseWriter, r *http.Request, err *limitError) {
+	limitRejections.WithLabelValues(err.limit).Inc()
+	logFrom(r).Info("Request rejected by limits", "limit", err.limit, "identity", identityFrom(r).Name)
+	w.Header().Set("Retry-After", strconv.Itoa(err.retryAfter))
+	http.Error(w, err.msg, err.status)
+}
+
+// admitSession 检查上传会话并发数；调用方需持有 statusMutex。
+// 重新初始化同一个未完成的会话不算新会话。
+func admitSession(identity, fileID string) *limitError {
+	limitsMutex.Lock()
+	l := limits
+	limitsMutex.Unlock()
+
+	if l.MaxSessions == 0 && l.MaxSessionsPerIdentity == 0 {
+		return nil
+	}
+	if existing, ok := uploadStatuses[fileID]; ok && !existing.Completed {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-l.SessionIdle.Duration)
+	total, own := 0, 0
+	for _, status := range uploadStatuses {
+		if status.Completed || (l.SessionIdle.Duration > 0 && status.LastUpdate.Before(cutoff)) {
+			continue
+		}
+		total++
+		if status.Identity == identity {
+			own++
+		}
+	}
+
+	if l.MaxSessionsPerIdentity > 0 && own >= l.MaxSessionsPerIdentity {
+		return &limitError{http.StatusTooManyRequests, 30, "identity_sessions",
+			fmt.Sprintf("Too many concurrent uploads (limit %d per client), try again later", l.MaxSessionsPerIdentity)}
+	}
+	if l.MaxSessions > 0 && total >= l.MaxSessions {
+		return &limitError{http.StatusServiceUnavailable, 30, "sessions",
+			"Server has too many concurrent uploads, try again later"}
+	}
+	return nil
+}
+
+// acquireChunkSlot 占用一个分片写入名额，不排队：没有空闲名额时立即返回错误
+func acquireChunkSlot(identity string) (func(), *limitError) {
+	limitsMutex.Lock()
+	defer limitsMutex.Unlock()
+
+	if limits.MaxChunksPerIdentity > 0 && chunksByIdentity[identity] >= limits.MaxChunksPerIdentity {
+		return nil, &limitError{http.StatusTooManyRequests, 2, "identity_chunks",
+			fmt.Sprintf("Too many concurrent chunk uploads (limit %d per client)", limits.MaxChunksPerIdentity)}
+	}
+	if limits.MaxChunks > 0 && activeChunks >= limits.MaxChunks {
+		return nil, &limitError{http.StatusServiceUnavailable, 2, "chunks",
+			"Server is busy writing other chunks, try again later"}
+	}
+
+	activeChunks++
+	chunksByIdentity[identity]++
+	return func() {
+		limitsMutex.Lock()
+		activeChunks--
+		if chunksByIdentity[identity]--; chunksByIdentity[identity] <= 0 {
+			delete(chunksByIdentity, identity)
+		}
+		limitsMutex.Unlock()
+	}, nil
+}
+
+// bandwidthFor 返回作用于该身份的令牌桶（全局和身份各一个，未限制的省略）。
+// ctx 结束（请求处理完毕）前该身份的令牌桶不会被 pruneIdentityLimiters 删除
+func bandwidthFor(ctx context.Context, identity string) (in, out []*rate.Limiter) {
+	limitsMutex.Lock()
+	defer limitsMutex.Unlock()
+
+	own, exists := identityLimiters[identity]
+	if !exists {
+		bw, ok := limits.IdentityBandwidth[identity]
+		if !ok {
+			bw = limits.BandwidthPerIdentity
+		}
+		own = newBandwidthLimiters(bw)
+		identityLimiters[identity] = own
+	}
+	own.users++
+	context.AfterFunc(ctx, func() {
+		limitsMutex.Lock()
+		own.users--
+		own.lastUsed = time.Now()
+		limitsMutex.Unlock()
+	})
+
+	for _, l := range []*bandwidthLimiters{globalBandwidth, own} {
+		if l.in != nil {
+			in = append(in, l.in)
+			out = append(out, l.out)
+		}
+	}
+	return in, out
+}
+
+// pruneIdentityLimiters 删除空闲超过 idle 的身份令牌桶，避免大量不同的客户端 IP 和身份让映射无限增长
+func pruneIdentityLimiters(idle time.Duration) {
+	cutoff := time.Now().Add(-idle)
+	limitsMutex.Lock()
+	defer limitsMutex.Unlock()
+	for identity, l := range identityLimiters {
+		if l.users == 0 && l.lastUsed.Before(cutoff) {
+			delete(identityLimiters, identity)
+		}
+	}
+}
+
+// startLimiterPruner 定期清理空闲的身份令牌桶
+func startLimiterPruner() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			pruneIdentityLimiters(identityLimiterIdle)
+		}
+	}()
+}
+
+// waitAll 等待所有令牌桶放行 n 字节
+func waitAll(ctx context.Context, limiters []*rate.Limiter, n int) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttledReader 按令牌桶限速读取请求体
+type throttledReader struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleBlock {
+		p = p[:throttleBlock]
+	}
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := waitAll(t.ctx, t.limiters, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttledWriter 按令牌桶限速写出下载内容
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (t throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		block := b[:min(len(b), throttleBlock)]
+		if err := waitAll(t.ctx, t.limiters, len(block)); err != nil {
+			return written, err
+		}
+		n, err := t.ResponseWriter.Write(block)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// limitTransfer 中间件：限制同时写入的分片数，并对请求体限速。需要放在认证中间件之内以获得身份。
+func limitTransfer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := identityFrom(r).Name
+		release, lerr := acquireChunkSlot(identity)
+		if lerr != nil {
+			rejectLimit(w, r, lerr)
+			return
+		}
+		defer release()
+
+		if in, _ := bandwidthFor(r.Context(), identity); len(in) > 0 {
+			r.Body = &throttledReader{ReadCloser: r.Body, ctx: r.Context(), limiters: in}
+		}
+		next(w, r)
+	}
+}
+
+// throttleDownload 对下载响应限速
+func throttleDownload(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if _, out := bandwidthFor(r.Context(), identityFrom(r).Name); len(out) > 0 {
+		return throttledWriter{ResponseWriter: w, ctx: r.Context(), limiters: out}
+	}
+	return w
+}
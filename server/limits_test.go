@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPruneIdentityLimiters(t *testing.T) {
+	applyLimits(LimitsConfig{BandwidthPerIdentity: 1 << 20})
+	t.Cleanup(func() { applyLimits(LimitsConfig{}) })
+
+	// 已结束的请求
+	done, cancel := context.WithCancel(context.Background())
+	bandwidthFor(done, "ip:192.0.2.1")
+	cancel()
+	// 仍在进行的请求
+	active, stop := context.WithCancel(context.Background())
+	defer stop()
+	bandwidthFor(active, "ip:192.0.2.2")
+
+	// AfterFunc 在单独的 goroutine 中运行，等待计数更新
+	deadline := time.Now().Add(time.Second)
+	for {
+		limitsMutex.Lock()
+		users := identityLimiters["ip:192.0.2.1"].users
+		limitsMutex.Unlock()
+		if users == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("limiter still in use after the request ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pruneIdentityLimiters(time.Hour)
+	limitsMutex.Lock()
+	n := len(identityLimiters)
+	limitsMutex.Unlock()
+	if n != 2 {
+		t.Fatalf("recently used limiters were pruned, %d left", n)
+	}
+
+	pruneIdentityLimiters(0)
+	limitsMutex.Lock()
+	_, endedKept := identityLimiters["ip:192.0.2.1"]
+	_, activeKept := identityLimiters["ip:192.0.2.2"]
+	limitsMutex.Unlock()
+	if endedKept {
+		t.Error("idle limiter was not pruned")
+	}
+	if !activeKept {
+		t.Error("limiter of a running request was pruned")
+	}
+}
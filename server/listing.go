@@ -0,0 +1,388 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 1000
+	maxListLimit     = 10000
+)
+
+// FileEntry 文件列表中的一项；元数据库中有该文件的有效记录时带上校验和、类型和上传者
+type FileEntry struct {
+	Name        string     `json:"name"`
+	Path        string     `json:"path"`
+	Size        int64      `json:"size"`
+	Modified    time.Time  `json:"modified"`
+	IsDir       bool       `json:"is_dir"`
+	SHA256      string     `json:"sha256,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	UploadedBy  string     `json:"uploaded_by,omitempty"`
+	UploadedAt  *time.Time `json:"uploaded_at,omitempty"`
+	// 上传时客户端文件的修改时间
+	OriginalModified *time.Time        `json:"original_modified,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	Description      string            `json:"description,omitempty"`
+}
+
+func (e *FileEntry) setMeta(m *FileMeta) {
+	e.SHA256, e.ContentType, e.UploadedBy = m.SHA256, m.ContentType, m.UploadedBy
+	uploadedAt := m.UploadedAt
+	e.UploadedAt, e.OriginalModified = &uploadedAt, m.OriginalModified
+	e.Tags, e.Description = m.Tags, m.Description
+}
+
+// listCursor 分页游标：上一页最后一项的排序键，和排序方式一起编码，防止换了排序方式后继续翻页
+type listCursor struct {
+	Sort      string `json:"s"`
+	Desc      bool   `json:"o,omitempty"`
+	DirsFirst bool   `json:"f,omitempty"`
+	Path      string `json:"p"`
+	IsDir     bool   `json:"d,omitempty"`
+	Key       int64  `json:"k,omitempty"` // 按大小或修改时间（纳秒）排序时的值
+}
+
+// listQuery /files 的查询参数
+type listQuery struct {
+	dir       string // 列出的目录（相对上传目录），空字符串为根目录
+	depth     int    // 1 只列出直接子项，0 不限
+	glob      string // 匹配名称
+	re        *regexp.Regexp
+	kind      string // file、dir 或空
+	sort      string // name、size、modified
+	desc      bool
+	dirsFirst bool
+	limit     int
+	cursor    *listCursor
+	tags      []tagFilter
+	metas     map[string]*FileMeta // 有标签条件时为列出范围内的元数据记录
+}
+
+// listCandidate 遍历时收集的条目，只在需要时读取大小和修改时间
+type listCandidate struct {
+	rel   string
+	isDir bool
+	entry fs.DirEntry
+	size  int64
+	mod   time.Time
+}
+
+func (c *listCandidate) stat() error {
+	info, err := c.entry.Info()
+	if err != nil {
+		return err
+	}
+	c.size, c.mod = info.Size(), info.ModTime()
+	return nil
+}
+
+// errListFull 遍历已收集到足够的条目
+var errListFull = errors.New("list full")
+
+// parseListQuery 解析并校验查询参数
+func parseListQuery(r *http.Request) (*listQuery, error) {
+	v := r.URL.Query()
+	q := &listQuery{
+		dir:       strings.Trim(path.Clean("/"+v.Get("path")), "/"),
+		depth:     1,
+		glob:      v.Get("glob"),
+		kind:      v.Get("type"),
+		sort:      v.Get("sort"),
+		desc:      v.Get("order") == "desc",
+		dirsFirst: v.Get("dirs_first") == "1" || v.Get("dirs_first") == "true",
+		limit:     defaultListLimit,
+	}
+
+	if s := v.Get("depth"); s != "" {
+		depth, err := strconv.Atoi(s)
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid depth")
+		}
+		q.depth = depth
+	}
+	if s := v.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		q.limit = min(limit, maxListLimit)
+	}
+	if q.glob != "" {
+		if _, err := path.Match(q.glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern")
+		}
+	}
+	tags, err := parseTagFilters(v["tag"])
+	if err != nil {
+		return nil, err
+	}
+	q.tags = tags
+	if s := v.Get("regex"); s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %v", err)
+		}
+		q.re = re
+	}
+	switch q.kind {
+	case "", "file", "dir":
+	default:
+		return nil, fmt.Errorf("type must be file or dir")
+	}
+	switch q.sort {
+	case "":
+		q.sort = "name"
+	case "name", "size", "modified":
+	default:
+		return nil, fmt.Errorf("sort must be name, size or modified")
+	}
+	if s := v.Get("order"); s != "" && s != "asc" && s != "desc" {
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	if s := v.Get("cursor"); s != "" {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		var c listCursor
+		if err != nil || json.Unmarshal(data, &c) != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		if c.Sort != q.sort || c.Desc != q.desc || c.DirsFirst != q.dirsFirst {
+			return nil, fmt.Errorf("cursor does not match the sort order")
+		}
+		q.cursor = &c
+	}
+	return q, nil
+}
+
+// pathKey 按路径分段比较：同一目录下的条目排在一起，与 filepath.WalkDir 的遍历顺序一致
+func pathKey(rel string) string {
+	return strings.ReplaceAll(rel, "/", "\x00")
+}
+
+// compare 按查询的排序方式比较两个条目
+func (q *listQuery) compare(a, b *listCandidate) int {
+	if q.dirsFirst && a.isDir != b.isDir {
+		if a.isDir {
+			return -1
+		}
+		return 1
+	}
+	c := 0
+	switch q.sort {
+	case "size":
+		c = cmp.Compare(a.size, b.size)
+	case "modified":
+		c = a.mod.Compare(b.mod)
+	}
+	if c == 0 {
+		c = strings.Compare(pathKey(a.rel), pathKey(b.rel))
+	}
+	if q.desc {
+		c = -c
+	}
+	return c
+}
+
+func (q *listQuery) cursorCandidate() *listCandidate {
+	c := &listCandidate{rel: q.cursor.Path, isDir: q.cursor.IsDir}
+	switch q.sort {
+	case "size":
+		c.size = q.cursor.Key
+	case "modified":
+		c.mod = time.Unix(0, q.cursor.Key)
+	}
+	return c
+}
+
+func (q *listQuery) encodeCursor(last *listCandidate) string {
+	c := listCursor{Sort: q.sort, Desc: q.desc, DirsFirst: q.dirsFirst, Path: last.rel, IsDir: last.isDir}
+	switch q.sort {
+	case "size":
+		c.Key = last.size
+	case "modified":
+		c.Key = last.mod.UnixNano()
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (q *listQuery) matches(rel string, d fs.DirEntry) bool {
+	if !d.IsDir() && isPartialName(d.Name()) {
+		return false
+	}
+	if (q.kind == "file" && d.IsDir()) || (q.kind == "dir" && !d.IsDir()) {
+		return false
+	}
+	if q.glob != "" {
+		if ok, _ := path.Match(q.glob, path.Base(rel)); !ok {
+			return false
+		}
+	}
+	if q.re != nil && !q.re.MatchString(rel) {
+		return false
+	}
+	if len(q.tags) == 0 {
+		return true
+	}
+	// 按标签筛选时只返回有有效元数据记录的文件
+	if d.IsDir() {
+		return false
+	}
+	m := q.metas[rel]
+	info, err := d.Info()
+	return err == nil && m.matches(info.Size(), info.ModTime()) && matchTags(q.tags, m)
+}
+
+// collect 遍历查询范围内的条目。按名称升序时遍历顺序就是结果顺序，
+// 跳过游标之前的子树并在凑满一页后停止，大目录树也只读取需要的部分；其他排序方式需要遍历整个范围。
+func (q *listQuery) collect(root string) ([]*listCandidate, error) {
+	streaming := q.sort == "name" && !q.desc && !q.dirsFirst
+	var after string
+	if q.cursor != nil {
+		after = pathKey(q.cursor.Path)
+	}
+
+	if len(q.tags) > 0 {
+		q.metas = metaUnder(q.dir)
+	}
+
+	var found []*listCandidate
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		relToRoot, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel := uploadRelPath(p)
+		descend := d.IsDir() && (q.depth == 0 || strings.Count(filepath.ToSlash(relToRoot), "/")+1 < q.depth)
+
+		if streaming && q.cursor != nil && pathKey(rel) <= after {
+			// 游标所在目录及其上级目录需要继续进入，其余已返回过的子树整体跳过
+			if descend && (rel == q.cursor.Path || strings.HasPrefix(q.cursor.Path, rel+"/")) {
+				return nil
+			}
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if q.matches(rel, d) {
+			found = append(found, &listCandidate{rel: rel, isDir: d.IsDir(), entry: d})
+			if streaming && len(found) > q.limit {
+				return errListFull
+			}
+		}
+		if d.IsDir() && !descend {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errListFull) {
+		return nil, err
+	}
+	if streaming {
+		return found, nil
+	}
+
+	// 需要完整排序：读取大小和修改时间后排序，再跳过游标之前的条目
+	if q.sort != "name" {
+		for _, c := range found {
+			if err := c.stat(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return q.compare(found[i], found[j]) < 0 })
+	if q.cursor != nil {
+		cursor := q.cursorCandidate()
+		start := sort.Search(len(found), func(i int) bool { return q.compare(found[i], cursor) > 0 })
+		found = found[start:]
+	}
+	return found, nil
+}
+
+// handleListDir 分页列出目录：
+//
+//	GET /files?path=builds&depth=1&glob=*.tar&sort=modified&order=desc&limit=100&cursor=...
+//
+// 返回 {"path", "entries", "next_cursor"}，没有下一页时省略 next_cursor
+func handleListDir(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	setRequestFile(r, q.dir, 0)
+
+	root := uploadDir
+	if q.dir != "" {
+		var ok bool
+		if root, ok = safeUploadPath(q.dir); !ok {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, "Not a directory", http.StatusBadRequest)
+		return
+	}
+
+	found, err := q.collect(root)
+	if err != nil {
+		logFrom(r).Error("Failed to list directory", "path", q.dir, "error", err)
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{"path": q.dir}
+	if len(found) > q.limit {
+		found = found[:q.limit]
+		resp["next_cursor"] = q.encodeCursor(found[len(found)-1])
+	}
+	entries := make([]FileEntry, 0, len(found))
+	for _, c := range found {
+		if c.mod.IsZero() {
+			if err := c.stat(); err != nil {
+				continue // 遍历后被删除
+			}
+		}
+		entries = append(entries, FileEntry{
+			Name:     path.Base(c.rel),
+			Path:     c.rel,
+			Size:     c.size,
+			Modified: c.mod,
+			IsDir:    c.isDir,
+		})
+	}
+	attachMeta(entries)
+	resp["entries"] = entries
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
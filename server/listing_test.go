@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeListingTree 创建带有相同大小和相同修改时间的文件的目录树，用于检查排序的稳定性
+func makeListingTree(t *testing.T) {
+	t.Helper()
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	files := []struct {
+		rel  string
+		size int
+		age  int // 修改时间为 base 之后的秒数
+	}{
+		{"a.txt", 10, 3},
+		{"b.txt", 10, 3},
+		{"c.bin", 300, 1},
+		{"a-b.txt", 20, 5},
+		{"dir/x.txt", 10, 2},
+		{"dir/y.txt", 50, 3},
+		{"dir/sub/z.txt", 0, 4},
+		{"dir/sub/deep/w.txt", 10, 3},
+		{"dir2/q.txt", 70, 0},
+		{"empty.txt", 0, 6},
+		{"z.txt", 300, 1},
+	}
+	for _, f := range files {
+		fullPath := filepath.Join(uploadDir, filepath.FromSlash(f.rel))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 目录的修改时间在写入文件后设置，全部相同
+	for _, f := range files {
+		mod := base.Add(time.Duration(f.age) * time.Second)
+		if err := os.Chtimes(filepath.Join(uploadDir, filepath.FromSlash(f.rel)), mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"dir", "dir2", "dir/sub", "dir/sub/deep"} {
+		if err := os.Chtimes(filepath.Join(uploadDir, dir), base, base); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listPage 请求一页列表，返回条目路径和下一页游标
+func listPage(t *testing.T, query url.Values) ([]string, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleListDir(rec, httptest.NewRequest(http.MethodGet, "/files?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /files?%s: status %d: %s", query.Encode(), rec.Code, rec.Body)
+	}
+	var resp struct {
+		Entries    []FileEntry `json:"entries"`
+		NextCursor string      `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, len(resp.Entries))
+	for i, e := range resp.Entries {
+		paths[i] = e.Path
+	}
+	return paths, resp.NextCursor
+}
+
+func TestListCursorContinuity(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	makeListingTree(t)
+
+	for _, sortBy := range []string{"name", "size", "modified"} {
+		for _, order := range []string{"asc", "desc"} {
+			for _, dirsFirst := range []string{"0", "1"} {
+				for _, depth := range []string{"1", "0"} {
+					base := url.Values{"sort": {sortBy}, "order": {order}, "dirs_first": {dirsFirst}, "depth": {depth}}
+					name := fmt.Sprintf("sort=%s,order=%s,dirs_first=%s,depth=%s", sortBy, order, dirsFirst, depth)
+					t.Run(name, func(t *testing.T) {
+						want, next := listPage(t, base)
+						if next != "" {
+							t.Fatal("single page listing returned a cursor")
+						}
+						for _, limit := range []int{1, 2, 3, 5} {
+							var got []string
+							query := url.Values{"limit": {fmt.Sprint(limit)}}
+							for k, v := range base {
+								query[k] = v
+							}
+							for pages := 0; ; pages++ {
+								if pages > len(want) {
+									t.Fatalf("limit %d: pagination does not terminate", limit)
+								}
+								paths, next := listPage(t, query)
+								if len(paths) > limit {
+									t.Fatalf("limit %d: page has %d entries", limit, len(paths))
+								}
+								got = append(got, paths...)
+								if next == "" {
+									break
+								}
+								query.Set("cursor", next)
+							}
+							if strings.Join(got, ",") != strings.Join(want, ",") {
+								t.Errorf("limit %d:\n got %v\nwant %v", limit, got, want)
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestListCursorAfterChanges(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	makeListingTree(t)
+
+	for _, sortBy := range []string{"name", "size", "modified"} {
+		t.Run(sortBy, func(t *testing.T) {
+			query := url.Values{"sort": {sortBy}, "depth": {"0"}, "type": {"file"}, "limit": {"3"}}
+			first, next := listPage(t, query)
+			if next == "" {
+				t.Fatal("no cursor")
+			}
+
+			// 翻页前游标指向的文件被删除：已返回的条目不重复，剩下的条目不遗漏
+			last := first[len(first)-1]
+			content, _ := os.ReadFile(filepath.Join(uploadDir, filepath.FromSlash(last)))
+			info, _ := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(last)))
+			if err := os.Remove(filepath.Join(uploadDir, filepath.FromSlash(last))); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				os.WriteFile(filepath.Join(uploadDir, filepath.FromSlash(last)), content, 0644)
+				os.Chtimes(filepath.Join(uploadDir, filepath.FromSlash(last)), info.ModTime(), info.ModTime())
+			}()
+
+			query.Set("limit", "1000")
+			query.Set("cursor", next)
+			rest, _ := listPage(t, query)
+			all, _ := listPage(t, url.Values{"sort": {sortBy}, "depth": {"0"}, "type": {"file"}})
+
+			seen := make(map[string]bool)
+			for _, p := range append(first[:len(first)-1], rest...) {
+				if seen[p] {
+					t.Errorf("%s returned twice", p)
+				}
+				seen[p] = true
+			}
+			for _, p := range all {
+				if !seen[p] {
+					t.Errorf("%s missing after the cursor entry was deleted", p)
+				}
+			}
+		})
+	}
+}
+
+func TestListCursorRejected(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	makeListingTree(t)
+
+	_, next := listPage(t, url.Values{"sort": {"size"}, "limit": {"2"}})
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"different sort key", url.Values{"sort": {"name"}, "cursor": {next}}},
+		{"different order", url.Values{"sort": {"size"}, "order": {"desc"}, "cursor": {next}}},
+		{"different dirs_first", url.Values{"sort": {"size"}, "dirs_first": {"1"}, "cursor": {next}}},
+		{"garbage", url.Values{"cursor": {"not-a-cursor"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleListDir(rec, httptest.NewRequest(http.MethodGet, "/files?"+tt.query.Encode(), nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
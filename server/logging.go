@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// parseLogLevel 解析日志级别：debug、info、warn、error
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// logLevelVar 当前日志级别，重新加载配置时可以修改
+var logLevelVar slog.LevelVar
+
+// initLogging 设置默认的 slog 日志器，format 为 text 或 json。
+// 标准库 log 包的输出也会经过该日志器。
+func initLogging(format, level string) error {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevelVar.Set(lvl)
+	opts := &slog.HandlerOptions{Level: &logLevelVar}
+
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q (expected text or json)", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal 记录错误并退出
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestInfo 请求级别的信息，由 requestMiddleware 写入上下文
+type requestInfo struct {
+	ID       string
+	Identity string
+	Logger   *slog.Logger
+}
+
+type requestInfoKey struct{}
+
+// requestFrom 返回当前请求的信息；不经过 requestMiddleware 的请求返回默认值
+func requestFrom(r *http.Request) *requestInfo {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info
+	}
+	return &requestInfo{Logger: slog.Default()}
+}
+
+// setRequestIdentity 在访问日志和审计记录中记录请求方身份
+func setRequestIdentity(r *http.Request, name string) {
+	requestFrom(r).Identity = name
+	if entry := auditFrom(r); entry != nil {
+		entry.Identity = name
+	}
+}
+
+// logFrom 返回带有请求 ID 的日志器
+func logFrom(r *http.Request) *slog.Logger {
+	return requestFrom(r).Logger
+}
+
+// validRequestID 只接受长度合理的可打印 ASCII，避免日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' || id[i] == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 访问日志输出，nil 表示关闭
+var (
+	accessLog      io.Writer
+	accessLogMutex sync.Mutex
+)
+
+// initAccessLog 打开访问日志："-" 表示标准输出，空字符串表示关闭，其他值为追加写入的文件
+func initAccessLog(path string) error {
+	apply, err := prepareAccessLog(path)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// prepareAccessLog 打开新的访问日志，返回的函数切换输出并关闭之前打开的文件
+func prepareAccessLog(path string) (func(), error) {
+	var w io.Writer
+	switch path {
+	case "":
+	case "-":
+		w = os.Stdout
+	default:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	}
+
+	return func() {
+		accessLogMutex.Lock()
+		previous := accessLog
+		accessLog = w
+		accessLogMutex.Unlock()
+
+		if file, ok := previous.(*os.File); ok && file != os.Stdout {
+			file.Close()
+		}
+	}, nil
+}
+
+// statusRecorder 记录状态码和响应字节数；错误响应的正文后附加请求 ID
+type statusRecorder struct {
+	http.ResponseWriter
+	requestID string
+	status    int
+	written   int64
+	annotated bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+
+	// http.Error 输出的纯文本错误，附上请求 ID 便于用户反馈问题时定位日志
+	if err == nil && !w.annotated && w.status >= 400 &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.annotated = true
+		m, _ := fmt.Fprintf(w.ResponseWriter, "request_id: %s\n", w.requestID)
+		w.written += int64(m)
+	}
+	return n, err
+}
+
+// requestMiddleware 分配请求 ID（优先使用客户端提供的 X-Request-ID），
+// 在响应头中返回，并在请求结束后写一行 nginx combined 格式的访问日志
+func requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		info := &requestInfo{ID: id, Logger: logger}
+		rec := &statusRecorder{ResponseWriter: w, requestID: id}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		writeAccessLog(r, info, rec, time.Since(start))
+	})
+}
+
+// writeAccessLog 输出一行访问日志，格式等同于 nginx 的
+// '$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_id $request_time'
+func writeAccessLog(r *http.Request, info *requestInfo, rec *statusRecorder, elapsed time.Duration) {
+	accessLogMutex.Lock()
+	enabled := accessLog != nil
+	accessLogMutex.Unlock()
+	if !enabled {
+		return
+	}
+
+	remoteAddr := "-"
+	if ip := clientIP(r); ip != nil {
+		remoteAddr = ip.String()
+	}
+	user := info.Identity
+	if user == "" {
+		user = "-"
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" %s %.3f\n",
+		remoteAddr, escapeLogField(user), time.Now().Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, escapeLogField(r.URL.RequestURI()), r.Proto, rec.status, rec.written,
+		escapeLogField(orDash(r.Referer())), escapeLogField(orDash(r.UserAgent())),
+		info.ID, elapsed.Seconds())
+
+	accessLogMutex.Lock()
+	if accessLog != nil {
+		io.WriteString(accessLog, line)
+	}
+	accessLogMutex.Unlock()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogField 与 nginx 一样转义引号、反斜杠和控制字符
+func escapeLogField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < ' ' || c > '~' {
+			fmt.Fprintf(&b, "\\x%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
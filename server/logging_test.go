@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStderr 在 fn 执行期间把标准错误重定向到临时文件，返回写入的内容；结束后恢复默认日志器
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stderr, logger, level := os.Stderr, slog.Default(), logLevelVar.Level()
+	os.Stderr = file
+	defer func() {
+		os.Stderr = stderr
+		slog.SetDefault(logger)
+		logLevelVar.Set(level)
+	}()
+	fn()
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+		ok   bool
+	}{
+		{"", slog.LevelInfo, true},
+		{"debug", slog.LevelDebug, true},
+		{"INFO", slog.LevelInfo, true},
+		{"warn", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"verbose", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseLogLevel(tt.in)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInitLogging(t *testing.T) {
+	out := captureStderr(t, func() {
+		if err := initLogging("json", "warn"); err != nil {
+			t.Fatal(err)
+		}
+		slog.Info("hidden")
+		slog.Warn("shown", "path", "builds/app.tar")
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("json output = %q, want one warn line", out)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("json output %q: %v", lines[0], err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "shown" || entry["path"] != "builds/app.tar" {
+		t.Errorf("json entry = %v", entry)
+	}
+
+	// 默认 text 格式；重新加载配置时修改 logLevelVar 立即生效
+	out = captureStderr(t, func() {
+		if err := initLogging("", ""); err != nil {
+			t.Fatal(err)
+		}
+		slog.Debug("before")
+		logLevelVar.Set(slog.LevelDebug)
+		slog.Debug("after", "path", "a b.txt")
+	})
+	if strings.Contains(out, "before") || !strings.Contains(out, `level=DEBUG msg=after path="a b.txt"`) {
+		t.Errorf("text output = %q", out)
+	}
+
+	captureStderr(t, func() {
+		if err := initLogging("xml", "info"); err == nil {
+			t.Error("invalid format accepted")
+		}
+		if err := initLogging("text", "loud"); err == nil {
+			t.Error("invalid level accepted")
+		}
+	})
+}
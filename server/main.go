@@ -1,130 +1,412 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	uploadDir    = "./uploads"
-	tempDir      = "./temp"
-	chunkSize    = 10 * 1024 * 1024   // 10MB per chunk
-	minDiskSpace = 1024 * 1024 * 1024 // 1GB 最小剩余空间
-	authHeader   = "X-Service-Key"    // 认证头
+	uploadDir  = "./uploads"
+	tempDir    = "./temp"
+	dataDir    = "./data"         // 服务器元数据（令牌等）
+	chunkSize  = 10 * 1024 * 1024 // 10MB per chunk
+	authHeader = "X-Service-Key"  // 认证头
 )
 
 type UploadStatus struct {
-	FileID      string    `json:"file_id"`
-	FileName    string    `json:"file_name"`
-	TotalSize   int64     `json:"total_size"`
-	TotalChunks int       `json:"total_chunks"`
-	ChunkSize   int64     `json:"chunk_size"`
-	Uploaded    []int     `json:"uploaded_chunks"`
-	StartTime   time.Time `json:"start_time"`
-	LastUpdate  time.Time `json:"last_update"`
-	Completed   bool      `json:"completed"`
-	Checksum    string    `json:"checksum,omitempty"`
+	FileID      string            `json:"file_id"`
+	FileName    string            `json:"file_name"`
+	TotalSize   int64             `json:"total_size"`
+	TotalChunks int               `json:"total_chunks"`
+	ChunkSize   int64             `json:"chunk_size"`
+	Uploaded    []int             `json:"uploaded_chunks"`
+	StartTime   time.Time         `json:"start_time"`
+	LastUpdate  time.Time         `json:"last_update"`
+	Completed   bool              `json:"completed"`
+	Checksum    string            `json:"checksum,omitempty"`
+	Modified    *time.Time        `json:"modified,omitempty"` // 客户端文件的修改时间，记录到元数据
+	Tags        map[string]string `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
+	FinalPath   string            `json:"-"` // 合并后的目标路径
+	Token       string            `json:"-"` // 发起上传的令牌（如有）
+	Identity    string            `json:"-"` // 发起上传的身份，用于按身份限制并发会话
 }
 
 var (
-	serviceKey     string // 服务密钥
-	uploadStatuses = make(map[string]*UploadStatus)
-	statusMutex    sync.RWMutex
+	serviceKey      string // 服务密钥
+	shutdownTracing func(context.Context) error
+	uploadStatuses  = make(map[string]*UploadStatus)
+	statusMutex     sync.RWMutex
 )
 
-// 中间件：验证服务密钥
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// 如果未设置服务密钥，跳过验证
-		if serviceKey == "" {
-			next(w, r)
-			return
-		}
+// findUpload 查找上传会话；令牌身份只能访问自己发起的会话
+func findUpload(r *http.Request, fileID string) (*UploadStatus, bool) {
+	statusMutex.RLock()
+	status, exists := uploadStatuses[fileID]
+	statusMutex.RUnlock()
 
-		// 获取请求头中的服务密钥
-		key := r.Header.Get(authHeader)
-		if key == "" {
-			http.Error(w, "Service key required", http.StatusUnauthorized)
-			return
-		}
+	if !exists {
+		return nil, false
+	}
+	if id := identityFrom(r); id.Token != nil && id.Token.Token != status.Token {
+		return nil, false
+	}
+	return status, true
+}
 
-		// 验证服务密钥
-		if key != serviceKey {
-			http.Error(w, "Invalid service key", http.StatusUnauthorized)
+// setRequestFile 在审计记录和追踪 span 上记录请求涉及的文件
+func setRequestFile(r *http.Request, path string, size int64) {
+	setAuditFile(r, path, size)
+	setSpanFile(r, path, size)
+}
+
+func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "user":
+			runUserCommand(os.Args[2:])
+			return
+		case "audit":
+			runAuditCommand(os.Args[2:])
 			return
 		}
-
-		next(w, r)
 	}
-}
 
-func main() {
 	// 定义命令行参数
+	configPath := flag.String("config", "", "Path to JSON config file (optional)")
 	host := flag.String("host", "", "Server host address (default: all interfaces)")
 	port := flag.String("port", "8080", "Server port number")
 	key := flag.String("key", "", "Service key for authentication (optional)")
+	sessionTimeout := flag.Duration("session-ttl", 8*time.Hour, "Lifetime of web login sessions")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file (enables HTTPS)")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	clientCA := flag.String("client-ca", "", "CA bundle for verifying client certificates (enables mTLS)")
+	usersPath := flag.String("users", "", "htpasswd-style users file with bcrypt hashes (enables Basic auth)")
+	traceExporter := flag.String("trace", "", "Export OpenTelemetry traces: otlp or stdout (default: disabled)")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP/HTTP collector endpoint, e.g. http://localhost:4318")
+	auditPath := flag.String("audit-log", filepath.Join(dataDir, "audit.jsonl"), "Audit log file, empty to disable")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight transfers when shutting down")
+	accessLogPath := flag.String("access-log", "-", "Access log in nginx combined format: - for stdout, a file path, or empty to disable")
+	minFreeSpaceMB := flag.Int64("min-free-space", 1024, "Free disk space in MB that uploads must leave behind")
+	readOnly := flag.Bool("read-only", false, "Start in read-only maintenance mode (uploads return 503)")
+	maxSessions := flag.Int("max-sessions", 0, "Maximum concurrent upload sessions, 0 for unlimited")
+	maxChunks := flag.Int("max-chunks", 0, "Maximum chunks being written at the same time, 0 for unlimited")
+	bandwidth := flag.String("bandwidth", "", "Total bandwidth limit per direction, e.g. 100MB (per second)")
+	trashRetention := flag.Duration("trash-retention", 7*24*time.Hour, "How long deleted and overwritten files stay in the trash, 0 to keep until purged")
+	noTrash := flag.Bool("no-trash", false, "Delete and overwrite files immediately instead of moving them to the trash")
 	flag.Parse()
 
-	// 设置服务密钥
-	serviceKey = *key
+	// 加载配置文件，显式指定的命令行参数优先；重新加载配置时同样叠加命令行参数
+	configLoader = func() (*Config, error) {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "host":
+				cfg.Host = *host
+			case "port":
+				cfg.Port = *port
+			case "key":
+				cfg.Key = *key
+			case "session-ttl":
+				cfg.SessionTTL.Duration = *sessionTimeout
+			case "tls-cert":
+				cfg.TLSCert = *tlsCert
+			case "tls-key":
+				cfg.TLSKey = *tlsKey
+			case "client-ca":
+				cfg.ClientCA = *clientCA
+			case "users":
+				cfg.UsersFile = *usersPath
+			case "audit-log":
+				cfg.Audit.File = *auditPath
+			case "trace":
+				cfg.Tracing.Exporter = *traceExporter
+			case "trace-endpoint":
+				cfg.Tracing.Endpoint = *traceEndpoint
+			case "log-format":
+				cfg.LogFormat = *logFormat
+			case "log-level":
+				cfg.LogLevel = *logLevel
+			case "access-log":
+				cfg.AccessLog = *accessLogPath
+			case "shutdown-timeout":
+				cfg.ShutdownTimeout.Duration = *shutdownTimeout
+			case "min-free-space":
+				cfg.MinFreeSpaceMB = *minFreeSpaceMB
+			case "read-only":
+				cfg.ReadOnly = *readOnly
+			case "max-sessions":
+				cfg.Limits.MaxSessions = *maxSessions
+			case "max-chunks":
+				cfg.Limits.MaxChunks = *maxChunks
+			case "trash-retention":
+				cfg.Trash.Retention.Duration = *trashRetention
+			case "no-trash":
+				cfg.Trash.Enabled = !*noTrash
+			case "bandwidth":
+				if v, perr := parseByteSize(*bandwidth); perr != nil {
+					err = fmt.Errorf("-bandwidth: %v", perr)
+				} else {
+					cfg.Limits.Bandwidth = ByteSize(v)
+				}
+			}
+		})
+		return cfg, err
+	}
+	cfg, err := configLoader()
+	if err != nil {
+		fatal("Failed to load config", "error", err)
+	}
+	if err := cfg.validate(); err != nil {
+		fatal("Invalid config", "error", err)
+	}
+
+	// 日志
+	if err := initLogging(cfg.LogFormat, cfg.LogLevel); err != nil {
+		fatal("Invalid logging config", "error", err)
+	}
+	if err := initAccessLog(cfg.AccessLog); err != nil {
+		fatal("Failed to open access log", "error", err)
+	}
+
+	// TLS 与客户端证书
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		fatal("Invalid TLS config", "error", err)
+	}
+
+	// 用户文件（HTTP Basic 认证）
+	if cfg.UsersFile != "" {
+		if err := loadUsers(cfg.UsersFile); err != nil {
+			fatal("Failed to load users file", "error", err)
+		}
+	}
+
+	// OIDC 单点登录
+	if err := initOIDC(cfg.OIDC); err != nil {
+		fatal("Invalid OIDC config", "error", err)
+	}
+
+	// 编译 IP 访问规则
+	if err := initAccess(cfg); err != nil {
+		fatal("Invalid access rules", "error", err)
+	}
+
+	// 服务密钥、会话有效期、剩余空间和只读模式，可通过 SIGHUP 或 /admin/reload 重新加载
+	applyRuntimeConfig(cfg)
 
 	// 创建必要的目录
-	for _, dir := range []string{uploadDir, tempDir} {
+	for _, dir := range []string{uploadDir, tempDir, dataDir} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Fatal("Failed to create directory:", err)
+			fatal("Failed to create directory", "error", err)
 		}
 	}
 
-	// 设置路由（添加认证中间件）
-	http.HandleFunc("/", handleWebUpload)                               // 网页上传界面
-	http.HandleFunc("/web-upload", authMiddleware(handleWebUploadFile)) // 网页文件上传处理
-	http.HandleFunc("/upload/init", authMiddleware(handleUploadInit))
-	http.HandleFunc("/upload/chunk/", authMiddleware(handleChunkUpload))
-	http.HandleFunc("/upload/status/", authMiddleware(handleUploadStatus))
-	http.HandleFunc("/upload/complete/", authMiddleware(handleUploadComplete))
-	http.HandleFunc("/download/", authMiddleware(handleDownload))
-	http.HandleFunc("/files", authMiddleware(handleListFiles))
+	// 文件元数据库，启动后在后台扫描上传目录补全记录
+	if err := openMetadata(); err != nil {
+		fatal("Failed to open metadata store", "path", metadataPath, "error", err)
+	}
+	startMetadataReconciler()
+
+	// 旧版本按路径镜像保存的历史版本迁移到新的目录布局
+	if err := migrateLegacyVersions(); err != nil {
+		fatal("Failed to migrate file versions", "path", versionsDir, "error", err)
+	}
+
+	// 定期清除回收站中过期的条目、过期的历史版本和空闲的限速令牌桶
+	startTrashPurger()
+	startVersionPruner()
+	startLimiterPruner()
+
+	// 链路追踪
+	if shutdownTracing, err = initTracing(cfg.Tracing); err != nil {
+		fatal("Failed to initialize tracing", "error", err)
+	}
+
+	// 审计日志
+	if err := initAudit(cfg.Audit); err != nil {
+		fatal("Failed to open audit log", "error", err)
+	}
+
+	// 恢复上次退出时未完成的上传会话
+	if err := loadUploadStatuses(); err != nil {
+		fatal("Failed to load upload sessions", "error", err)
+	}
+
+	// 初始化网页会话
+	if err := initSessions(cfg.SessionTTL.Duration); err != nil {
+		fatal("Failed to initialize sessions", "error", err)
+	}
+
+	// 加载上传令牌
+	if err := loadTokens(); err != nil {
+		fatal("Failed to load upload tokens", "error", err)
+	}
+
+	// 设置路由
+	registerRoutes(http.DefaultServeMux)
 
 	// 构建服务器地址
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://localhost:%s", scheme, cfg.Port)
+
 	var serverAddr string
-	if *host == "" {
+	if cfg.Host == "" {
 		// 如果未指定主机地址，使用 localhost
-		serverAddr = fmt.Sprintf(":%s", *port)
-		fmt.Printf("Server started at http://localhost:%s\n", *port)
+		serverAddr = fmt.Sprintf(":%s", cfg.Port)
 	} else {
-		serverAddr = fmt.Sprintf("%s:%s", *host, *port)
-		fmt.Printf("Server started at http://%s\n", serverAddr)
+		serverAddr = fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
+		baseURL = fmt.Sprintf("%s://%s", scheme, serverAddr)
 	}
+	slog.Info("Server started", "url", baseURL, "version", version)
 
 	// 显示认证状态
-	if serviceKey != "" {
-		fmt.Println("Service key authentication enabled")
-	} else {
-		fmt.Println("Service key authentication disabled")
+	slog.Info("Authentication",
+		"service_key", serviceKey != "",
+		"client_cert", clientCertAuth,
+		"users_file", cfg.UsersFile,
+		"oidc", oidcEnabled())
+	if cfg.Tracing.Exporter != "" {
+		slog.Info("Tracing enabled", "exporter", cfg.Tracing.Exporter)
+	}
+	if auditLog != nil {
+		slog.Info("Audit log enabled", "file", cfg.Audit.File)
+	}
+	if cfg.ReadOnly {
+		slog.Warn("Read-only maintenance mode, uploads are disabled")
+	}
+
+	for _, ep := range []struct{ name, method, path string }{
+		{"init upload", "POST", "/upload/init"},
+		{"upload chunk", "POST", "/upload/chunk/<file_id>/<chunk_number>"},
+		{"upload status", "GET", "/upload/status/<file_id>"},
+		{"complete upload", "POST", "/upload/complete/<file_id>"},
+		{"download", "GET", "/download/<filename>"},
+		{"list files", "GET", "/files"},
+		{"file versions", "GET", "/versions/<path>"},
+		{"search files", "GET", "/search"},
+		{"file metadata", "GET", "/api/metadata?path=<path>"},
+		{"edit tags", "POST", "/api/metadata/update"},
+		{"delete", "POST", "/api/delete"},
+		{"create directory", "POST", "/api/mkdir"},
+		{"move/rename", "POST", "/api/move"},
+		{"copy", "POST", "/api/copy"},
+		{"trash", "GET", "/api/trash"},
+		{"restore from trash", "POST", "/api/trash/restore"},
+		{"purge trash", "POST", "/api/trash/purge"},
+		{"upload tokens", "GET/POST", "/admin/tokens"},
+		{"reload config", "POST", "/admin/reload"},
+		{"maintenance mode", "GET/POST", "/admin/maintenance"},
+		{"reconcile metadata", "POST", "/admin/reconcile"},
+		{"drop page", "GET", "/drop/<token>"},
+		{"metrics", "GET", "/metrics"},
+		{"liveness", "GET", "/healthz"},
+		{"readiness", "GET", "/readyz"},
+		{"server info", "GET", "/api/info"},
+	} {
+		slog.Debug("Endpoint", "name", ep.name, "method", ep.method, "url", baseURL+ep.path)
+	}
+
+	server := &http.Server{
+		Addr:      serverAddr,
+		Handler:   trackRequests(tracingMiddleware(http.DefaultServeMux, requestMiddleware(accessMiddleware(http.DefaultServeMux)))),
+		ErrorLog:  slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		TLSConfig: tlsConfig,
+	}
+	// 收到 SIGINT/SIGTERM 后排空再退出；排空期间再次收到信号会立即退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serveErr <- server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	// SIGHUP 重新加载配置
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for running := true; running; {
+		select {
+		case err := <-serveErr:
+			fatal("Server stopped", "error", err)
+		case <-hup:
+			if _, err := reloadConfig(); err != nil {
+				slog.Error("Failed to reload configuration, keeping previous config", "error", err)
+			}
+		case <-ctx.Done():
+			running = false
+		}
 	}
+	stop()
+	gracefulShutdown(server, cfg.ShutdownTimeout.Duration)
+}
 
-	fmt.Println("Available endpoints:")
-	fmt.Println("  - Init Upload:    POST http://localhost:" + *port + "/upload/init")
-	fmt.Println("  - Upload Chunk:   POST http://localhost:" + *port + "/upload/chunk/<file_id>/<chunk_number>")
-	fmt.Println("  - Upload Status:  GET  http://localhost:" + *port + "/upload/status/<file_id>")
-	fmt.Println("  - Complete Upload: POST http://localhost:" + *port + "/upload/complete/<file_id>")
-	fmt.Println("  - Download:       GET  http://localhost:" + *port + "/download/<filename>")
-	fmt.Println("  - List Files:     GET  http://localhost:" + *port + "/files")
-
-	log.Fatal(http.ListenAndServe(serverAddr, nil))
+// registerRoutes 注册所有路由（添加认证中间件）
+func registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/", audited("web_page", handleWebUpload))                                                                                                            // 网页上传界面
+	mux.HandleFunc("/login", audited("login", handleLogin))                                                                                                              // 网页登录（换取会话 Cookie）
+	mux.HandleFunc("/logout", audited("logout", handleLogout))                                                                                                           // 网页注销
+	mux.HandleFunc("/session", audited("session", handleSession))                                                                                                        // 网页会话状态
+	mux.HandleFunc("/oidc/login", audited("oidc_start", handleOIDCLogin))                                                                                                // OIDC 单点登录
+	mux.HandleFunc("/oidc/callback", audited("oidc_login", handleOIDCCallback))                                                                                          // OIDC 回调
+	mux.HandleFunc("/drop/", audited("drop_page", handleDropPage))                                                                                                       // 上传令牌专用页面
+	mux.HandleFunc("/web-upload", audited("web_upload", rejectNewSessions(rejectWhenReadOnly(trackTransfer(uploadAuthMiddleware(limitTransfer(handleWebUploadFile))))))) // 网页文件上传处理
+	mux.HandleFunc("/upload/init", audited("upload_init", rejectNewSessions(rejectWhenReadOnly(uploadAuthMiddleware(handleUploadInit)))))
+	mux.HandleFunc("/upload/chunk/", audited("upload_chunk", rejectWhenReadOnly(trackTransfer(uploadAuthMiddleware(limitTransfer(handleChunkUpload))))))
+	mux.HandleFunc("/upload/status/", audited("upload_status", uploadAuthMiddleware(handleUploadStatus)))
+	mux.HandleFunc("/upload/complete/", audited("upload_complete", trackTransfer(uploadAuthMiddleware(handleUploadComplete))))
+	mux.HandleFunc("/download/", audited("download", authMiddleware(handleDownload)))
+	mux.HandleFunc("/files", audited("list", authMiddleware(handleListFiles)))
+	mux.HandleFunc("/versions/", audited("versions", authMiddleware(handleVersions)))
+	mux.HandleFunc("/search", audited("search", authMiddleware(handleSearch)))
+	mux.HandleFunc("/api/metadata", audited("metadata", authMiddleware(handleMetadata)))
+	mux.HandleFunc("/api/metadata/update", audited("metadata_update", rejectWhenReadOnly(manageMiddleware(handleMetadataUpdate))))
+	mux.HandleFunc("/api/delete", audited("delete", rejectWhenReadOnly(manageMiddleware(handleDelete))))
+	mux.HandleFunc("/api/mkdir", audited("mkdir", rejectWhenReadOnly(manageMiddleware(handleMkdir))))
+	mux.HandleFunc("/api/move", audited("move", rejectWhenReadOnly(manageMiddleware(handleMove))))
+	mux.HandleFunc("/api/copy", audited("copy", rejectWhenReadOnly(manageMiddleware(handleCopy))))
+	mux.HandleFunc("/api/trash", audited("trash_list", manageMiddleware(handleTrashList)))
+	mux.HandleFunc("/api/trash/restore", audited("trash_restore", rejectWhenReadOnly(manageMiddleware(handleTrashRestore))))
+	mux.HandleFunc("/api/trash/purge", audited("trash_purge", rejectWhenReadOnly(adminMiddleware(handleTrashPurge))))
+	mux.HandleFunc("/admin/tokens", audited("tokens", adminMiddleware(handleTokens)))
+	mux.HandleFunc("/admin/tokens/", audited("token_revoke", adminMiddleware(handleTokenRevoke)))
+	mux.HandleFunc("/admin/reload", audited("config_reload", adminMiddleware(handleReload)))
+	mux.HandleFunc("/admin/maintenance", audited("maintenance", adminMiddleware(handleMaintenance)))
+	mux.HandleFunc("/admin/reconcile", audited("reconcile", adminMiddleware(handleReconcile)))
+	mux.HandleFunc("/metrics", audited("metrics", handleMetrics()))
+	mux.HandleFunc("/healthz", audited("healthz", handleHealthz))
+	mux.HandleFunc("/readyz", audited("readyz", handleReadyz))
+	mux.HandleFunc("/api/info", audited("info", infoAuthMiddleware(handleInfo)))
 }
 
 func handleUploadInit(w http.ResponseWriter, r *http.Request) {
@@ -134,14 +416,42 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		FileName  string `json:"file_name"`
-		TotalSize int64  `json:"total_size"`
+		FileName  string     `json:"file_name"`
+		TotalSize int64      `json:"total_size"`
+		Modified  *time.Time `json:"modified,omitempty"` // 客户端文件的修改时间（可选）
+		// 上传完成后记录到文件元数据的标签和描述（可选）
+		Tags        map[string]string `json:"tags,omitempty"`
+		Description string            `json:"description,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if err := validateTags(req.Tags, req.Description); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 计算目标路径（令牌上传只能落在绑定目录内）
+	id := identityFrom(r)
+	setRequestFile(r, req.FileName, req.TotalSize)
+	finalPath, err := resolveUploadPath(id, req.FileName)
+	if err != nil {
+		http.Error(w, "Invalid file name", http.StatusBadRequest)
+		return
+	}
+	setRequestFile(r, uploadRelPath(finalPath), req.TotalSize)
+
+	// 检查令牌额度
+	var token string
+	if id.Token != nil {
+		if err := checkTokenQuota(id.Token, req.TotalSize); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		token = id.Token.Token
+	}
 
 	// 检查磁盘空间
 	if err := checkDiskSpace(req.TotalSize); err != nil {
@@ -162,9 +472,20 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 		Uploaded:    make([]int, 0),
 		StartTime:   time.Now(),
 		LastUpdate:  time.Now(),
+		Modified:    req.Modified,
+		Tags:        req.Tags,
+		Description: strings.TrimSpace(req.Description),
+		FinalPath:   finalPath,
+		Token:       token,
+		Identity:    id.Name,
 	}
 
 	statusMutex.Lock()
+	if lerr := admitSession(id.Name, fileID); lerr != nil {
+		statusMutex.Unlock()
+		rejectLimit(w, r, lerr)
+		return
+	}
 	uploadStatuses[fileID] = status
 	statusMutex.Unlock()
 
@@ -201,14 +522,19 @@ func handleChunkUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statusMutex.RLock()
-	status, exists := uploadStatuses[fileID]
-	statusMutex.RUnlock()
-
+	status, exists := findUpload(r, fileID)
 	if !exists {
 		http.Error(w, "Upload not initialized", http.StatusNotFound)
 		return
 	}
+	setRequestFile(r, uploadRelPath(status.FinalPath), status.TotalSize)
+
+	if chunkNum < 0 || chunkNum >= status.TotalChunks {
+		http.Error(w, "Invalid chunk number", http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
 
 	// 检查分片是否已上传
 	for _, uploaded := range status.Uploaded {
@@ -218,10 +544,17 @@ func handleChunkUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 保存分片
+	// 保存分片（单独的 span，区分网络接收与磁盘写入之外的耗时）
+	_, span := tracer.Start(r.Context(), "store chunk", trace.WithAttributes(
+		attribute.String("ctrans.file_id", fileID),
+		attribute.Int("ctrans.chunk", chunkNum),
+	))
+	defer span.End()
+
 	chunkPath := filepath.Join(tempDir, fileID, fmt.Sprintf("chunk_%d", chunkNum))
 	chunkFile, err := os.Create(chunkPath)
 	if err != nil {
+		spanError(span, err)
 		http.Error(w, "Failed to create chunk file", http.StatusInternalServerError)
 		return
 	}
@@ -229,8 +562,11 @@ func handleChunkUpload(w http.ResponseWriter, r *http.Request) {
 
 	// 计算分片的校验和
 	hash := sha256.New()
-	_, err = io.Copy(io.MultiWriter(chunkFile, hash), r.Body)
+	written, err := io.Copy(io.MultiWriter(chunkFile, hash), http.MaxBytesReader(w, r.Body, status.ChunkSize))
+	bytesReceived.Add(float64(written))
+	span.SetAttributes(attribute.Int64("ctrans.bytes", written))
 	if err != nil {
+		spanError(span, err)
 		http.Error(w, "Failed to save chunk", http.StatusInternalServerError)
 		return
 	}
@@ -240,6 +576,7 @@ func handleChunkUpload(w http.ResponseWriter, r *http.Request) {
 	status.Uploaded = append(status.Uploaded, chunkNum)
 	status.LastUpdate = time.Now()
 	statusMutex.Unlock()
+	chunkDuration.Observe(time.Since(start).Seconds())
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -258,10 +595,7 @@ func handleUploadStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statusMutex.RLock()
-	status, exists := uploadStatuses[fileID]
-	statusMutex.RUnlock()
-
+	status, exists := findUpload(r, fileID)
 	if !exists {
 		http.Error(w, "Upload not found", http.StatusNotFound)
 		return
@@ -273,10 +607,7 @@ func handleUploadStatus(w http.ResponseWriter, r *http.Request) {
 
 // 新增：处理分片状态请求
 func handleChunkStatus(w http.ResponseWriter, r *http.Request, fileID string) {
-	statusMutex.RLock()
-	status, exists := uploadStatuses[fileID]
-	statusMutex.RUnlock()
-
+	status, exists := findUpload(r, fileID)
 	if !exists {
 		http.Error(w, "Upload not found", http.StatusNotFound)
 		return
@@ -337,14 +668,21 @@ func handleUploadComplete(w http.ResponseWriter, r *http.Request) {
 
 	fileID := strings.TrimPrefix(r.URL.Path, "/upload/complete/")
 
-	statusMutex.RLock()
-	status, exists := uploadStatuses[fileID]
-	statusMutex.RUnlock()
-
+	status, exists := findUpload(r, fileID)
 	if !exists {
 		http.Error(w, "Upload not found", http.StatusNotFound)
 		return
 	}
+	setRequestFile(r, uploadRelPath(status.FinalPath), status.TotalSize)
+
+	completed := false
+	defer func() {
+		if completed {
+			uploadsCompleted.WithLabelValues("chunked").Inc()
+		} else {
+			uploadsFailed.WithLabelValues("chunked").Inc()
+		}
+	}()
 
 	// 检查是否所有分片都已上传
 	if len(status.Uploaded) != status.TotalChunks {
@@ -352,41 +690,79 @@ func handleUploadComplete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 令牌上传在合并前计入额度，合并失败时退回
+	id := identityFrom(r)
+	if id.Token != nil {
+		if err := reserveTokenBytes(id.Token, status.TotalSize); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		defer func() {
+			if !completed {
+				releaseTokenBytes(id.Token, status.TotalSize)
+			}
+		}()
+	}
+
 	// 合并文件
-	finalPath := filepath.Join(uploadDir, status.FileName)
-	finalFile, err := os.Create(finalPath)
+	if err := os.MkdirAll(filepath.Dir(status.FinalPath), 0755); err != nil {
+		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
+		return
+	}
+	pending, err := createPending(status.FinalPath)
 	if err != nil {
 		http.Error(w, "Failed to create final file", http.StatusInternalServerError)
 		return
 	}
-	defer finalFile.Close()
+	defer pending.discard()
 
 	// 按顺序合并分片
+	_, span := tracer.Start(r.Context(), "merge chunks", trace.WithAttributes(
+		attribute.String("ctrans.file_id", fileID),
+		attribute.Int("ctrans.chunks", status.TotalChunks),
+	))
 	hash := sha256.New()
 	for i := 0; i < status.TotalChunks; i++ {
 		chunkPath := filepath.Join(tempDir, fileID, fmt.Sprintf("chunk_%d", i))
 		chunkFile, err := os.Open(chunkPath)
 		if err != nil {
+			spanError(span, err)
+			span.End()
 			http.Error(w, "Failed to read chunk", http.StatusInternalServerError)
 			return
 		}
 
-		_, err = io.Copy(io.MultiWriter(finalFile, hash), chunkFile)
+		_, err = io.Copy(io.MultiWriter(pending, hash), chunkFile)
 		chunkFile.Close()
 		if err != nil {
+			spanError(span, err)
+			span.End()
 			http.Error(w, "Failed to write chunk", http.StatusInternalServerError)
 			return
 		}
 	}
+	span.End()
+
+	// 保留旧文件（历史版本或回收站）后替换
+	if err := pending.commit(r); err != nil {
+		logFrom(r).Error("Failed to store merged file", "error", err)
+		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
 
 	// 更新状态
 	statusMutex.Lock()
 	status.Completed = true
 	status.Checksum = hex.EncodeToString(hash.Sum(nil))
 	statusMutex.Unlock()
+	if entry := auditFrom(r); entry != nil {
+		entry.Checksum = status.Checksum
+	}
+	recordUpload(r, status.FinalPath, status.Checksum, status.Modified, status.Tags, status.Description)
 
 	// 清理临时文件
 	os.RemoveAll(filepath.Join(tempDir, fileID))
+	completed = true
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -401,27 +777,30 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取文件路径（可能包含目录）
+	// 获取文件路径（可能包含目录）；r.URL.Path 已经解码，不能再次解码，否则文件名中的 + 和 % 会被改写
 	filePath := strings.TrimPrefix(r.URL.Path, "/download/")
 	if filePath == "" {
 		http.Error(w, "File path not provided", http.StatusBadRequest)
 		return
 	}
 
-	// URL解码
-	filePath, err := url.QueryUnescape(filePath)
-	if err != nil {
+	setRequestFile(r, filePath, 0)
+
+	// 构建完整的文件路径，确保文件在上传目录内
+	fullPath, ok := safeUploadPath(filePath)
+	if !ok {
 		http.Error(w, "Invalid file path", http.StatusBadRequest)
 		return
 	}
 
-	// 构建完整的文件路径
-	fullPath := filepath.Join(uploadDir, filePath)
-
-	// 安全检查：确保文件在上传目录内
-	if !strings.HasPrefix(fullPath, filepath.Clean(uploadDir)+string(os.PathSeparator)) {
-		http.Error(w, "Invalid file path", http.StatusBadRequest)
-		return
+	// 下载历史版本：/download/<path>?version=<id>
+	version := r.URL.Query().Get("version")
+	if version != "" {
+		var err error
+		if fullPath, err = versionFile(uploadRelPath(fullPath), version); err != nil {
+			http.Error(w, "Version not found", http.StatusNotFound)
+			return
+		}
 	}
 
 	// 检查文件是否存在
@@ -436,11 +815,37 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cannot download directory", http.StatusBadRequest)
 		return
 	}
+	setRequestFile(r, filePath, fileInfo.Size())
 
-	// 设置基本响应头
+	// 设置基本响应头；元数据库中有记录时使用记录的文件类型并带上校验和，否则按文件名和内容判断
+	// （历史版本的文件没有扩展名，按原文件名判断）
 	filename := filepath.Base(filePath)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	w.Header().Set("Content-Type", "application/octet-stream")
+	contentType := ""
+	if version == "" {
+		if meta := lookupMeta(uploadRelPath(fullPath), fileInfo); meta != nil {
+			contentType = meta.ContentType
+			w.Header().Set("X-Checksum-Sha256", meta.SHA256)
+		}
+	}
+	if contentType == "" {
+		if contentType = typeByExtension(filename); contentType == "" {
+			contentType = sniffContentType(fullPath)
+		}
+	}
+
+	// ?inline=1 在浏览器中直接打开日志、图片、PDF 和视频，其他类型仍然作为附件下载
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "1" {
+		if ct, sandbox := inlineContentType(contentType); ct != "" {
+			disposition, contentType = "inline", ct
+			if sandbox {
+				w.Header().Set("Content-Security-Policy", "sandbox")
+			}
+		}
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, filename))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
 	w.Header().Set("Accept-Ranges", "bytes")
 
@@ -448,10 +853,12 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodHead {
 		return
 	}
+	w = countingResponseWriter{throttleDownload(w, r), bytesSent}
 
 	// 支持断点续传
 	rangeHeader := r.Header.Get("Range")
 	if rangeHeader != "" {
+		rangeRequests.Inc()
 		handleRangeDownload(w, r, fullPath, fileInfo, rangeHeader)
 		return
 	}
@@ -484,7 +891,6 @@ func handleRangeDownload(w http.ResponseWriter, r *http.Request, filepath string
 	// 设置响应头
 	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileInfo.Size()))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", end-start+1))
-	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Accept-Ranges", "bytes")
 	w.WriteHeader(http.StatusPartialContent)
 
@@ -497,7 +903,7 @@ func handleRangeDownload(w http.ResponseWriter, r *http.Request, filepath string
 	// 发送数据
 	_, err = io.CopyN(w, file, end-start+1)
 	if err != nil {
-		log.Printf("Error sending file: %v", err)
+		logFrom(r).Warn("Error sending file", "path", filepath, "error", err)
 		return
 	}
 }
@@ -508,15 +914,13 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type FileInfo struct {
-		Name     string    `json:"name"`
-		Path     string    `json:"path"`
-		Size     int64     `json:"size"`
-		Modified time.Time `json:"modified"`
-		IsDir    bool      `json:"is_dir"`
+	// 带查询参数时分页列出指定目录；不带参数时保持旧版本的行为，一次返回整个上传目录
+	if r.URL.RawQuery != "" {
+		handleListDir(w, r)
+		return
 	}
 
-	var fileInfos []FileInfo
+	var fileInfos []FileEntry
 
 	// 递归遍历上传目录
 	err := filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
@@ -524,8 +928,8 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		// 跳过根目录本身
-		if path == uploadDir {
+		// 跳过根目录本身和正在写入的临时文件
+		if path == uploadDir || (!info.IsDir() && isPartialName(info.Name())) {
 			return nil
 		}
 
@@ -535,7 +939,7 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		fileInfos = append(fileInfos, FileInfo{
+		fileInfos = append(fileInfos, FileEntry{
 			Name:     info.Name(),
 			Path:     strings.ReplaceAll(relPath, "\\", "/"), // 统一使用斜杠
 			Size:     info.Size(),
@@ -551,6 +955,7 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attachMeta(fileInfos)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(fileInfos)
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chdirTemp 切换到临时目录并创建 uploads、temp、data，测试结束后切换回来。
+// uploadDir 等是相对当前目录的常量，使用它的测试不能并行
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	for _, d := range []string{uploadDir, tempDir, dataDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// openTestMetadata 在 chdirTemp 创建的数据目录中打开元数据库，测试结束后关闭
+func openTestMetadata(t *testing.T) {
+	t.Helper()
+	if err := openMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		closeMetadata()
+		metadataDB = nil
+	})
+}
+
+// newTestServer 用和 main 相同的路由启动测试服务器
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	srv := httptest.NewServer(requestMiddleware(accessMiddleware(mux)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// setServiceKey 启用服务密钥认证，测试结束后恢复
+func setServiceKey(t *testing.T, key string) {
+	t.Helper()
+	configMutex.Lock()
+	previous := serviceKey
+	serviceKey = key
+	configMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		serviceKey = previous
+		configMutex.Unlock()
+	})
+}
+
+func TestHandleDownloadPaths(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	files := map[string]string{
+		"a+b c.txt":        "plus and space",
+		"100%.txt":         "percent",
+		"dir/report 1.log": "nested",
+		"%41.txt":          "escaped-looking name",
+		"builds/x+y/z.bin": "plus in directory",
+	}
+	for name, content := range files {
+		fullPath := filepath.Join(uploadDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/download/a+b%20c.txt", http.StatusOK, "plus and space"},
+		{"/download/a%2Bb%20c.txt", http.StatusOK, "plus and space"},
+		{"/download/100%25.txt", http.StatusOK, "percent"},
+		{"/download/dir/report%201.log", http.StatusOK, "nested"},
+		{"/download/%2541.txt", http.StatusOK, "escaped-looking name"},
+		{"/download/builds/x+y/z.bin", http.StatusOK, "plus in directory"},
+		{"/download/ab%20c.txt", http.StatusNotFound, ""},
+		{"/download/..%2F..%2Fetc%2Fpasswd", http.StatusBadRequest, ""},
+		{"/download/", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleDownload(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestUploadCompleteReplacesAtomically(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	applyTrash(TrashConfig{Enabled: true})
+	t.Cleanup(func() { applyTrash(TrashConfig{}) })
+	target := filepath.Join(uploadDir, "report.txt")
+	if err := os.WriteFile(target, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// start 创建上传会话，chunks 为磁盘上实际存在的分片
+	start := func(fileID string, total int, chunks ...string) {
+		t.Helper()
+		status := &UploadStatus{FileID: fileID, FileName: "report.txt", TotalChunks: total, FinalPath: target}
+		for i, chunk := range chunks {
+			if err := os.MkdirAll(filepath.Join(tempDir, fileID), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(tempDir, fileID, fmt.Sprintf("chunk_%d", i)), []byte(chunk), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < total; i++ {
+			status.Uploaded = append(status.Uploaded, i)
+		}
+		statusMutex.Lock()
+		uploadStatuses[fileID] = status
+		statusMutex.Unlock()
+		t.Cleanup(func() {
+			statusMutex.Lock()
+			delete(uploadStatuses, fileID)
+			statusMutex.Unlock()
+		})
+	}
+	complete := func(fileID string) int {
+		rec := httptest.NewRecorder()
+		handleUploadComplete(rec, httptest.NewRequest(http.MethodPost, "/upload/complete/"+fileID, nil))
+		return rec.Code
+	}
+	leftovers := func() []string {
+		var names []string
+		entries, _ := os.ReadDir(uploadDir)
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".uploading-") {
+				names = append(names, e.Name())
+			}
+		}
+		return names
+	}
+
+	// 合并到一半失败（分片丢失）：原文件不变，也没有移入回收站
+	start("broken", 2, "new ")
+	if code := complete("broken"); code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", code, http.StatusInternalServerError)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "original" {
+		t.Errorf("target after a failed merge = %q, want the original", data)
+	}
+	if entries, _ := listTrash(); len(entries) != 0 {
+		t.Errorf("%d trash entries after a failed merge", len(entries))
+	}
+	if names := leftovers(); len(names) != 0 {
+		t.Errorf("temporary files left behind: %v", names)
+	}
+
+	start("ok", 2, "new ", "content")
+	if code := complete("ok"); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	data, _ := os.ReadFile(target)
+	info, _ := os.Stat(target)
+	if string(data) != "new content" || info.Mode().Perm() != 0644 {
+		t.Errorf("target = %q (mode %v), want the merged content with mode 0644", data, info.Mode().Perm())
+	}
+	if entries, _ := listTrash(); len(entries) != 1 || entries[0].Reason != "overwrite" {
+		t.Errorf("trash = %+v, want the overwritten original", entries)
+	}
+	if names := leftovers(); len(names) != 0 {
+		t.Errorf("temporary files left behind: %v", names)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = 300 // 只读模式下建议客户端重试的间隔（秒）
+
+// MaintenanceState 只读维护模式的状态
+type MaintenanceState struct {
+	ReadOnly   bool       `json:"read_only"`
+	Message    string     `json:"message,omitempty"`     // 返回给客户端的说明
+	RetryAfter int        `json:"retry_after,omitempty"` // 秒
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+var (
+	maintenance      MaintenanceState
+	maintenanceMutex sync.RWMutex
+)
+
+// currentMaintenance 返回当前的维护状态
+func currentMaintenance() MaintenanceState {
+	maintenanceMutex.RLock()
+	defer maintenanceMutex.RUnlock()
+	return maintenance
+}
+
+// setReadOnly 切换只读模式；retryAfter 为 0 时使用默认值
+func setReadOnly(enabled bool, message string, retryAfter int) {
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	maintenanceMutex.Lock()
+	if enabled {
+		since := maintenance.Since
+		if since == nil {
+			now := time.Now()
+			since = &now
+		}
+		maintenance = MaintenanceState{ReadOnly: true, Message: message, RetryAfter: retryAfter, Since: since}
+	} else {
+		maintenance = MaintenanceState{}
+	}
+	maintenanceMutex.Unlock()
+
+	slog.Warn("Maintenance mode changed", "read_only", enabled, "message", message)
+}
+
+// rejectWhenReadOnly 中间件：只读维护模式下拒绝上传，返回 503 和 Retry-After
+func rejectWhenReadOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := currentMaintenance()
+		if state.ReadOnly {
+			msg := "Server is in read-only maintenance mode, uploads are disabled"
+			if state.Message != "" {
+				msg += ": " + state.Message
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+			// 客户端据此区分维护模式和临时繁忙，不必按 Retry-After 反复等待
+			w.Header().Set("X-Maintenance", "read-only")
+			http.Error(w, msg, http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleMaintenance 管理接口：GET 查看、POST 切换只读维护模式
+//
+//	POST /admin/maintenance {"read_only": true, "message": "migrating storage", "retry_after": 600}
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			ReadOnly   bool   `json:"read_only"`
+			Message    string `json:"message"`
+			RetryAfter int    `json:"retry_after"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.RetryAfter < 0 {
+			http.Error(w, "retry_after must not be negative", http.StatusBadRequest)
+			return
+		}
+		setReadOnly(req.ReadOnly, req.Message, req.RetryAfter)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentMaintenance())
+}
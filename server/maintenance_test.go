@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyMaintenance(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	t.Cleanup(func() { setReadOnly(false, "", 0) })
+	if err := os.WriteFile(filepath.Join(uploadDir, "app.tar"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t)
+
+	do := func(method, path, body string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	resp, body := do(http.MethodPost, "/admin/maintenance", `{"read_only":true,"message":"migrating storage","retry_after":600}`)
+	var state MaintenanceState
+	if err := json.Unmarshal([]byte(body), &state); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("enable: status %d: %s", resp.StatusCode, body)
+	}
+	if !state.ReadOnly || state.Message != "migrating storage" || state.RetryAfter != 600 || state.Since == nil {
+		t.Errorf("state = %+v", state)
+	}
+
+	// 写操作返回 503、Retry-After 和维护说明
+	for _, w := range []struct{ path, body string }{
+		{"/upload/init", `{"file_name":"new.txt","total_size":3}`},
+		{"/api/mkdir", `{"path":"builds"}`},
+		{"/api/delete", `{"path":"app.tar"}`},
+	} {
+		resp, body := do(http.MethodPost, w.path, w.body)
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "600" || resp.Header.Get("X-Maintenance") != "read-only" {
+			t.Errorf("%s: status %d, Retry-After %q, X-Maintenance %q", w.path, resp.StatusCode, resp.Header.Get("Retry-After"), resp.Header.Get("X-Maintenance"))
+		}
+		if !strings.HasPrefix(body, "Server is in read-only maintenance mode, uploads are disabled: migrating storage\n") {
+			t.Errorf("%s: body %q does not carry the maintenance message", w.path, body)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, "app.tar")); err != nil {
+		t.Errorf("file deleted in read-only mode: %v", err)
+	}
+
+	// 下载、列表和服务器信息不受影响
+	if resp, body := do(http.MethodGet, "/download/app.tar", ""); resp.StatusCode != http.StatusOK || body != "app" {
+		t.Errorf("download: status %d, body %q", resp.StatusCode, body)
+	}
+	if resp, _ := do(http.MethodGet, "/files?path=", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("list: status %d", resp.StatusCode)
+	}
+	resp, body = do(http.MethodGet, "/api/info", "")
+	var info struct {
+		ReadOnly bool   `json:"read_only"`
+		Message  string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &info); err != nil || !info.ReadOnly || info.Message != "migrating storage" {
+		t.Errorf("info: status %d: %s", resp.StatusCode, body)
+	}
+
+	// 再次开启时保留开始时间；retry_after 不能为负
+	resp, body = do(http.MethodPost, "/admin/maintenance", `{"read_only":true,"message":"still migrating"}`)
+	var again MaintenanceState
+	json.Unmarshal([]byte(body), &again)
+	if again.Since == nil || !again.Since.Equal(*state.Since) || again.RetryAfter != defaultRetryAfter {
+		t.Errorf("re-enable: %+v, want since %v and default retry_after", again, state.Since)
+	}
+	if resp, _ := do(http.MethodPost, "/admin/maintenance", `{"read_only":true,"retry_after":-1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("negative retry_after: status %d, want 400", resp.StatusCode)
+	}
+
+	resp, body = do(http.MethodPost, "/admin/maintenance", `{"read_only":false}`)
+	if resp.StatusCode != http.StatusOK || strings.Contains(body, "since") {
+		t.Errorf("disable: status %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := do(http.MethodPost, "/upload/init", `{"file_name":"new.txt","total_size":3}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("upload after maintenance: status %d: %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileMeta 上传目录中一个文件的元数据，保存在 data/metadata.db（bbolt），以相对路径为键
+type FileMeta struct {
+	Path             string     `json:"path"`
+	Size             int64      `json:"size"`
+	SHA256           string     `json:"sha256"`
+	UploadedBy       string     `json:"uploaded_by,omitempty"` // 空表示由扫描发现，不知道上传者
+	UploadedAt       time.Time  `json:"uploaded_at"`
+	OriginalModified *time.Time `json:"original_modified,omitempty"` // 客户端上传的文件的修改时间
+	ContentType      string     `json:"content_type"`
+	FileModTime      time.Time  `json:"file_mtime"` // 记录时服务器上文件的修改时间，和大小一起判断记录是否过期
+
+	// 用户添加的标签（如 build=1234）和描述，上传时设置，之后可以通过 /api/metadata/update 修改
+	Tags        map[string]string `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+// matches 文件大小和修改时间与记录一致时记录才有效，文件被其他方式改动过后需要重新扫描
+func (m *FileMeta) matches(size int64, modified time.Time) bool {
+	return m != nil && m.Size == size && m.FileModTime.Equal(modified)
+}
+
+var (
+	metadataPath  = filepath.Join(dataDir, "metadata.db")
+	metadataDB    *bolt.DB
+	filesBucket   = []byte("files")
+	reconcileLock sync.Mutex // 同一时间只运行一次全量扫描
+)
+
+// openMetadata 打开元数据库；另一个进程正在使用时等待 1 秒后报错
+func openMetadata() error {
+	db, err := bolt.Open(metadataPath, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return errors.New("database is locked, is another server running in this directory?")
+	}
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(filesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	metadataDB = db
+	return nil
+}
+
+func closeMetadata() {
+	if metadataDB != nil {
+		metadataDB.Close()
+	}
+}
+
+func putMeta(tx *bolt.Tx, m *FileMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(filesBucket).Put([]byte(m.Path), data)
+}
+
+func decodeMeta(data []byte) *FileMeta {
+	var m FileMeta
+	if json.Unmarshal(data, &m) != nil {
+		return nil
+	}
+	return &m
+}
+
+// lookupMeta 返回文件的有效元数据，没有记录或记录已过期时返回 nil
+func lookupMeta(rel string, info os.FileInfo) *FileMeta {
+	var m *FileMeta
+	metadataDB.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(filesBucket).Get([]byte(rel)); data != nil {
+			m = decodeMeta(data)
+		}
+		return nil
+	})
+	if !m.matches(info.Size(), info.ModTime()) {
+		return nil
+	}
+	return m
+}
+
+// metaUnder 返回目录下（dir 为空时整个上传目录）所有文件的记录，不检查是否过期
+func metaUnder(dir string) map[string]*FileMeta {
+	metas := make(map[string]*FileMeta)
+	prefix := []byte(dir)
+	if dir != "" {
+		prefix = append(prefix, '/')
+	}
+	metadataDB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(filesBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if m := decodeMeta(v); m != nil {
+				metas[string(k)] = m
+			}
+		}
+		return nil
+	})
+	return metas
+}
+
+// attachMeta 把有效的元数据填入列表条目
+func attachMeta(entries []FileEntry) {
+	metadataDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		for i := range entries {
+			e := &entries[i]
+			if e.IsDir {
+				continue
+			}
+			if data := b.Get([]byte(e.Path)); data != nil {
+				if m := decodeMeta(data); m.matches(e.Size, e.Modified) {
+					e.setMeta(m)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// recordUpload 上传完成后记录文件的元数据；original 为客户端文件的修改时间（可为 nil）
+func recordUpload(r *http.Request, fullPath, checksum string, original *time.Time, tags map[string]string, description string) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return
+	}
+	m := &FileMeta{
+		Path:             uploadRelPath(fullPath),
+		Size:             info.Size(),
+		SHA256:           checksum,
+		UploadedBy:       identityFrom(r).Name,
+		UploadedAt:       time.Now().UTC(),
+		OriginalModified: original,
+		ContentType:      detectContentType(fullPath),
+		FileModTime:      info.ModTime(),
+		Tags:             tags,
+		Description:      description,
+	}
+	if err := metadataDB.Update(func(tx *bolt.Tx) error { return putMeta(tx, m) }); err != nil {
+		logFrom(r).Error("Failed to record file metadata", "path", m.Path, "error", err)
+	}
+}
+
+// forEachUnder 对 rel 本身及其下所有记录调用 fn（rel 是目录时）
+func forEachUnder(tx *bolt.Tx, rel string, fn func(key []byte, m *FileMeta) error) error {
+	b := tx.Bucket(filesBucket)
+	var keys [][]byte
+	if b.Get([]byte(rel)) != nil {
+		keys = append(keys, []byte(rel))
+	}
+	prefix := []byte(rel + "/")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	// 先收集键再处理，避免遍历时修改 bucket
+	for _, k := range keys {
+		m := decodeMeta(b.Get(k))
+		if err := fn(k, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMeta 删除文件或目录后删除对应的记录
+func removeMeta(rel string) {
+	err := metadataDB.Update(func(tx *bolt.Tx) error {
+		return forEachUnder(tx, rel, func(key []byte, _ *FileMeta) error {
+			return tx.Bucket(filesBucket).Delete(key)
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to remove file metadata", "path", rel, "error", err)
+	}
+}
+
+// renameMeta 移动文件或目录后更新记录的路径（重命名不改变修改时间，记录保持有效）
+func renameMeta(from, to string) {
+	removeMeta(to)
+	err := metadataDB.Update(func(tx *bolt.Tx) error {
+		return forEachUnder(tx, from, func(key []byte, m *FileMeta) error {
+			if err := tx.Bucket(filesBucket).Delete(key); err != nil || m == nil {
+				return err
+			}
+			m.Path = to + strings.TrimPrefix(string(key), from)
+			return putMeta(tx, m)
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to move file metadata", "from", from, "to", to, "error", err)
+	}
+}
+
+// copyMeta 复制文件或目录后为副本建立记录，沿用原文件的上传者和校验和
+func copyMeta(from, to string) {
+	removeMeta(to)
+	err := metadataDB.Update(func(tx *bolt.Tx) error {
+		return forEachUnder(tx, from, func(key []byte, m *FileMeta) error {
+			if m == nil {
+				return nil
+			}
+			fullPath, ok := safeUploadPath(to + strings.TrimPrefix(string(key), from))
+			if !ok {
+				return nil
+			}
+			info, err := os.Stat(fullPath)
+			if err != nil || info.Size() != m.Size {
+				return nil // 源记录已过期，交给扫描处理
+			}
+			m.Path, m.FileModTime = uploadRelPath(fullPath), info.ModTime()
+			return putMeta(tx, m)
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to copy file metadata", "from", from, "to", to, "error", err)
+	}
+}
+
+// metaRecords 返回文件或目录（含其下所有文件）的记录
+func metaRecords(rel string) []*FileMeta {
+	var records []*FileMeta
+	metadataDB.View(func(tx *bolt.Tx) error {
+		return forEachUnder(tx, rel, func(_ []byte, m *FileMeta) error {
+			if m != nil {
+				records = append(records, m)
+			}
+			return nil
+		})
+	})
+	return records
+}
+
+// restoreMeta 把之前保存的记录写回到 to 下（原来位于 from 下）。
+// 跨文件系统恢复时文件的修改时间会改变，大小一致时沿用记录中的校验和，否则交给扫描处理
+func restoreMeta(records []*FileMeta, from, to string) {
+	removeMeta(to)
+	err := metadataDB.Update(func(tx *bolt.Tx) error {
+		for _, m := range records {
+			fullPath, ok := safeUploadPath(to + strings.TrimPrefix(m.Path, from))
+			if !ok {
+				continue
+			}
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				continue
+			}
+			m.Path = uploadRelPath(fullPath)
+			if info.Size() == m.Size {
+				m.FileModTime = info.ModTime()
+			}
+			if err := putMeta(tx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to restore file metadata", "from", from, "to", to, "error", err)
+	}
+}
+
+// indexFile 为没有有效记录的文件计算校验和并记录，过期记录上的标签和描述保留；计算期间文件被改动或已有新记录时放弃
+func indexFile(fullPath string, info os.FileInfo) (bool, error) {
+	checksum, err := fileSHA256(fullPath)
+	if err != nil {
+		return false, err
+	}
+	m := &FileMeta{
+		Path:        uploadRelPath(fullPath),
+		Size:        info.Size(),
+		SHA256:      checksum,
+		UploadedAt:  info.ModTime().UTC(),
+		ContentType: detectContentType(fullPath),
+		FileModTime: info.ModTime(),
+	}
+
+	indexed := false
+	err = metadataDB.Update(func(tx *bolt.Tx) error {
+		current, err := os.Stat(fullPath)
+		if err != nil || !m.matches(current.Size(), current.ModTime()) {
+			return nil
+		}
+		if data := tx.Bucket(filesBucket).Get([]byte(m.Path)); data != nil {
+			old := decodeMeta(data)
+			if old.matches(m.Size, m.FileModTime) {
+				return nil
+			}
+			if old != nil {
+				m.Tags, m.Description = old.Tags, old.Description
+			}
+		}
+		indexed = true
+		return putMeta(tx, m)
+	})
+	return indexed, err
+}
+
+// reconcileMetadata 让元数据与文件系统保持一致：为新出现或被改动的文件建立记录，删除已不存在的文件的记录
+func reconcileMetadata() (indexed, removed int, err error) {
+	reconcileLock.Lock()
+	defer reconcileLock.Unlock()
+
+	metas := metaUnder("")
+	seen := make(map[string]bool, len(metas))
+	err = filepath.WalkDir(uploadDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // 扫描期间被删除
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || isPartialName(d.Name()) {
+			return nil // 正在写入的临时文件不建立记录
+		}
+		rel := uploadRelPath(p)
+		seen[rel] = true
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if metas[rel].matches(info.Size(), info.ModTime()) {
+			return nil
+		}
+		ok, err := indexFile(p, info)
+		if err != nil {
+			slog.Warn("Failed to index file", "path", rel, "error", err)
+			return nil
+		}
+		if ok {
+			indexed++
+		}
+		return nil
+	})
+	if err != nil {
+		return indexed, removed, err
+	}
+
+	err = metadataDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		for rel := range metas {
+			if seen[rel] {
+				continue
+			}
+			// 扫描开始后才上传的文件不在 seen 中，删除前再确认一次
+			if fullPath, ok := safeUploadPath(rel); ok {
+				if info, err := os.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+					continue
+				}
+			}
+			if err := b.Delete([]byte(rel)); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return indexed, removed, err
+}
+
+// startMetadataReconciler 启动时和之后每小时扫描一次上传目录
+func startMetadataReconciler() {
+	go func() {
+		for {
+			start := time.Now()
+			indexed, removed, err := reconcileMetadata()
+			if err != nil {
+				slog.Error("Failed to reconcile file metadata", "error", err)
+			} else if indexed > 0 || removed > 0 {
+				slog.Info("Reconciled file metadata", "indexed", indexed, "removed", removed, "duration", time.Since(start))
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// handleReconcile 管理接口：POST /admin/reconcile 立即扫描上传目录（例如直接修改了 uploads/ 之后）
+func handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	indexed, removed, err := reconcileMetadata()
+	if err != nil {
+		logFrom(r).Error("Failed to reconcile file metadata", "error", err)
+		http.Error(w, "Failed to reconcile file metadata", http.StatusInternalServerError)
+		return
+	}
+	logFrom(r).Info("Reconciled file metadata", "indexed", indexed, "removed", removed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"indexed": indexed, "removed": removed})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus 指标
+var (
+	bytesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ctrans_bytes_received_total",
+		Help: "Bytes of file data received from clients (chunks and web uploads).",
+	})
+	bytesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ctrans_bytes_sent_total",
+		Help: "Bytes of file data sent to clients by downloads.",
+	})
+	chunkDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ctrans_chunk_upload_duration_seconds",
+		Help:    "Time taken to receive and store one upload chunk.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+	uploadsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ctrans_uploads_completed_total",
+		Help: "Uploads that were assembled and stored successfully.",
+	}, []string{"type"})
+	uploadsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ctrans_uploads_failed_total",
+		Help: "Uploads that failed while being completed or stored.",
+	}, []string{"type"})
+	rangeRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ctrans_download_range_requests_total",
+		Help: "Download requests with a Range header (resumed downloads).",
+	})
+	authFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ctrans_auth_failures_total",
+		Help: "Failed authentication attempts.",
+	})
+	limitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ctrans_limit_rejections_total",
+		Help: "Requests rejected by admission control, by the limit that was reached.",
+	}, []string{"limit"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ctrans_active_uploads",
+		Help: "Upload sessions that have been initialized but not completed.",
+	}, func() float64 {
+		active, _ := uploadStats()
+		return float64(active)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ctrans_reserved_bytes",
+		Help: "Bytes still expected by in-progress uploads.",
+	}, func() float64 {
+		_, reserved := uploadStats()
+		return float64(reserved)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ctrans_disk_free_bytes",
+		Help: "Free space available to the upload directory.",
+	}, func() float64 {
+		free, err := diskFreeSpace()
+		if err != nil {
+			return -1
+		}
+		return float64(free)
+	})
+}
+
+// uploadStats 统计进行中的上传会话数量和尚未收到的字节数
+func uploadStats() (active int, reserved int64) {
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+
+	for _, status := range uploadStatuses {
+		if status.Completed {
+			continue
+		}
+		active++
+		remaining := status.TotalSize - int64(len(status.Uploaded))*status.ChunkSize
+		if remaining > 0 {
+			reserved += remaining
+		}
+	}
+	return active, reserved
+}
+
+// countingResponseWriter 统计下载发送的字节数
+type countingResponseWriter struct {
+	http.ResponseWriter
+	counter prometheus.Counter
+}
+
+func (w countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.counter.Add(float64(n))
+	return n, err
+}
+
+// defaultMetricsAllow metrics_access 没有设置 allow 时只允许本机访问 /metrics，
+// 需要远程抓取时在 allow 中明确列出 Prometheus 的地址
+var defaultMetricsAllow = []string{"127.0.0.0/8", "::1"}
+
+var metricsAccess, _ = compileAccessRules(AccessRules{Allow: defaultMetricsAllow})
+
+// handleMetrics 输出 Prometheus 指标，只受 metrics_access 规则限制，不需要认证
+func handleMetrics() http.HandlerFunc {
+	handler := promhttp.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		configMutex.RLock()
+		rule := metricsAccess
+		configMutex.RUnlock()
+		if !rule.permits(clientIP(r)) {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
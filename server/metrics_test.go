@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics 以 remoteAddr 为来源请求 /metrics
+func scrapeMetrics(remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	handleMetrics()(rec, req)
+	return rec
+}
+
+func TestMetricsAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  AccessRules
+		remote string
+		status int
+	}{
+		{"default allows loopback", AccessRules{}, "127.0.0.1:5000", http.StatusOK},
+		{"default allows IPv6 loopback", AccessRules{}, "[::1]:5000", http.StatusOK},
+		{"default denies remote", AccessRules{}, "10.0.0.5:5000", http.StatusForbidden},
+		{"deny only keeps the loopback default", AccessRules{Deny: []string{"192.168.0.0/16"}}, "10.0.0.5:5000", http.StatusForbidden},
+		{"explicit allow", AccessRules{Allow: []string{"10.0.0.0/8"}}, "10.0.0.5:5000", http.StatusOK},
+		{"explicit allow replaces loopback", AccessRules{Allow: []string{"10.0.0.0/8"}}, "127.0.0.1:5000", http.StatusForbidden},
+		{"deny wins over allow", AccessRules{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.5.0/24"}}, "10.0.5.1:5000", http.StatusForbidden},
+		{"opened to all", AccessRules{Allow: []string{"0.0.0.0/0", "::/0"}}, "203.0.113.9:5000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyAccess(t, &Config{MetricsAccess: tt.rules})
+			if rec := scrapeMetrics(tt.remote); rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+
+	// 加载配置之前的初始规则也只允许本机
+	if code := scrapeMetrics("10.0.0.5:5000").Code; code != http.StatusForbidden {
+		t.Errorf("remote scrape before configuration: status %d, want 403", code)
+	}
+	if code := scrapeMetrics("127.0.0.1:5000").Code; code != http.StatusOK {
+		t.Errorf("loopback scrape before configuration: status %d, want 200", code)
+	}
+}
+
+func TestMetricsCounters(t *testing.T) {
+	applyAccess(t, &Config{})
+	bytesReceived.Add(10)
+	bytesSent.Add(20)
+	uploadsCompleted.WithLabelValues("chunked").Inc()
+	uploadsFailed.WithLabelValues("web").Inc()
+	rangeRequests.Inc()
+	authFailuresTotal.Inc()
+	limitRejections.WithLabelValues("identity").Inc()
+	chunkDuration.Observe(0.2)
+
+	rec := scrapeMetrics("127.0.0.1:5000")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"ctrans_bytes_received_total ",
+		"ctrans_bytes_sent_total ",
+		"ctrans_chunk_upload_duration_seconds_bucket{le=\"0.25\"}",
+		`ctrans_uploads_completed_total{type="chunked"}`,
+		`ctrans_uploads_failed_total{type="web"}`,
+		"ctrans_download_range_requests_total ",
+		"ctrans_auth_failures_total ",
+		`ctrans_limit_rejections_total{limit="identity"}`,
+		"ctrans_active_uploads ",
+		"ctrans_reserved_bytes ",
+		"ctrans_disk_free_bytes ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+)
+
+// CertMapping 将客户端证书映射为身份和角色。
+// 各匹配字段支持 * 通配，未设置的字段不参与匹配，全部设置的字段都匹配才算命中。
+type CertMapping struct {
+	CommonName string `json:"common_name,omitempty"` // Subject CN
+	DNSName    string `json:"dns_name,omitempty"`    // SAN DNS 名称
+	Email      string `json:"email,omitempty"`       // SAN 邮箱
+	URI        string `json:"uri,omitempty"`         // SAN URI，例如 spiffe://farm/builder
+	Name       string `json:"name,omitempty"`        // 身份名称，为空时使用证书 CN
+	Role       string `json:"role"`
+}
+
+var (
+	clientCertAuth bool // 是否启用了客户端证书认证
+	certMappings   []CertMapping
+)
+
+// globMatch 空模式视为匹配；任一候选值匹配即可
+func globMatch(pattern string, values ...string) bool {
+	if pattern == "" {
+		return true
+	}
+	for _, v := range values {
+		if ok, _ := path.Match(pattern, v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m CertMapping) matches(cert *x509.Certificate) bool {
+	if m.CommonName != "" && !globMatch(m.CommonName, cert.Subject.CommonName) {
+		return false
+	}
+	if m.DNSName != "" && !globMatch(m.DNSName, cert.DNSNames...) {
+		return false
+	}
+	if m.Email != "" && !globMatch(m.Email, cert.EmailAddresses...) {
+		return false
+	}
+	if m.URI != "" {
+		uris := make([]string, 0, len(cert.URIs))
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+		}
+		if !globMatch(m.URI, uris...) {
+			return false
+		}
+	}
+	return true
+}
+
+// certIdentity 根据已验证的客户端证书返回身份；没有证书时返回 nil
+func certIdentity(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+
+	configMutex.RLock()
+	mappings := certMappings
+	configMutex.RUnlock()
+
+	cert := r.TLS.VerifiedChains[0][0]
+	for _, m := range mappings {
+		if !m.matches(cert) {
+			continue
+		}
+		name := m.Name
+		if name == "" {
+			name = cert.Subject.CommonName
+		}
+		return &Identity{Name: "cert:" + name, Role: m.Role}, nil
+	}
+	return nil, fmt.Errorf("client certificate %q is not mapped to any role", cert.Subject.CommonName)
+}
+
+// validateCertMappings 检查证书映射中的角色
+func validateCertMappings(list []CertMapping) error {
+	for _, m := range list {
+		if !validRole(m.Role) {
+			return fmt.Errorf("client_certs: unknown role %q", m.Role)
+		}
+	}
+	return nil
+}
+
+// buildTLSConfig 根据配置构造服务器 TLS 配置，未启用 TLS 时返回 nil
+func buildTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.TLSCert == "" {
+		if cfg.ClientCA != "" {
+			return nil, fmt.Errorf("client_ca requires tls_cert and tls_key")
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCA)
+	}
+
+	if err := validateCertMappings(cfg.ClientCerts); err != nil {
+		return nil, err
+	}
+
+	tlsConfig.ClientCAs = pool
+	// 默认证书可选，浏览器等没有证书的客户端仍可使用密钥或会话
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	clientCertAuth = true
+	certMappings = cfg.ClientCerts
+	return tlsConfig, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的 CA，可以签发客户端证书
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发客户端证书
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames []string, uri string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startMTLSServer 按配置启动要求客户端证书的测试服务器，响应为证书对应的身份和角色
+func startMTLSServer(t *testing.T, ca *testCA, mappings []CertMapping) *httptest.Server {
+	t.Helper()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := buildTLSConfig(&Config{TLSCert: "unused", ClientCA: caFile, ClientCerts: mappings})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := certIdentity(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if id == nil {
+			http.Error(w, "no certificate", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, id.Name+" "+id.Role)
+	}))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// mtlsClient 返回信任测试服务器并出示指定证书的新客户端，不复用连接。
+// 证书总是发送，即使它不是由服务器接受的 CA 签发的
+func mtlsClient(srv *httptest.Server, cert *tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tlsConfig := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	ca := newTestCA(t, "ctrans test CA")
+	srv := startMTLSServer(t, ca, []CertMapping{
+		{URI: "spiffe://farm/ops/*", Role: roleAdmin},
+		{CommonName: "builder-*", Role: roleReadWrite},
+		{DNSName: "*.ci.example.com", Name: "ci", Role: roleReadOnly},
+	})
+
+	tests := []struct {
+		name   string
+		cert   *tls.Certificate
+		status int
+		want   string
+	}{
+		{"cn glob", ptr(ca.issue(t, "builder-01", nil, "")), http.StatusOK, "cert:builder-01 " + roleReadWrite},
+		{"uri san", ptr(ca.issue(t, "alice", nil, "spiffe://farm/ops/alice")), http.StatusOK, "cert:alice " + roleAdmin},
+		{"dns san with fixed name", ptr(ca.issue(t, "runner", []string{"r1.ci.example.com"}, "")), http.StatusOK, "cert:ci " + roleReadOnly},
+		{"unmapped", ptr(ca.issue(t, "stranger", nil, "")), http.StatusForbidden, ""},
+		{"no certificate", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := mtlsClient(srv, tt.cert).Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d (%s), want %d", resp.StatusCode, body, tt.status)
+			}
+			if tt.want != "" && string(body) != tt.want {
+				t.Errorf("identity = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientCertUntrustedCA(t *testing.T) {
+	ca := newTestCA(t, "ctrans test CA")
+	other := newTestCA(t, "untrusted CA")
+	srv := startMTLSServer(t, ca, []CertMapping{{CommonName: "*", Role: roleAdmin}})
+
+	resp, err := mtlsClient(srv, ptr(other.issue(t, "builder-01", nil, ""))).Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("certificate from an untrusted CA was accepted with status %d", resp.StatusCode)
+	}
+}
+
+func TestBuildTLSConfigRejectsUnknownRole(t *testing.T) {
+	ca := newTestCA(t, "ctrans test CA")
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := buildTLSConfig(&Config{TLSCert: "unused", ClientCA: caFile, ClientCerts: []CertMapping{{CommonName: "*", Role: "root"}}})
+	if err == nil {
+		t.Error("unknown role was accepted")
+	}
+	if _, err := buildTLSConfig(&Config{ClientCA: caFile}); err == nil {
+		t.Error("client_ca without tls_cert was accepted")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const oidcStateCookie = "ctrans_oidc_state"
+
+// OIDCConfig OpenID Connect 登录配置（授权码流程 + PKCE）
+type OIDCConfig struct {
+	Issuer       string            `json:"issuer"`
+	ClientID     string            `json:"client_id"`
+	ClientSecret string            `json:"client_secret"`
+	RedirectURL  string            `json:"redirect_url"` // 例如 https://ctrans.example.com/oidc/callback
+	Scopes       []string          `json:"scopes"`       // 默认 openid profile email
+	GroupsClaim  string            `json:"groups_claim"` // 默认 groups
+	GroupRoles   map[string]string `json:"group_roles"`  // 组名到角色的映射
+	DefaultRole  string            `json:"default_role"` // 没有匹配的组时使用的角色，为空则拒绝登录
+	ButtonText   string            `json:"button_text"`  // 登录按钮文字
+}
+
+// oidcLogin 进行中的登录请求
+type oidcLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+var (
+	oidcConfig   *OIDCConfig
+	oidcProvider *oidc.Provider
+	oidcMutex    sync.Mutex
+	oidcPending  = make(map[string]*oidcLogin) // state -> 登录请求
+)
+
+// rolePriority 多个组映射到不同角色时取权限最高的
+var rolePriority = map[string]int{roleReadOnly: 1, roleReadWrite: 2, roleAdmin: 3}
+
+// initOIDC 校验配置；提供方的发现文档在首次登录时才获取，避免身份提供方不可用时服务器无法启动
+func initOIDC(cfg *OIDCConfig) error {
+	if cfg == nil || cfg.Issuer == "" {
+		return nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return fmt.Errorf("oidc: client_id and redirect_url are required")
+	}
+	for group, role := range cfg.GroupRoles {
+		if _, ok := rolePriority[role]; !ok {
+			return fmt.Errorf("oidc: group %q maps to invalid role %q", group, role)
+		}
+	}
+	if _, ok := rolePriority[cfg.DefaultRole]; cfg.DefaultRole != "" && !ok {
+		return fmt.Errorf("oidc: invalid default_role %q", cfg.DefaultRole)
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.ButtonText == "" {
+		cfg.ButtonText = "使用 SSO 登录"
+	}
+	oidcConfig = cfg
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			now := time.Now()
+			oidcMutex.Lock()
+			for state, pending := range oidcPending {
+				if now.After(pending.expiresAt) {
+					delete(oidcPending, state)
+				}
+			}
+			oidcMutex.Unlock()
+		}
+	}()
+	return nil
+}
+
+// oidcEnabled 是否启用了 OIDC 登录
+func oidcEnabled() bool {
+	return oidcConfig != nil
+}
+
+// oidcOAuth2 返回 OAuth2 配置，必要时获取提供方的发现文档
+func oidcOAuth2(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcProvider == nil {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		provider, err := oidc.NewProvider(ctx, oidcConfig.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		oidcProvider = provider
+	}
+
+	return &oauth2.Config{
+		ClientID:     oidcConfig.ClientID,
+		ClientSecret: oidcConfig.ClientSecret,
+		RedirectURL:  oidcConfig.RedirectURL,
+		Endpoint:     oidcProvider.Endpoint(),
+		Scopes:       oidcConfig.Scopes,
+	}, oidcProvider, nil
+}
+
+// handleOIDCLogin 跳转到身份提供方的授权页面
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conf, _, err := oidcOAuth2(r.Context())
+	if err != nil {
+		logFrom(r).Error("OIDC discovery failed", "issuer", oidcConfig.Issuer, "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state := randomString(24)
+	pending := &oidcLogin{
+		nonce:     randomString(24),
+		verifier:  oauth2.GenerateVerifier(),
+		expiresAt: time.Now().Add(10 * time.Minute),
+	}
+
+	oidcMutex.Lock()
+	oidcPending[state] = pending
+	oidcMutex.Unlock()
+
+	// state 同时写入 Cookie，回调时校验发起登录的是同一个浏览器
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/oidc/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, conf.AuthCodeURL(state,
+		oidc.Nonce(pending.nonce),
+		oauth2.S256ChallengeOption(pending.verifier)), http.StatusFound)
+}
+
+// handleOIDCCallback 用授权码换取 ID Token，校验后创建网页会话
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if rejectLockedOut(w, r) {
+		return
+	}
+
+	if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+		http.Error(w, "Login failed: "+errMsg, http.StatusUnauthorized)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/oidc/", MaxAge: -1})
+
+	oidcMutex.Lock()
+	pending, exists := oidcPending[state]
+	delete(oidcPending, state)
+	oidcMutex.Unlock()
+	if !exists || time.Now().After(pending.expiresAt) {
+		http.Error(w, "Login request expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	conf, provider, err := oidcOAuth2(r.Context())
+	if err != nil {
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	token, err := conf.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		authFailed(w, r, "Failed to exchange authorization code")
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "No id_token in token response", http.StatusBadGateway)
+		return
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oidcConfig.ClientID}).Verify(r.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != pending.nonce {
+		authFailed(w, r, "Invalid ID token")
+		return
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Invalid ID token claims", http.StatusBadGateway)
+		return
+	}
+
+	role := oidcRole(claims)
+	if role == "" {
+		http.Error(w, "Your account is not allowed to use this server", http.StatusForbidden)
+		return
+	}
+
+	id := &Identity{Name: "oidc:" + oidcUserName(claims, idToken.Subject), Role: role}
+	if !rolePermits(id.Role, clientIP(r)) {
+		http.Error(w, "Access denied for this role from your address", http.StatusForbidden)
+		return
+	}
+	clearAuthFailures(clientIP(r))
+
+	if old := sessionFromRequest(r); old != nil {
+		destroySession(w, r, old)
+	}
+	createSession(w, r, id)
+	setRequestIdentity(r, id.Name)
+	logFrom(r).Info("OIDC login", "identity", id.Name, "role", id.Role)
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// oidcRole 根据组声明计算角色，取匹配组中权限最高的角色
+func oidcRole(claims map[string]interface{}) string {
+	role := oidcConfig.DefaultRole
+
+	var groups []string
+	switch v := claims[oidcConfig.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = []string{v}
+	}
+
+	for _, group := range groups {
+		if mapped, ok := oidcConfig.GroupRoles[group]; ok && rolePriority[mapped] > rolePriority[role] {
+			role = mapped
+		}
+	}
+	return role
+}
+
+// oidcUserName 选择便于阅读的用户名
+func oidcUserName(claims map[string]interface{}, subject string) string {
+	for _, key := range []string{"preferred_username", "email", "name"} {
+		if s, ok := claims[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return subject
+}
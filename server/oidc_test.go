@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIdP 最小的 OpenID 提供方：发现文档、JWKS 和校验 PKCE 的令牌端点
+type mockIdP struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	grants map[string]*mockGrant // 授权码 -> 授权
+}
+
+// mockGrant 用户在提供方同意授权后记录的信息
+type mockGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, grants: make(map[string]*mockGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.srv.URL,
+			"authorization_endpoint":                idp.srv.URL + "/authorize",
+			"token_endpoint":                        idp.srv.URL + "/token",
+			"jwks_uri":                              idp.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		grant := idp.grants[r.Form.Get("code")]
+		delete(idp.grants, r.Form.Get("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if grant == nil || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.sign(t, grant.claims),
+		})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// sign 生成 RS256 签名的 ID Token
+func (idp *mockIdP) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Error(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize 模拟用户在提供方登录并同意，返回授权码
+func (idp *mockIdP) authorize(grant *mockGrant) string {
+	code := randomString(12)
+	idp.mu.Lock()
+	idp.grants[code] = grant
+	idp.mu.Unlock()
+	return code
+}
+
+func setupOIDC(t *testing.T, idp *mockIdP) {
+	t.Helper()
+	oidcProvider = nil
+	err := initOIDC(&OIDCConfig{
+		Issuer:      idp.srv.URL,
+		ClientID:    "ctrans",
+		RedirectURL: "http://ctrans.test/oidc/callback",
+		GroupRoles:  map[string]string{"dev": roleReadWrite, "ops": roleAdmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		oidcConfig, oidcProvider = nil, nil
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	setupOIDC(t, idp)
+
+	tests := []struct {
+		name string
+		// modify 在用户授权后修改回调请求或提供方返回的内容
+		modify   func(grant *mockGrant, query url.Values, cookie *http.Cookie)
+		status   int
+		identity string
+		role     string
+	}{
+		{
+			name:     "success",
+			status:   http.StatusFound,
+			identity: "oidc:alice",
+			role:     roleReadWrite,
+		},
+		{
+			name: "highest group role",
+			modify: func(grant *mockGrant, _ url.Values, _ *http.Cookie) {
+				grant.claims["groups"] = []string{"dev", "ops"}
+			},
+			status:   http.StatusFound,
+			identity: "oidc:alice",
+			role:     roleAdmin,
+		},
+		{
+			name: "state does not match cookie",
+			modify: func(_ *mockGrant, query url.Values, _ *http.Cookie) {
+				query.Set("state", "forged")
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "unknown state",
+			modify: func(_ *mockGrant, query url.Values, cookie *http.Cookie) {
+				query.Set("state", "forged")
+				cookie.Value = "forged"
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "bad nonce",
+			modify: func(grant *mockGrant, _ url.Values, _ *http.Cookie) {
+				grant.claims["nonce"] = "replayed"
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong audience",
+			modify: func(grant *mockGrant, _ url.Values, _ *http.Cookie) {
+				grant.claims["aud"] = "another-client"
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "expired id token",
+			modify: func(grant *mockGrant, _ url.Values, _ *http.Cookie) {
+				grant.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "pkce verifier mismatch",
+			modify: func(grant *mockGrant, _ url.Values, _ *http.Cookie) {
+				grant.challenge = "not-the-challenge"
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "provider error",
+			modify: func(_ *mockGrant, query url.Values, _ *http.Cookie) {
+				query.Set("error", "access_denied")
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "no mapped group",
+			modify: func(grant *mockGrant, _ url.Values, _ *http.Cookie) {
+				grant.claims["groups"] = []string{"guests"}
+			},
+			status: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 登录：跳转到提供方，带上 state、nonce 和 PKCE challenge
+			rec := httptest.NewRecorder()
+			handleOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+			if rec.Code != http.StatusFound {
+				t.Fatalf("login status = %d: %s", rec.Code, rec.Body)
+			}
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth := location.Query()
+			if auth.Get("code_challenge_method") != "S256" || auth.Get("code_challenge") == "" || auth.Get("nonce") == "" {
+				t.Fatalf("authorization URL lacks PKCE or nonce: %s", location)
+			}
+			var cookie *http.Cookie
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == oidcStateCookie {
+					cookie = c
+				}
+			}
+			if cookie == nil || cookie.Value != auth.Get("state") {
+				t.Fatalf("state cookie not set")
+			}
+
+			grant := &mockGrant{
+				challenge: auth.Get("code_challenge"),
+				claims: map[string]interface{}{
+					"iss":                idp.srv.URL,
+					"aud":                "ctrans",
+					"sub":                "user-1",
+					"iat":                time.Now().Unix(),
+					"exp":                time.Now().Add(time.Hour).Unix(),
+					"nonce":              auth.Get("nonce"),
+					"preferred_username": "alice",
+					"groups":             []string{"dev"},
+				},
+			}
+			query := url.Values{"state": {auth.Get("state")}}
+			if tt.modify != nil {
+				tt.modify(grant, query, cookie)
+			}
+			query.Set("code", idp.authorize(grant))
+
+			// 回调
+			req := httptest.NewRequest(http.MethodGet, "/oidc/callback?"+query.Encode(), nil)
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			rec = httptest.NewRecorder()
+			handleOIDCCallback(rec, req)
+			t.Cleanup(func() { clearAuthFailures(clientIP(req)) })
+
+			if rec.Code != tt.status {
+				t.Fatalf("callback status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusFound {
+				for _, c := range rec.Result().Cookies() {
+					if c.Name == sessionCookie {
+						t.Fatal("session created for a failed login")
+					}
+				}
+				return
+			}
+
+			// 成功登录后会话 Cookie 对应正确的身份和角色
+			check := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, c := range rec.Result().Cookies() {
+				check.AddCookie(c)
+			}
+			sess := sessionFromRequest(check)
+			if sess == nil {
+				t.Fatal("no session after login")
+			}
+			if sess.Identity.Name != tt.identity || sess.Identity.Role != tt.role {
+				t.Errorf("identity = %s/%s, want %s/%s", sess.Identity.Name, sess.Identity.Role, tt.identity, tt.role)
+			}
+		})
+	}
+}
+
+func TestOIDCStateSingleUse(t *testing.T) {
+	idp := newMockIdP(t)
+	setupOIDC(t, idp)
+
+	rec := httptest.NewRecorder()
+	handleOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	state := location.Query().Get("state")
+
+	// 同一个 state 第二次回调时已经被消耗
+	for i, want := range []int{http.StatusUnauthorized, http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodGet, "/oidc/callback?code=unknown&state="+url.QueryEscape(state), nil)
+		req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: state})
+		rec := httptest.NewRecorder()
+		handleOIDCCallback(rec, req)
+		if rec.Code != want {
+			t.Errorf("callback %d status = %d, want %d", i+1, rec.Code, want)
+		}
+		clearAuthFailures(clientIP(req))
+	}
+}
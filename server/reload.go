@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// configMutex 保护可以热加载的全局配置：服务密钥、IP 访问规则、锁定策略、证书映射和会话有效期
+	configMutex   sync.RWMutex
+	currentConfig *Config
+
+	// configLoader 读取配置文件并叠加命令行参数，由 main 设置
+	configLoader func() (*Config, error)
+	reloadMutex  sync.Mutex // 同一时间只执行一次重新加载
+
+	minFreeSpace atomic.Int64 // 上传后磁盘至少保留的字节数
+)
+
+// reloadableFields 可以在运行时生效的配置项（JSON 名称），其余配置项修改后需要重启
+var reloadableFields = map[string]bool{
+	"key":               true,
+	"session_ttl":       true,
+	"trusted_proxies":   true,
+	"access":            true,
+	"role_access":       true,
+	"lockout":           true,
+	"metrics_access":    true,
+	"users_file":        true,
+	"client_certs":      true,
+	"log_level":         true,
+	"access_log":        true,
+	"min_free_space_mb": true,
+	"read_only":         true,
+	"limits":            true,
+	"trash":             true,
+	"versioning":        true,
+}
+
+// applyRuntimeConfig 在启动时应用可热加载的配置（访问规则和用户文件已由各自的 init 函数加载）
+func applyRuntimeConfig(cfg *Config) {
+	configMutex.Lock()
+	serviceKey = cfg.Key
+	if cfg.SessionTTL.Duration > 0 {
+		sessionTTL = cfg.SessionTTL.Duration
+	}
+	if clientCertAuth {
+		certMappings = cfg.ClientCerts
+	}
+	currentConfig = cfg
+	configMutex.Unlock()
+
+	minFreeSpace.Store(cfg.MinFreeSpaceMB * 1024 * 1024)
+	applyLimits(cfg.Limits)
+	applyTrash(cfg.Trash)
+	applyVersioning(cfg.Versioning)
+	if cfg.ReadOnly {
+		setReadOnly(true, "", 0)
+	}
+}
+
+// changedFields 比较两份配置，返回发生变化的配置项名称
+func changedFields(old, cfg *Config) []string {
+	var changed []string
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem()
+	for i := 0; i < ov.NumField(); i++ {
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			name, _, _ := strings.Cut(ov.Type().Field(i).Tag.Get("json"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// ReloadResult 重新加载配置的结果
+type ReloadResult struct {
+	Changed         []string `json:"changed"`          // 已生效的配置项
+	RestartRequired []string `json:"restart_required"` // 已修改但需要重启才能生效的配置项
+}
+
+// reloadConfig 重新读取配置并原子地替换可热加载的部分：
+// 先校验并准备好所有新配置（编译规则、解析用户文件、打开日志文件），任何一步失败都保留旧配置。
+// 服务密钥变化时，用旧密钥（或未启用认证时）登录的网页会话失效
+func reloadConfig() (*ReloadResult, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	cfg, err := configLoader()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	configMutex.RLock()
+	old := currentConfig
+	configMutex.RUnlock()
+
+	result := &ReloadResult{Changed: []string{}, RestartRequired: []string{}}
+	changed := make(map[string]bool)
+	for _, name := range changedFields(old, cfg) {
+		changed[name] = true
+		if reloadableFields[name] {
+			result.Changed = append(result.Changed, name)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, name)
+		}
+	}
+
+	// 准备阶段：只校验和构造，不修改任何全局状态
+	applyAccess, err := prepareAccess(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if clientCertAuth {
+		if err := validateCertMappings(cfg.ClientCerts); err != nil {
+			return nil, err
+		}
+	}
+	level, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	applyUsers := func() {}
+	if changed["users_file"] {
+		if applyUsers, err = prepareUsers(cfg.UsersFile); err != nil {
+			return nil, fmt.Errorf("users_file: %v", err)
+		}
+	}
+	applyAccessLog := func() {}
+	if changed["access_log"] {
+		if applyAccessLog, err = prepareAccessLog(cfg.AccessLog); err != nil {
+			return nil, fmt.Errorf("access_log: %v", err)
+		}
+	}
+
+	// 切换阶段：不再返回错误
+	configMutex.Lock()
+	applyAccess()
+	serviceKey = cfg.Key
+	if cfg.SessionTTL.Duration > 0 {
+		sessionTTL = cfg.SessionTTL.Duration
+	}
+	if clientCertAuth {
+		certMappings = cfg.ClientCerts
+	}
+	currentConfig = cfg
+	configMutex.Unlock()
+
+	if changed["key"] {
+		dropped := dropSessions(func(id *Identity) bool {
+			return id.Name == "service-key" || id.Name == "anonymous"
+		})
+		slog.Info("Service key changed, web sessions signed in with the old key ended", "sessions", dropped)
+	}
+	applyUsers()
+	applyAccessLog()
+	logLevelVar.Set(level)
+	minFreeSpace.Store(cfg.MinFreeSpaceMB * 1024 * 1024)
+	applyLimits(cfg.Limits)
+	applyTrash(cfg.Trash)
+	applyVersioning(cfg.Versioning)
+	// 只在配置文件中的 read_only 发生变化时切换，避免覆盖通过管理接口设置的维护状态
+	if changed["read_only"] {
+		setReadOnly(cfg.ReadOnly, "", 0)
+	}
+
+	slog.Info("Configuration reloaded", "changed", result.Changed, "restart_required", result.RestartRequired)
+	return result, nil
+}
+
+// handleReload 管理接口：POST /admin/reload 重新加载配置
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := reloadConfig()
+	if err != nil {
+		logFrom(r).Error("Failed to reload configuration", "error", err)
+		http.Error(w, "Failed to reload configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useConfig 以 cfg 作为当前配置，测试结束后恢复为未配置的状态
+func useConfig(t *testing.T, cfg *Config) {
+	t.Helper()
+	applyRuntimeConfig(cfg)
+	t.Cleanup(func() {
+		configLoader = nil
+		applyRuntimeConfig(&Config{})
+		configMutex.Lock()
+		currentConfig = nil
+		configMutex.Unlock()
+		setReadOnly(false, "", 0)
+	})
+}
+
+// reloadWith 让下一次重新加载读到 cfg
+func reloadWith(cfg *Config) (*ReloadResult, error) {
+	configLoader = func() (*Config, error) {
+		copied := *cfg
+		return &copied, nil
+	}
+	return reloadConfig()
+}
+
+// hasSession 会话是否仍然有效
+func hasSession(sess *Session) bool {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID + "." + signSessionID(sess.ID)})
+	return sessionFromRequest(req) != nil
+}
+
+func TestReloadKeyEndsSessions(t *testing.T) {
+	if err := initSessions(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig()
+	cfg.Key = "old-key"
+	cfg.MinFreeSpaceMB = 0
+	useConfig(t, cfg)
+
+	login := func(id *Identity) *Session {
+		sess := createSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil), id)
+		t.Cleanup(func() { dropSessions(func(*Identity) bool { return true }) })
+		return sess
+	}
+	keySession := login(&Identity{Name: "service-key", Role: roleAdmin})
+	userSession := login(&Identity{Name: "user:alice", Role: roleReadWrite})
+
+	// 密钥不变时会话保留
+	if _, err := reloadWith(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !hasSession(keySession) {
+		t.Error("service key session ended by a reload that kept the key")
+	}
+
+	next := *cfg
+	next.Key = "new-key"
+	result, err := reloadWith(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != "key" {
+		t.Errorf("changed = %v, want [key]", result.Changed)
+	}
+	if hasSession(keySession) {
+		t.Error("session signed in with the old service key is still valid")
+	}
+	if !hasSession(userSession) {
+		t.Error("user session ended by a service key change")
+	}
+	if !validServiceKey("new-key") || validServiceKey("old-key") {
+		t.Error("service key was not replaced")
+	}
+}
+
+func TestReloadAppliesConfig(t *testing.T) {
+	applyAccess(t, &Config{})
+	level := logLevelVar.Level()
+	t.Cleanup(func() { logLevelVar.Set(level) })
+	cfg := defaultConfig()
+	cfg.MinFreeSpaceMB = 0
+	cfg.AccessLog = ""
+	useConfig(t, cfg)
+
+	result, err := reloadWith(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changed) != 0 || len(result.RestartRequired) != 0 {
+		t.Errorf("unchanged reload = %+v, want no changes", result)
+	}
+
+	next := *cfg
+	next.MinFreeSpaceMB = 10
+	next.LogLevel = "debug"
+	next.MetricsAccess = AccessRules{Allow: []string{"10.0.0.0/8"}}
+	next.Port = "9090"
+	result, err = reloadWith(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Changed, ",") != "metrics_access,log_level,min_free_space_mb" {
+		t.Errorf("changed = %v", result.Changed)
+	}
+	if strings.Join(result.RestartRequired, ",") != "port" {
+		t.Errorf("restart_required = %v, want [port]", result.RestartRequired)
+	}
+	if minFreeSpace.Load() != 10<<20 || logLevelVar.Level() != slog.LevelDebug {
+		t.Errorf("min free space %d, log level %v; want %d and debug", minFreeSpace.Load(), logLevelVar.Level(), 10<<20)
+	}
+	if scrapeMetrics("10.0.0.5:5000").Code != http.StatusOK || scrapeMetrics("127.0.0.1:5000").Code != http.StatusForbidden {
+		t.Error("metrics_access was not applied")
+	}
+
+	// 配置文件中的 read_only 只在变化时切换，不覆盖通过管理接口设置的维护状态
+	readOnly := next
+	readOnly.ReadOnly = true
+	if _, err := reloadWith(&readOnly); err != nil {
+		t.Fatal(err)
+	}
+	if !currentMaintenance().ReadOnly {
+		t.Error("read_only: true was not applied")
+	}
+	setReadOnly(true, "migrating storage", 0)
+	if _, err := reloadWith(&readOnly); err != nil {
+		t.Fatal(err)
+	}
+	if currentMaintenance().Message != "migrating storage" {
+		t.Errorf("unchanged read_only replaced the maintenance state: %+v", currentMaintenance())
+	}
+	if _, err := reloadWith(&next); err != nil {
+		t.Fatal(err)
+	}
+	if currentMaintenance().ReadOnly {
+		t.Error("read_only: false was not applied")
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	applyAccess(t, &Config{})
+	cfg := defaultConfig()
+	cfg.Key = "old-key"
+	cfg.MinFreeSpaceMB = 0
+	cfg.AccessLog = ""
+	useConfig(t, cfg)
+
+	invalid := map[string]func(c *Config){
+		"metrics_access":  func(c *Config) { c.MetricsAccess.Allow = []string{"not-an-ip"} },
+		"role_access":     func(c *Config) { c.RoleAccess = map[string]AccessRules{"admin": {Deny: []string{"10.0.0.0/33"}}} },
+		"log_level":       func(c *Config) { c.LogLevel = "loud" },
+		"min_free_space":  func(c *Config) { c.MinFreeSpaceMB = -1 },
+		"users_file":      func(c *Config) { c.UsersFile = filepath.Join(t.TempDir(), "missing") },
+		"trash retention": func(c *Config) { c.Trash.Retention.Duration = -time.Hour },
+	}
+	for name, modify := range invalid {
+		next := *cfg
+		next.Key = "new-key"
+		next.MinFreeSpaceMB = 10
+		modify(&next)
+		if _, err := reloadWith(&next); err == nil {
+			t.Errorf("%s: invalid config accepted", name)
+		}
+		// 任何一项无效时其他配置也保持不变
+		if !validServiceKey("old-key") || minFreeSpace.Load() != 0 || currentConfig != cfg {
+			t.Errorf("%s: rejected reload changed the running configuration", name)
+		}
+	}
+
+	configLoader = func() (*Config, error) { return nil, errors.New("config file is not valid JSON") }
+	rec := httptest.NewRecorder()
+	handleReload(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not valid JSON") {
+		t.Errorf("reload endpoint: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handleReload(rec, httptest.NewRequest(http.MethodGet, "/admin/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /admin/reload: status %d, want 405", rec.Code)
+	}
+}
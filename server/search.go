@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultSearchLimit = 1000
+	maxSearchLimit     = 10000
+)
+
+// searchQuery /search 的查询参数
+type searchQuery struct {
+	dir            string
+	name           string // 名称包含的子串，不区分大小写
+	glob           string // 匹配名称
+	kind           string // file、dir 或空
+	minSize        int64
+	maxSize        int64 // -1 不限
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+	sha256         string
+	uploadedBy     string
+	tags           []tagFilter
+	limit          int
+}
+
+// parseSearchQuery 解析并校验查询参数，至少需要一个搜索条件
+func parseSearchQuery(r *http.Request) (*searchQuery, error) {
+	v := r.URL.Query()
+	q := &searchQuery{
+		dir:        strings.Trim(path.Clean("/"+v.Get("path")), "/"),
+		name:       strings.ToLower(v.Get("q")),
+		glob:       v.Get("glob"),
+		kind:       v.Get("type"),
+		maxSize:    -1,
+		sha256:     strings.ToLower(strings.TrimSpace(v.Get("sha256"))),
+		uploadedBy: v.Get("uploaded_by"),
+		limit:      defaultSearchLimit,
+	}
+
+	if q.glob != "" {
+		if _, err := path.Match(q.glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern")
+		}
+	}
+	switch q.kind {
+	case "", "file", "dir":
+	default:
+		return nil, fmt.Errorf("type must be file or dir")
+	}
+	if s := v.Get("min_size"); s != "" {
+		size, err := parseByteSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_size")
+		}
+		q.minSize = size
+	}
+	if s := v.Get("max_size"); s != "" {
+		size, err := parseByteSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_size")
+		}
+		q.maxSize = size
+	}
+	if s := v.Get("modified_after"); s != "" {
+		t, err := parseTimeArg(s)
+		if err != nil {
+			return nil, fmt.Errorf("modified_after: %v", err)
+		}
+		q.modifiedAfter = t
+	}
+	if s := v.Get("modified_before"); s != "" {
+		t, err := parseTimeArg(s)
+		if err != nil {
+			return nil, fmt.Errorf("modified_before: %v", err)
+		}
+		q.modifiedBefore = t
+	}
+	tags, err := parseTagFilters(v["tag"])
+	if err != nil {
+		return nil, err
+	}
+	q.tags = tags
+	if q.sha256 != "" {
+		if len(q.sha256) != 64 || strings.Trim(q.sha256, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("sha256 must be 64 hex characters")
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		q.limit = min(limit, maxSearchLimit)
+	}
+
+	if q.name == "" && q.glob == "" && q.kind == "" && q.minSize == 0 && q.maxSize < 0 &&
+		q.modifiedAfter.IsZero() && q.modifiedBefore.IsZero() && q.sha256 == "" && q.uploadedBy == "" && len(q.tags) == 0 {
+		return nil, fmt.Errorf("no search criteria")
+	}
+	return q, nil
+}
+
+// sizeFiltered 大小、校验和、上传者和标签条件只适用于文件，设置了这些条件时跳过目录
+func (q *searchQuery) sizeFiltered() bool {
+	return q.minSize > 0 || q.maxSize >= 0 || q.sha256 != "" || q.uploadedBy != "" || len(q.tags) > 0
+}
+
+// matchName 检查只依赖名称的条件
+func (q *searchQuery) matchName(name string) bool {
+	if q.name != "" && !strings.Contains(strings.ToLower(name), q.name) {
+		return false
+	}
+	if q.glob != "" {
+		if ok, _ := path.Match(q.glob, name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// match 检查条目是否满足所有条件，满足时返回结果；m 为该文件的元数据记录，过期的记录不使用
+func (q *searchQuery) match(rel string, info os.FileInfo, m *FileMeta) (*FileEntry, bool) {
+	if (q.kind == "file" && info.IsDir()) || (q.kind == "dir" && !info.IsDir()) || (info.IsDir() && q.sizeFiltered()) {
+		return nil, false
+	}
+	if !q.matchName(path.Base(rel)) {
+		return nil, false
+	}
+	if info.Size() < q.minSize || (q.maxSize >= 0 && info.Size() > q.maxSize) {
+		return nil, false
+	}
+	if (!q.modifiedAfter.IsZero() && info.ModTime().Before(q.modifiedAfter)) ||
+		(!q.modifiedBefore.IsZero() && !info.ModTime().Before(q.modifiedBefore)) {
+		return nil, false
+	}
+	entry := &FileEntry{Name: path.Base(rel), Path: rel, Size: info.Size(), Modified: info.ModTime(), IsDir: info.IsDir()}
+	if info.IsDir() || !m.matches(info.Size(), info.ModTime()) {
+		m = nil
+	}
+	if m != nil {
+		entry.setMeta(m)
+	}
+	if (q.sha256 != "" && entry.SHA256 != q.sha256) || (q.uploadedBy != "" && entry.UploadedBy != q.uploadedBy) || !matchTags(q.tags, m) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// metaFiltered 校验和、上传者和标签条件只有索引中的文件可能满足
+func (q *searchQuery) metaFiltered() bool {
+	return q.sha256 != "" || q.uploadedBy != "" || len(q.tags) > 0
+}
+
+// metaCandidate 不读取文件就能排除的记录：名称不符，或者校验和、上传者、标签与记录不符
+// （记录过期时这些条件也不满足）
+func (q *searchQuery) metaCandidate(rel string, m *FileMeta) bool {
+	if q.kind == "dir" || !q.matchName(path.Base(rel)) {
+		return false
+	}
+	if m == nil {
+		return !q.metaFiltered()
+	}
+	return (q.sha256 == "" || m.SHA256 == q.sha256) && (q.uploadedBy == "" || m.UploadedBy == q.uploadedBy) && matchTags(q.tags, m)
+}
+
+// searchBatch 每批候选条目的数量：每批在一个短事务中查询记录，读取文件状态在事务之外进行
+const searchBatch = 256
+
+// searchCandidate 还需要读取状态确认的条目，m 为文件的记录（没有时为 nil）
+type searchCandidate struct {
+	rel string
+	dir bool
+	m   *FileMeta
+}
+
+// search 返回按路径顺序排列的结果，最多 limit 条。
+// 带校验和、上传者或标签条件时按路径前缀遍历索引；其他查询遍历目录树（只读取名称和类型），
+// 空目录和直接放入 uploads/ 还未扫描的文件也能搜到
+func (q *searchQuery) search() (entries []FileEntry, truncated bool, err error) {
+	entries = []FileEntry{}
+	check := func(batch []searchCandidate) error {
+		for _, c := range batch {
+			info, err := os.Lstat(filepath.Join(uploadDir, filepath.FromSlash(c.rel)))
+			if err != nil || info.IsDir() != c.dir || (!c.dir && !info.Mode().IsRegular()) {
+				continue // 已被删除或替换，下一次扫描时清除记录
+			}
+			result, ok := q.match(c.rel, info, c.m)
+			if !ok {
+				continue
+			}
+			if len(entries) == q.limit {
+				truncated = true
+				return errListFull
+			}
+			entries = append(entries, *result)
+		}
+		return nil
+	}
+	if q.metaFiltered() {
+		err = q.scanIndex(check)
+	} else {
+		err = q.walk(check)
+	}
+	if errors.Is(err, errListFull) {
+		err = nil
+	}
+	return entries, truncated, err
+}
+
+// scanIndex 按路径前缀分批遍历索引，记录符合条件的文件交给 check
+func (q *searchQuery) scanIndex(check func([]searchCandidate) error) error {
+	prefix := []byte(q.dir)
+	if q.dir != "" {
+		prefix = append(prefix, '/')
+	}
+	for from := prefix; from != nil; {
+		var batch []searchCandidate
+		err := metadataDB.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(filesBucket).Cursor()
+			k, v := c.Seek(from)
+			from = nil
+			for n := 0; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				if n == searchBatch {
+					from = append([]byte(nil), k...) // 下一批从这里继续
+					break
+				}
+				n++
+				rel := string(k)
+				if m := decodeMeta(v); q.metaCandidate(rel, m) {
+					batch = append(batch, searchCandidate{rel: rel, m: m})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := check(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk 遍历目录树，名称和类型符合的条目分批查询记录后交给 check
+func (q *searchQuery) walk(check func([]searchCandidate) error) error {
+	root := filepath.Join(uploadDir, filepath.FromSlash(q.dir))
+	dirs := q.kind != "file" && !q.sizeFiltered()
+	var batch []searchCandidate
+	flush := func() error {
+		lookupCandidates(batch)
+		err := check(batch)
+		batch = batch[:0]
+		return err
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // 搜索期间被删除
+			}
+			return err
+		}
+		if p == root || !q.matchName(d.Name()) {
+			return nil
+		}
+		if d.IsDir() {
+			if !dirs {
+				return nil
+			}
+		} else if q.kind == "dir" || !d.Type().IsRegular() || isPartialName(d.Name()) {
+			return nil
+		}
+		batch = append(batch, searchCandidate{rel: uploadRelPath(p), dir: d.IsDir()})
+		if len(batch) == searchBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// lookupCandidates 在一个事务中查询一批文件的记录
+func lookupCandidates(batch []searchCandidate) {
+	metadataDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		for i := range batch {
+			if batch[i].dir {
+				continue
+			}
+			if data := b.Get([]byte(batch[i].rel)); data != nil {
+				batch[i].m = decodeMeta(data)
+			}
+		}
+		return nil
+	})
+}
+
+// handleSearch 搜索上传目录中的文件和目录，按路径顺序返回，最多 limit 条：
+//
+//	GET /search?q=release&glob=*.tar.gz&min_size=10MB&modified_after=2024-06-01&sha256=...&path=builds
+//
+// 返回 {"path", "entries", "truncated"}，truncated 为 true 表示还有更多结果
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	setRequestFile(r, q.dir, 0)
+
+	root := uploadDir
+	if q.dir != "" {
+		var ok bool
+		if root, ok = safeUploadPath(q.dir); !ok {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, "Not a directory", http.StatusBadRequest)
+		return
+	}
+
+	entries, truncated, err := q.search()
+	if err != nil {
+		logFrom(r).Error("Failed to search files", "path", q.dir, "error", err)
+		http.Error(w, "Error searching files", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":      q.dir,
+		"entries":   entries,
+		"truncated": truncated,
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// writeUploads 写入上传目录中的文件
+func writeUploads(t *testing.T, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		fullPath := filepath.Join(uploadDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// updateMeta 修改已有的记录
+func updateMeta(t *testing.T, rel string, fn func(m *FileMeta)) {
+	t.Helper()
+	err := metadataDB.Update(func(tx *bolt.Tx) error {
+		m := decodeMeta(tx.Bucket(filesBucket).Get([]byte(rel)))
+		fn(m)
+		return putMeta(tx, m)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	writeUploads(t, map[string]string{
+		"builds/release-1.0.tar.gz":  strings.Repeat("a", 100),
+		"builds/release-1.1.tar.gz":  strings.Repeat("b", 200),
+		"builds/nightly/app.tar.gz":  strings.Repeat("c", 50),
+		"builds2/release-2.0.tar.gz": "other tree",
+		"docs/Release-Notes.md":      "notes",
+		"stale.txt":                  "old content",
+		"gone.txt":                   "deleted",
+	})
+	if _, _, err := reconcileMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	updateMeta(t, "builds/release-1.1.tar.gz", func(m *FileMeta) {
+		m.UploadedBy = "user:alice"
+		m.Tags = map[string]string{"build": "42"}
+	})
+	// 索引建立后被改动和删除的文件
+	writeUploads(t, map[string]string{"stale.txt": "new content!"})
+	os.Remove(filepath.Join(uploadDir, "gone.txt"))
+	// 还没有扫描到的文件和空目录也能按名称搜到，正在写入的临时文件不会出现在结果中
+	writeUploads(t, map[string]string{"builds/unindexed-release.txt": "x", "builds/.uploading-release": "partial"})
+	os.MkdirAll(filepath.Join(uploadDir, "empty-release"), 0755)
+
+	sum := sha256.Sum256([]byte(strings.Repeat("a", 100)))
+	tests := []struct {
+		name      string
+		query     url.Values
+		want      []string
+		truncated bool
+	}{
+		{"name matches directories", url.Values{"q": {"build"}}, []string{"builds", "builds2"}, false},
+		{"name files only", url.Values{"q": {"release"}, "type": {"file"}}, []string{"builds/release-1.0.tar.gz", "builds/release-1.1.tar.gz", "builds/unindexed-release.txt", "builds2/release-2.0.tar.gz", "docs/Release-Notes.md"}, false},
+		{"directories", url.Values{"type": {"dir"}}, []string{"builds", "builds/nightly", "builds2", "docs", "empty-release"}, false},
+		{"empty directory", url.Values{"q": {"empty"}}, []string{"empty-release"}, false},
+		{"unindexed file has no metadata", url.Values{"q": {"release"}, "tag": {"build"}}, []string{"builds/release-1.1.tar.gz"}, false},
+		{"directory by name", url.Values{"type": {"dir"}, "q": {"night"}}, []string{"builds/nightly"}, false},
+		{"glob in path", url.Values{"glob": {"*.tar.gz"}, "path": {"builds"}}, []string{"builds/nightly/app.tar.gz", "builds/release-1.0.tar.gz", "builds/release-1.1.tar.gz"}, false},
+		{"path does not match sibling prefix", url.Values{"q": {"release"}, "path": {"builds2"}}, []string{"builds2/release-2.0.tar.gz"}, false},
+		{"size range", url.Values{"min_size": {"60"}, "max_size": {"150"}}, []string{"builds/release-1.0.tar.gz"}, false},
+		{"sha256", url.Values{"sha256": {hex.EncodeToString(sum[:])}}, []string{"builds/release-1.0.tar.gz"}, false},
+		{"uploaded by", url.Values{"uploaded_by": {"user:alice"}}, []string{"builds/release-1.1.tar.gz"}, false},
+		{"tag", url.Values{"tag": {"build=42"}}, []string{"builds/release-1.1.tar.gz"}, false},
+		{"stale record uses file size", url.Values{"q": {"stale"}, "min_size": {"12"}}, []string{"stale.txt"}, false},
+		{"deleted file", url.Values{"q": {"gone"}}, []string{}, false},
+		{"modified before", url.Values{"modified_before": {"2000-01-01"}}, []string{}, false},
+		{"limit", url.Values{"glob": {"*.gz"}, "limit": {"2"}}, []string{"builds/nightly/app.tar.gz", "builds/release-1.0.tar.gz"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleSearch(rec, httptest.NewRequest(http.MethodGet, "/search?"+tt.query.Encode(), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Entries   []FileEntry `json:"entries"`
+				Truncated bool        `json:"truncated"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range resp.Entries {
+				got = append(got, e.Path)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || resp.Truncated != tt.truncated {
+				t.Errorf("got %v (truncated %v), want %v (truncated %v)", got, resp.Truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+
+	// 过期记录上的校验和不再返回
+	rec := httptest.NewRecorder()
+	handleSearch(rec, httptest.NewRequest(http.MethodGet, "/search?q=stale", nil))
+	if strings.Contains(rec.Body.String(), "sha256") {
+		t.Errorf("stale record returned: %s", rec.Body)
+	}
+}
+
+func TestReconcileHashesOnlyChangedFiles(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	writeUploads(t, map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/c.txt": "c"})
+	// 正在复制和上传的临时文件不建立记录
+	writeUploads(t, map[string]string{".copying-123": "partial", "dir/.uploading-456": "partial"})
+
+	indexed, removed, err := reconcileMetadata()
+	if err != nil || indexed != 3 || removed != 0 {
+		t.Fatalf("first scan: indexed %d, removed %d, %v; want 3, 0", indexed, removed, err)
+	}
+	indexed, removed, err = reconcileMetadata()
+	if err != nil || indexed != 0 || removed != 0 {
+		t.Fatalf("unchanged scan: indexed %d, removed %d, %v; want 0, 0", indexed, removed, err)
+	}
+
+	// 只改修改时间或大小的文件重新计算校验和，删除的文件清除记录
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(uploadDir, "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	writeUploads(t, map[string]string{"dir/b.txt": "bb"})
+	os.Remove(filepath.Join(uploadDir, "dir", "c.txt"))
+	indexed, removed, err = reconcileMetadata()
+	if err != nil || indexed != 2 || removed != 1 {
+		t.Fatalf("changed scan: indexed %d, removed %d, %v; want 2, 1", indexed, removed, err)
+	}
+
+	info, _ := os.Stat(filepath.Join(uploadDir, "dir", "b.txt"))
+	sum := sha256.Sum256([]byte("bb"))
+	if m := lookupMeta("dir/b.txt", info); m == nil || m.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("dir/b.txt record = %+v, want checksum of the new content", m)
+	}
+}
+
+func TestParseTimeArg(t *testing.T) {
+	if got, err := parseTimeArg("2024-06-01T12:00:00Z"); err != nil || !got.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("RFC 3339: %v, %v", got, err)
+	}
+	if got, err := parseTimeArg("2024-06-01"); err != nil || !got.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("date: %v, %v", got, err)
+	}
+	if got, err := parseTimeArg("24h"); err != nil || time.Since(got) < 24*time.Hour || time.Since(got) > 25*time.Hour {
+		t.Errorf("duration: %v, %v", got, err)
+	}
+	for _, s := range []string{"", "-1h", "yesterday", "2024-13-01"} {
+		if _, err := parseTimeArg(s); err == nil {
+			t.Errorf("parseTimeArg(%q) succeeded", s)
+		}
+	}
+}
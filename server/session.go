@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookie = "ctrans_session" // 会话 Cookie 名称
+	csrfHeader    = "X-CSRF-Token"   // CSRF 令牌头
+)
+
+// Session 网页登录会话，仅保存在服务器内存中
+type Session struct {
+	ID        string
+	CSRFToken string
+	Identity  *Identity
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+var (
+	sessions      = make(map[string]*Session)
+	sessionMutex  sync.Mutex
+	sessionTTL    = 8 * time.Hour
+	sessionSecret []byte // 用于签名会话 Cookie，每次启动随机生成
+)
+
+// initSessions 生成签名密钥并启动过期会话清理
+func initSessions(ttl time.Duration) error {
+	sessionSecret = make([]byte, 32)
+	if _, err := rand.Read(sessionSecret); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		sessionTTL = ttl
+	}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			now := time.Now()
+			sessionMutex.Lock()
+			for id, sess := range sessions {
+				if now.After(sess.ExpiresAt) {
+					delete(sessions, id)
+				}
+			}
+			sessionMutex.Unlock()
+		}
+	}()
+	return nil
+}
+
+func randomString(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// signSessionID 计算会话 ID 的 HMAC 签名
+func signSessionID(id string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// createSession 为已认证的身份创建会话并写入 Cookie
+func createSession(w http.ResponseWriter, r *http.Request, id *Identity) *Session {
+	configMutex.RLock()
+	ttl := sessionTTL
+	configMutex.RUnlock()
+
+	sess := &Session{
+		ID:        randomString(24),
+		CSRFToken: randomString(24),
+		Identity:  id,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	sessionMutex.Lock()
+	sessions[sess.ID] = sess
+	sessionMutex.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sess.ID + "." + signSessionID(sess.ID),
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return sess
+}
+
+// sessionFromRequest 校验 Cookie 签名并返回未过期的会话
+func sessionFromRequest(r *http.Request) *Session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	id, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signSessionID(id))) {
+		return nil
+	}
+
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	sess, exists := sessions[id]
+	if !exists {
+		return nil
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		delete(sessions, id)
+		return nil
+	}
+	return sess
+}
+
+// dropSessions 删除身份满足条件的会话，返回删除的数量
+func dropSessions(match func(id *Identity) bool) int {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	dropped := 0
+	for sid, sess := range sessions {
+		if match(sess.Identity) {
+			delete(sessions, sid)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// destroySession 删除会话并清除 Cookie
+func destroySession(w http.ResponseWriter, r *http.Request, sess *Session) {
+	sessionMutex.Lock()
+	delete(sessions, sess.ID)
+	sessionMutex.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// checkCSRF 对会改变状态的请求校验 CSRF 令牌
+func checkCSRF(r *http.Request, sess *Session) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if sess == nil {
+		return false
+	}
+	token := r.Header.Get(csrfHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sess.CSRFToken)) == 1
+}
+
+// handleLogin 使用服务密钥或用户名密码换取会话 Cookie
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if rejectLockedOut(w, r) {
+		return
+	}
+
+	var req struct {
+		Key      string `json:"key"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var id *Identity
+	switch {
+	case req.Username != "":
+		user, ok := checkUserPassword(req.Username, req.Password)
+		if !ok {
+			setRequestIdentity(r, "user:"+req.Username)
+			authFailed(w, r, "Invalid username or password")
+			return
+		}
+		id = user
+	case !authEnabled():
+		id = &Identity{Name: "anonymous", Role: roleAdmin}
+	case validServiceKey(req.Key):
+		id = &Identity{Name: "service-key", Role: roleAdmin}
+	default:
+		authFailed(w, r, "Invalid service key")
+		return
+	}
+	clearAuthFailures(clientIP(r))
+
+	if !rolePermits(id.Role, clientIP(r)) {
+		http.Error(w, "Access denied for this role from your address", http.StatusForbidden)
+		return
+	}
+
+	// 登录前的旧会话一律作废，防止会话固定
+	if old := sessionFromRequest(r); old != nil {
+		destroySession(w, r, old)
+	}
+
+	sess := createSession(w, r, id)
+	setRequestIdentity(r, id.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"csrf_token": sess.CSRFToken,
+		"expires_at": sess.ExpiresAt,
+		"identity":   id.Name,
+		"role":       id.Role,
+	})
+}
+
+// handleLogout 注销当前会话
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess := sessionFromRequest(r)
+	if sess == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !checkCSRF(r, sess) {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+		return
+	}
+
+	setRequestIdentity(r, sess.Identity.Name)
+	destroySession(w, r, sess)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSession 返回当前会话状态，供网页初始化时使用
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"auth_required": authEnabled(),
+		"authenticated": false,
+	}
+	if sess := sessionFromRequest(r); sess != nil {
+		resp["authenticated"] = true
+		resp["csrf_token"] = sess.CSRFToken
+		resp["identity"] = sess.Identity.Name
+		resp["role"] = sess.Identity.Role
+		resp["expires_at"] = sess.ExpiresAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
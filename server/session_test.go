@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionCookieSigning(t *testing.T) {
+	if err := initSessions(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	sess := createSession(rec, httptest.NewRequest(http.MethodPost, "/login", nil), &Identity{Name: "alice", Role: roleReadWrite})
+	t.Cleanup(func() {
+		destroySession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/logout", nil), sess)
+	})
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("session cookie lacks HttpOnly or SameSite=Strict: %+v", cookie)
+	}
+
+	expired := &Session{ID: randomString(24), Identity: &Identity{Name: "bob", Role: roleAdmin}, ExpiresAt: time.Now().Add(-time.Minute)}
+	sessionMutex.Lock()
+	sessions[expired.ID] = expired
+	sessionMutex.Unlock()
+
+	other := randomString(24)
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"valid", cookie.Value, true},
+		{"no signature", sess.ID, false},
+		{"empty signature", sess.ID + ".", false},
+		{"tampered signature", sess.ID + "." + signSessionID(other), false},
+		{"signature of another id", other + "." + signSessionID(other), false},
+		{"tampered id", sess.ID + "x." + signSessionID(sess.ID), false},
+		{"expired", expired.ID + "." + signSessionID(expired.ID), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.value})
+			got := sessionFromRequest(req)
+			if (got != nil) != tt.valid {
+				t.Fatalf("sessionFromRequest = %v, want valid %v", got, tt.valid)
+			}
+			if got != nil && got.Identity.Name != "alice" {
+				t.Errorf("identity = %s, want alice", got.Identity.Name)
+			}
+		})
+	}
+
+	// 换了签名密钥（服务器重启）后旧 Cookie 失效
+	if err := initSessions(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if sessionFromRequest(req) != nil {
+		t.Error("cookie signed with the previous secret was accepted")
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	sess := &Session{CSRFToken: "token-123"}
+
+	tests := []struct {
+		name   string
+		method string
+		sess   *Session
+		token  string
+		ok     bool
+	}{
+		{"get without token", http.MethodGet, sess, "", true},
+		{"head without token", http.MethodHead, nil, "", true},
+		{"options without token", http.MethodOptions, nil, "", true},
+		{"post with token", http.MethodPost, sess, "token-123", true},
+		{"post without token", http.MethodPost, sess, "", false},
+		{"post with wrong token", http.MethodPost, sess, "token-124", false},
+		{"post with token prefix", http.MethodPost, sess, "token-12", false},
+		{"delete with token", http.MethodDelete, sess, "token-123", true},
+		{"put with wrong token", http.MethodPut, sess, "other", false},
+		{"post without session", http.MethodPost, nil, "token-123", false},
+		{"post with empty session token", http.MethodPost, &Session{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/delete", nil)
+			if tt.token != "" {
+				req.Header.Set(csrfHeader, tt.token)
+			}
+			if got := checkCSRF(req, tt.sess); got != tt.ok {
+				t.Errorf("checkCSRF = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRejectCrossSite(t *testing.T) {
+	tests := []struct {
+		method   string
+		site     string
+		rejected bool
+	}{
+		{http.MethodPost, "cross-site", true},
+		{http.MethodPut, "cross-site", true},
+		{http.MethodGet, "cross-site", false},
+		{http.MethodPost, "same-origin", false},
+		{http.MethodPost, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.site, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/upload", nil)
+			if tt.site != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.site)
+			}
+			rec := httptest.NewRecorder()
+			if got := rejectCrossSite(rec, req); got != tt.rejected {
+				t.Errorf("rejectCrossSite = %v, want %v", got, tt.rejected)
+			}
+			if tt.rejected && rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	draining        atomic.Bool  // 收到退出信号后置为 true，不再接受新的上传会话
+	activeTransfers atomic.Int64 // 正在处理的分片上传、合并和网页上传请求
+	activeRequests  atomic.Int64 // 正在处理的所有请求，关闭元数据库前等待它们结束
+)
+
+// handlerGrace 强制关闭连接后，等待仍在运行的处理函数结束的最长时间
+const handlerGrace = 10 * time.Second
+
+// uploadsStateFile 退出时保存未完成的上传会话，重启后客户端可以继续上传
+var uploadsStateFile = filepath.Join(dataDir, "uploads.json")
+
+// trackTransfer 中间件：统计进行中的传输请求，排空时等待它们完成
+func trackTransfer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		activeTransfers.Add(1)
+		defer activeTransfers.Add(-1)
+		next(w, r)
+	}
+}
+
+// trackRequests 统计正在运行的处理函数。server.Close 只关闭连接，不等待处理函数返回
+func trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		activeRequests.Add(1)
+		defer activeRequests.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitForHandlers 等待所有处理函数返回，最多等待 timeout；全部返回时返回 true
+func waitForHandlers(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for activeRequests.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// rejectNewSessions 中间件：排空期间拒绝创建新的上传会话
+func rejectNewSessions(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Server is shutting down, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// gracefulShutdown 依次：停止接受新会话，等待进行中的传输完成，关闭 HTTP 服务器，保存上传状态。
+// 整个过程不超过 timeout，超时后强制关闭剩余连接，并再等待最多 handlerGrace 让处理函数返回；
+// 仍有处理函数在运行时不关闭元数据库，避免它们写入已关闭的数据库（bbolt 在进程退出时保持一致）。
+func gracefulShutdown(server *http.Server, timeout time.Duration) {
+	draining.Store(true)
+	slog.Info("Shutting down, draining in-flight transfers", "timeout", timeout,
+		"active_transfers", activeTransfers.Load())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 监听端口保持打开，让就绪检查能报告 503，同时已有会话的分片可以继续上传
+	ticker := time.NewTicker(100 * time.Millisecond)
+	for activeTransfers.Load() > 0 && ctx.Err() == nil {
+		<-ticker.C
+	}
+	ticker.Stop()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Drain deadline exceeded, closing remaining connections",
+			"active_transfers", activeTransfers.Load(), "error", err)
+		server.Close()
+	}
+	handlersDone := waitForHandlers(handlerGrace)
+	if !handlersDone {
+		slog.Warn("Handlers still running after shutdown, leaving the metadata database open",
+			"active_requests", activeRequests.Load())
+	}
+
+	if err := saveUploadStatuses(); err != nil {
+		slog.Error("Failed to save upload sessions", "error", err)
+	}
+	if auditLog != nil {
+		auditLog.close()
+	}
+	if handlersDone {
+		closeMetadata()
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+
+	slog.Info("Server stopped")
+}
+
+// persistedUpload 保存到磁盘的上传会话，包括不在 API 中返回的字段
+type persistedUpload struct {
+	*UploadStatus
+	FinalPath string `json:"final_path"`
+	Token     string `json:"token,omitempty"`
+	Identity  string `json:"identity,omitempty"`
+}
+
+// saveUploadStatuses 保存未完成的上传会话
+func saveUploadStatuses() error {
+	statusMutex.RLock()
+	var list []persistedUpload
+	for _, status := range uploadStatuses {
+		if !status.Completed {
+			list = append(list, persistedUpload{status, status.FinalPath, status.Token, status.Identity})
+		}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	statusMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(uploadsStateFile+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(uploadsStateFile+".tmp", uploadsStateFile); err != nil {
+		return err
+	}
+	slog.Info("Saved upload sessions", "count", len(list), "file", uploadsStateFile)
+	return nil
+}
+
+// loadUploadStatuses 恢复上次退出时保存的上传会话；只保留磁盘上确实存在的分片
+func loadUploadStatuses() error {
+	data, err := os.ReadFile(uploadsStateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var list []persistedUpload
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid %s: %v", uploadsStateFile, err)
+	}
+
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	restored := 0
+	for _, p := range list {
+		if p.UploadStatus == nil {
+			continue
+		}
+		status := p.UploadStatus
+		status.FinalPath = p.FinalPath
+		status.Token = p.Token
+		status.Identity = p.Identity
+
+		uploaded := make([]int, 0, len(status.Uploaded))
+		for _, chunk := range status.Uploaded {
+			chunkPath := filepath.Join(tempDir, status.FileID, "chunk_"+strconv.Itoa(chunk))
+			if _, err := os.Stat(chunkPath); err == nil {
+				uploaded = append(uploaded, chunk)
+			}
+		}
+		status.Uploaded = uploaded
+		uploadStatuses[status.FileID] = status
+		restored++
+	}
+	if restored > 0 {
+		slog.Info("Restored upload sessions", "count", restored)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitForHandlers(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := trackRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-started
+
+	if waitForHandlers(100 * time.Millisecond) {
+		t.Fatal("waitForHandlers returned true while a handler was running")
+	}
+	close(release)
+	if !waitForHandlers(time.Second) {
+		t.Fatal("waitForHandlers timed out after the handler returned")
+	}
+	<-done
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	maxTags              = 32
+	maxTagValueLength    = 256
+	maxDescriptionLength = 4096
+)
+
+// tagKeyPattern 标签名：字母、数字和 . _ - /，最长 64 个字符
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,64}$`)
+
+// validateTags 检查标签和描述的格式和数量
+func validateTags(tags map[string]string, description string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("too many tags, at most %d", maxTags)
+	}
+	for key, value := range tags {
+		if !tagKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid tag name %q, use letters, digits, '.', '_', '-' or '/'", key)
+		}
+		if len(value) > maxTagValueLength {
+			return fmt.Errorf("tag %q is too long, at most %d bytes", key, maxTagValueLength)
+		}
+	}
+	if len(description) > maxDescriptionLength {
+		return fmt.Errorf("description is too long, at most %d bytes", maxDescriptionLength)
+	}
+	return nil
+}
+
+// parseTagArgs 解析 key=value 形式的标签（网页上传的 tag 表单字段）
+func parseTagArgs(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q, use key=value", arg)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// tagFilter 列表和搜索的标签条件：tag=build=1234 要求值相等，tag=build 只要求有这个标签
+type tagFilter struct {
+	key, value string
+	anyValue   bool
+}
+
+// parseTagFilters 解析查询参数中所有的 tag 条件
+func parseTagFilters(values []string) ([]tagFilter, error) {
+	var filters []tagFilter
+	for _, v := range values {
+		key, value, hasValue := strings.Cut(v, "=")
+		if !tagKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid tag filter %q", v)
+		}
+		filters = append(filters, tagFilter{key: key, value: value, anyValue: !hasValue})
+	}
+	return filters, nil
+}
+
+// matchTags 元数据满足所有标签条件时返回 true；没有条件时总是满足
+func matchTags(filters []tagFilter, m *FileMeta) bool {
+	for _, f := range filters {
+		if m == nil {
+			return false
+		}
+		value, ok := m.Tags[f.key]
+		if !ok || (!f.anyValue && value != f.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileMetaFor 返回文件的有效元数据；还没有被扫描到的文件先建立记录
+func fileMetaFor(fullPath string) (*FileMeta, error) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, opError(http.StatusBadRequest, "Tags can only be set on files")
+	}
+	rel := uploadRelPath(fullPath)
+	if m := lookupMeta(rel, info); m != nil {
+		return m, nil
+	}
+	if _, err := indexFile(fullPath, info); err != nil {
+		return nil, err
+	}
+	if m := lookupMeta(rel, info); m != nil {
+		return m, nil
+	}
+	return nil, opError(http.StatusConflict, "File is being modified, try again later")
+}
+
+// handleMetadata 查看文件的元数据、标签和描述
+//
+//	GET /api/metadata?path=builds/app.tar
+func handleMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rel := r.URL.Query().Get("path")
+	setRequestFile(r, rel, 0)
+	fullPath, ok := safeUploadPath(rel)
+	if !ok || rel == "" {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+	m, err := fileMetaFor(fullPath)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// handleMetadataUpdate 修改文件的标签和描述。tags 中的值为 null 时删除该标签，replace_tags 为 true 时用 tags 替换全部标签；
+// 不带 description 时描述保持不变
+//
+//	POST /api/metadata/update {"path": "builds/app.tar", "tags": {"build": "1234", "old": null}, "description": "nightly"}
+func handleMetadataUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path        string             `json:"path"`
+		Tags        map[string]*string `json:"tags"`
+		ReplaceTags bool               `json:"replace_tags"`
+		Description *string            `json:"description"`
+	}
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+	setRequestFile(r, req.Path, 0)
+
+	fullPath, ok := safeUploadPath(req.Path)
+	if !ok {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+	if _, err := fileMetaFor(fullPath); err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+
+	rel := uploadRelPath(fullPath)
+	var updated *FileMeta
+	err := metadataDB.Update(func(tx *bolt.Tx) error {
+		m := decodeMeta(tx.Bucket(filesBucket).Get([]byte(rel)))
+		if m == nil {
+			return opError(http.StatusConflict, "File is being modified, try again later")
+		}
+		tags := make(map[string]string)
+		if !req.ReplaceTags {
+			for key, value := range m.Tags {
+				tags[key] = value
+			}
+		}
+		for key, value := range req.Tags {
+			if value == nil {
+				delete(tags, key)
+			} else {
+				tags[key] = *value
+			}
+		}
+		description := m.Description
+		if req.Description != nil {
+			description = strings.TrimSpace(*req.Description)
+		}
+		if err := validateTags(tags, description); err != nil {
+			return opError(http.StatusBadRequest, "%s", err.Error())
+		}
+		if len(tags) == 0 {
+			tags = nil
+		}
+		m.Tags, m.Description = tags, description
+		updated = m
+		return putMeta(tx, m)
+	})
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+
+	logFrom(r).Info("Updated file tags", "path", rel, "tags", updated.Tags, "identity", identityFrom(r).Name)
+	writeFileOpResult(w, map[string]interface{}{"path": rel, "tags": updated.Tags, "description": updated.Description})
+}
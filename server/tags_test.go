@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxTags; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	atLimit := make(map[string]string)
+	for i := 0; i < maxTags; i++ {
+		atLimit[fmt.Sprintf("k%d", i)] = strings.Repeat("v", maxTagValueLength)
+	}
+
+	tests := []struct {
+		name        string
+		tags        map[string]string
+		description string
+		ok          bool
+	}{
+		{"empty", nil, "", true},
+		{"allowed characters", map[string]string{"ci/build.id_x-1": "42"}, "nightly build", true},
+		{"at limits", atLimit, strings.Repeat("d", maxDescriptionLength), true},
+		{"too many tags", tooMany, "", false},
+		{"value too long", map[string]string{"k": strings.Repeat("v", maxTagValueLength+1)}, "", false},
+		{"description too long", nil, strings.Repeat("d", maxDescriptionLength+1), false},
+		{"empty key", map[string]string{"": "v"}, "", false},
+		{"key with space", map[string]string{"build id": "v"}, "", false},
+		{"key with equals", map[string]string{"a=b": "v"}, "", false},
+		{"key too long", map[string]string{strings.Repeat("k", 65): "v"}, "", false},
+	}
+	for _, tt := range tests {
+		if err := validateTags(tt.tags, tt.description); (err == nil) != tt.ok {
+			t.Errorf("%s: validateTags error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestParseTagFilters(t *testing.T) {
+	filters, err := parseTagFilters([]string{"build", "branch=main", "empty=", "url=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tagFilter{
+		{key: "build", anyValue: true},
+		{key: "branch", value: "main"},
+		{key: "empty", value: ""},
+		{key: "url", value: "a=b"},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("filters = %+v, want %+v", filters, want)
+	}
+
+	for _, v := range []string{"", "=main", "bad key=1", "key!"} {
+		if _, err := parseTagFilters([]string{"build", v}); err == nil {
+			t.Errorf("parseTagFilters(%q) succeeded", v)
+		}
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	m := &FileMeta{Tags: map[string]string{"build": "42", "branch": "main", "empty": ""}}
+	tests := []struct {
+		filters []string
+		meta    *FileMeta
+		want    bool
+	}{
+		{nil, nil, true},
+		{nil, m, true},
+		{[]string{"build"}, m, true},
+		{[]string{"build=42", "branch=main"}, m, true},
+		{[]string{"empty="}, m, true},
+		{[]string{"empty"}, m, true},
+		{[]string{"build=43"}, m, false},
+		{[]string{"build=42", "release"}, m, false},
+		{[]string{"branch="}, m, false},
+		{[]string{"build"}, nil, false},
+		{[]string{"build"}, &FileMeta{}, false},
+	}
+	for _, tt := range tests {
+		filters, err := parseTagFilters(tt.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matchTags(filters, tt.meta); got != tt.want {
+			t.Errorf("matchTags(%v, %+v) = %v, want %v", tt.filters, tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestHandleMetadataUpdate(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	if err := os.WriteFile(filepath.Join(uploadDir, "app.tar"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(body string) int {
+		rec := httptest.NewRecorder()
+		handleMetadataUpdate(rec, httptest.NewRequest(http.MethodPost, "/api/metadata/update", strings.NewReader(body)))
+		return rec.Code
+	}
+	current := func() *FileMeta {
+		info, err := os.Stat(filepath.Join(uploadDir, "app.tar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lookupMeta("app.tar", info)
+	}
+
+	// 还没有记录的文件先建立记录再设置标签
+	if code := update(`{"path":"app.tar","tags":{"build":"42","branch":"main","stage":"qa"},"description":"  first  "}`); code != http.StatusOK {
+		t.Fatalf("set tags: status %d", code)
+	}
+	m := current()
+	if m == nil || !reflect.DeepEqual(m.Tags, map[string]string{"build": "42", "branch": "main", "stage": "qa"}) || m.Description != "first" {
+		t.Fatalf("after set: %+v", m)
+	}
+
+	// 默认合并：null 删除标签，其他标签和描述保持不变
+	if code := update(`{"path":"app.tar","tags":{"stage":null,"build":"43"}}`); code != http.StatusOK {
+		t.Fatalf("merge tags: status %d", code)
+	}
+	if m := current(); !reflect.DeepEqual(m.Tags, map[string]string{"build": "43", "branch": "main"}) || m.Description != "first" {
+		t.Errorf("after merge: %+v", m)
+	}
+
+	// replace_tags 用请求中的标签替换全部标签
+	if code := update(`{"path":"app.tar","tags":{"release":"1.0"},"replace_tags":true}`); code != http.StatusOK {
+		t.Fatalf("replace tags: status %d", code)
+	}
+	if m := current(); !reflect.DeepEqual(m.Tags, map[string]string{"release": "1.0"}) {
+		t.Errorf("after replace: %+v", m.Tags)
+	}
+
+	// 删除最后一个标签后不保留空的 map，清空描述
+	if code := update(`{"path":"app.tar","tags":{"release":null},"description":""}`); code != http.StatusOK {
+		t.Fatalf("delete last tag: status %d", code)
+	}
+	if m := current(); m.Tags != nil || m.Description != "" {
+		t.Errorf("after delete: tags %v, description %q", m.Tags, m.Description)
+	}
+
+	// 无效的标签不会写入记录
+	for _, body := range []string{
+		`{"path":"app.tar","tags":{"bad key":"1"}}`,
+		fmt.Sprintf(`{"path":"app.tar","tags":{"k":%q}}`, strings.Repeat("v", maxTagValueLength+1)),
+	} {
+		if code := update(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, code)
+		}
+	}
+	if m := current(); m.Tags != nil {
+		t.Errorf("invalid update changed tags: %v", m.Tags)
+	}
+
+	for body, status := range map[string]int{
+		`{"path":"missing.tar","tags":{"a":"1"}}`:   http.StatusNotFound,
+		`{"path":"../etc/passwd","tags":{"a":"1"}}`: http.StatusBadRequest,
+	} {
+		if code := update(body); code != status {
+			t.Errorf("%s: status %d, want %d", body, code, status)
+		}
+	}
+}
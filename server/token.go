@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenHeader = "X-Upload-Token" // 上传令牌头
+	tokensFile  = "tokens.json"    // 令牌持久化文件（位于 dataDir）
+)
+
+// UploadToken 只允许上传的令牌，绑定目标目录、大小上限和过期时间
+type UploadToken struct {
+	Token     string    `json:"token"`
+	Folder    string    `json:"folder"`              // 目标目录（相对于 uploadDir）
+	MaxBytes  int64     `json:"max_bytes,omitempty"` // 累计上传字节上限，0 表示不限
+	UsedBytes int64     `json:"used_bytes"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// expired 判断令牌是否已过期
+func (t *UploadToken) expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+// remaining 返回令牌剩余可上传字节数，-1 表示不限
+func (t *UploadToken) remaining() int64 {
+	if t.MaxBytes <= 0 {
+		return -1
+	}
+	if t.UsedBytes >= t.MaxBytes {
+		return 0
+	}
+	return t.MaxBytes - t.UsedBytes
+}
+
+var (
+	uploadTokens = make(map[string]*UploadToken)
+	tokenMutex   sync.Mutex
+	tokenSaveMu  sync.Mutex // 串行化 saveTokens，避免并发写入互相覆盖或把旧内容改名到新内容之后
+)
+
+// lookupToken 查找并校验令牌
+func lookupToken(value string) (*UploadToken, error) {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	token, exists := uploadTokens[value]
+	if !exists {
+		return nil, fmt.Errorf("Invalid upload token")
+	}
+	if token.expired() {
+		return nil, fmt.Errorf("Upload token expired")
+	}
+	return token, nil
+}
+
+// displayName 令牌在日志和审计中使用的身份名，只显示令牌的前 8 个字符
+func (t *UploadToken) displayName() string {
+	short := t.Token
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	return "token:" + short
+}
+
+// checkTokenQuota 检查令牌剩余额度是否足够（上传开始时提前拒绝，真正计入额度见 reserveTokenBytes）
+func checkTokenQuota(token *UploadToken, size int64) error {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	if remaining := token.remaining(); remaining >= 0 && size > remaining {
+		return fmt.Errorf("upload exceeds token limit: %d bytes remaining", remaining)
+	}
+	return nil
+}
+
+// reserveTokenBytes 检查额度并立即计入已用字节。检查和计入在同一把锁内完成，
+// 同一令牌的多个并发上传不会都通过检查而一起超出上限；写入失败时用 releaseTokenBytes 退回
+func reserveTokenBytes(token *UploadToken, size int64) error {
+	tokenMutex.Lock()
+	if remaining := token.remaining(); remaining >= 0 && size > remaining {
+		tokenMutex.Unlock()
+		return fmt.Errorf("upload exceeds token limit: %d bytes remaining", remaining)
+	}
+	token.UsedBytes += size
+	tokenMutex.Unlock()
+
+	if err := saveTokens(); err != nil {
+		slog.Error("Failed to save tokens", "error", err)
+	}
+	return nil
+}
+
+// releaseTokenBytes 退回 reserveTokenBytes 计入的字节
+func releaseTokenBytes(token *UploadToken, size int64) {
+	tokenMutex.Lock()
+	token.UsedBytes = max(token.UsedBytes-size, 0)
+	tokenMutex.Unlock()
+
+	if err := saveTokens(); err != nil {
+		slog.Error("Failed to save tokens", "error", err)
+	}
+}
+
+// loadTokens 从磁盘加载令牌，并丢弃已过期的令牌
+func loadTokens() error {
+	data, err := os.ReadFile(filepath.Join(dataDir, tokensFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var tokens []*UploadToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("invalid tokens file: %v", err)
+	}
+
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	for _, token := range tokens {
+		if !token.expired() {
+			uploadTokens[token.Token] = token
+		}
+	}
+	return nil
+}
+
+// saveTokens 将令牌写入磁盘（先写临时文件再重命名）
+func saveTokens() error {
+	tokenSaveMu.Lock()
+	defer tokenSaveMu.Unlock()
+
+	tokenMutex.Lock()
+	tokens := make([]*UploadToken, 0, len(uploadTokens))
+	for _, token := range uploadTokens {
+		tokens = append(tokens, token)
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	tokenMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dataDir, tokensFile)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// handleTokens 管理上传令牌：GET 列出，POST 创建
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokenMutex.Lock()
+		tokens := make([]UploadToken, 0, len(uploadTokens))
+		for _, token := range uploadTokens {
+			tokens = append(tokens, *token)
+		}
+		tokenMutex.Unlock()
+
+		sort.Slice(tokens, func(i, j int) bool {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodPost:
+		var req struct {
+			Folder    string `json:"folder"`
+			MaxBytes  int64  `json:"max_bytes"`
+			ExpiresIn string `json:"expires_in"` // 例如 "72h"，默认 24h
+			Note      string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		folder, err := cleanRelPath(req.Folder)
+		if err != nil {
+			http.Error(w, "Invalid folder", http.StatusBadRequest)
+			return
+		}
+		setRequestFile(r, filepath.ToSlash(folder), req.MaxBytes)
+
+		ttl := 24 * time.Hour
+		if req.ExpiresIn != "" {
+			ttl, err = time.ParseDuration(req.ExpiresIn)
+			if err != nil || ttl <= 0 {
+				http.Error(w, "Invalid expires_in", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Join(uploadDir, folder), 0755); err != nil {
+			http.Error(w, "Failed to create folder", http.StatusInternalServerError)
+			return
+		}
+
+		value, err := generateToken()
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		token := &UploadToken{
+			Token:     value,
+			Folder:    folder,
+			MaxBytes:  req.MaxBytes,
+			ExpiresAt: time.Now().Add(ttl),
+			CreatedAt: time.Now(),
+			Note:      req.Note,
+		}
+
+		tokenMutex.Lock()
+		uploadTokens[value] = token
+		tokenMutex.Unlock()
+
+		if err := saveTokens(); err != nil {
+			http.Error(w, "Failed to save token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      token.Token,
+			"folder":     token.Folder,
+			"max_bytes":  token.MaxBytes,
+			"expires_at": token.ExpiresAt,
+			"url":        "/drop/" + token.Token,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTokenRevoke 吊销上传令牌：DELETE /admin/tokens/<token>
+func handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	value := strings.TrimPrefix(r.URL.Path, "/admin/tokens/")
+
+	tokenMutex.Lock()
+	_, exists := uploadTokens[value]
+	delete(uploadTokens, value)
+	tokenMutex.Unlock()
+
+	if !exists {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	if err := saveTokens(); err != nil {
+		http.Error(w, "Failed to save tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cleanRelPath 规范化相对路径，拒绝绝对路径和越出根目录的路径
+func cleanRelPath(p string) (string, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if strings.HasPrefix(p, "/") {
+		p = strings.TrimLeft(p, "/")
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(p))
+	if cleaned == "." {
+		return "", nil
+	}
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path escapes root: %s", p)
+	}
+	return cleaned, nil
+}
+
+// resolveUploadPath 计算上传文件的最终路径。
+// 令牌身份的文件只能落在令牌绑定的目录下。
+func resolveUploadPath(id *Identity, name string) (string, error) {
+	rel, err := cleanRelPath(name)
+	if err != nil || rel == "" {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	if id.Token != nil {
+		rel = filepath.Join(id.Token.Folder, rel)
+	}
+	fullPath := filepath.Join(uploadDir, rel)
+	if !insideUploadDir(fullPath) {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	return fullPath, nil
+}
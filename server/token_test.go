@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTokenDisplayName(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"0123456789abcdef", "token:01234567"},
+		{"01234567", "token:01234567"},
+		{"abc", "token:abc"},
+		{"", "token:"},
+	}
+	for _, tt := range tests {
+		token := &UploadToken{Token: tt.token}
+		if got := token.displayName(); got != tt.want {
+			t.Errorf("displayName(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestReserveTokenBytesConcurrent(t *testing.T) {
+	chdirTemp(t)
+	token := &UploadToken{Token: "concurrent", MaxBytes: 100}
+	tokenMutex.Lock()
+	uploadTokens[token.Token] = token
+	tokenMutex.Unlock()
+	t.Cleanup(func() {
+		tokenMutex.Lock()
+		delete(uploadTokens, token.Token)
+		tokenMutex.Unlock()
+	})
+
+	// 20 个 30 字节的上传同时开始，最多只能有 3 个计入额度
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reserveTokenBytes(token, 30) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 3 {
+		t.Errorf("accepted %d uploads, want 3", accepted)
+	}
+	if token.UsedBytes != 90 {
+		t.Errorf("UsedBytes = %d, want 90", token.UsedBytes)
+	}
+
+	releaseTokenBytes(token, 30)
+	if token.UsedBytes != 60 {
+		t.Errorf("UsedBytes after release = %d, want 60", token.UsedBytes)
+	}
+	if err := reserveTokenBytes(token, 41); err == nil {
+		t.Error("reservation beyond the remaining quota succeeded")
+	}
+}
+
+func TestTokenUpload(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	setServiceKey(t, "secret-key")
+	token := &UploadToken{Token: "0123456789abcdef", Folder: "drop", MaxBytes: 1 << 20}
+	tokenMutex.Lock()
+	uploadTokens[token.Token] = token
+	tokenMutex.Unlock()
+	t.Cleanup(func() {
+		tokenMutex.Lock()
+		delete(uploadTokens, token.Token)
+		tokenMutex.Unlock()
+	})
+	srv := newTestServer(t)
+
+	// 和客户端相同的请求顺序：先查询服务器信息，再初始化、上传分片、完成
+	do := func(method, path string, body string, token string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set(tokenHeader, token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do(http.MethodGet, "/api/info", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("info without credentials: status %d, want 401", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/api/info", "", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("info with an invalid token: status %d, want 401", resp.StatusCode)
+	}
+	resp := do(http.MethodGet, "/api/info", "", token.Token)
+	var info struct {
+		Identity string `json:"identity"`
+		Role     string `json:"role"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("info with token: status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Identity != "token:01234567" || info.Role != roleUpload {
+		t.Errorf("info identity = %s (%s), want token:01234567 (%s)", info.Identity, info.Role, roleUpload)
+	}
+
+	content := "uploaded with a token"
+	resp = do(http.MethodPost, "/upload/init", fmt.Sprintf(`{"file_name": "report.txt", "total_size": %d}`, len(content)), token.Token)
+	var init struct {
+		FileID string `json:"file_id"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("init: status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&init); err != nil {
+		t.Fatal(err)
+	}
+	if resp := do(http.MethodPost, "/upload/chunk/"+init.FileID+"/0", content, token.Token); resp.StatusCode != http.StatusOK {
+		t.Fatalf("chunk: status %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/upload/complete/"+init.FileID, "", token.Token); resp.StatusCode != http.StatusOK {
+		t.Fatalf("complete: status %d", resp.StatusCode)
+	}
+
+	data, err := os.ReadFile(filepath.Join(uploadDir, "drop", "report.txt"))
+	if err != nil || string(data) != content {
+		t.Errorf("uploaded file = %q, %v, want %q", data, err, content)
+	}
+	if token.UsedBytes != int64(len(content)) {
+		t.Errorf("UsedBytes = %d, want %d", token.UsedBytes, len(content))
+	}
+}
+
+func TestSaveTokensConcurrent(t *testing.T) {
+	chdirTemp(t)
+	tokenMutex.Lock()
+	saved := uploadTokens
+	uploadTokens = make(map[string]*UploadToken)
+	for i := 0; i < 50; i++ {
+		token := fmt.Sprintf("token-%02d", i)
+		uploadTokens[token] = &UploadToken{Token: token, Folder: "drop", MaxBytes: 1 << 30}
+	}
+	tokenMutex.Unlock()
+	t.Cleanup(func() {
+		tokenMutex.Lock()
+		uploadTokens = saved
+		tokenMutex.Unlock()
+	})
+
+	// 并行上传时每次计入和退回额度都会保存一次
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, _ := lookupToken(fmt.Sprintf("token-%02d", i))
+			for j := 0; j < 10; j++ {
+				if err := reserveTokenBytes(token, 100); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 文件是最后一次保存的完整内容
+	data, err := os.ReadFile(filepath.Join(dataDir, tokensFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens []*UploadToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		t.Fatalf("tokens file is corrupt: %v", err)
+	}
+	if len(tokens) != 50 {
+		t.Fatalf("tokens file has %d tokens, want 50", len(tokens))
+	}
+	for _, token := range tokens {
+		var i int
+		fmt.Sscanf(token.Token, "token-%d", &i)
+		want := int64(0)
+		if i < 20 {
+			want = 1000
+		}
+		if token.UsedBytes != want {
+			t.Errorf("%s used %d bytes on disk, want %d", token.Token, token.UsedBytes, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, tokensFile+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
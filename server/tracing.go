@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingConfig OpenTelemetry 链路追踪配置
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`     // otlp 或 stdout，为空表示关闭
+	Endpoint    string  `json:"endpoint"`     // OTLP/HTTP 地址，例如 http://localhost:4318；为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 或默认值
+	SampleRatio float64 `json:"sample_ratio"` // 采样比例，0 表示全部采样
+}
+
+var tracer = otel.Tracer("ctrans-server")
+
+// initTracing 初始化追踪导出器，返回用于刷新缓冲数据的关闭函数。
+// 无论是否导出，都会解析请求中的 W3C traceparent，让日志等能关联到上游的追踪。
+func initTracing(cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			endpoint := cfg.Endpoint
+			if !strings.Contains(endpoint, "://") {
+				endpoint = "http://" + endpoint
+			}
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q (expected otlp or stdout)", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("ctrans-server"), semconv.ServiceVersion(version))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware 为每个请求创建服务端 span，以匹配的路由命名；指标和健康检查不追踪
+func tracingMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "ctrans-server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			_, pattern := mux.Handler(r)
+			if pattern == "" {
+				pattern = r.URL.Path
+			}
+			return r.Method + " " + pattern
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/metrics", "/healthz", "/readyz":
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// spanError 在 span 上记录错误
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// setSpanFile 在当前请求的 span 上记录文件信息
+func setSpanFile(r *http.Request, path string, size int64) {
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("ctrans.path", path),
+		attribute.Int64("ctrans.size", size),
+	)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans 使用只记录到内存的追踪器，测试结束后恢复
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	if _, err := initTracing(TracingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func TestTracingPropagation(t *testing.T) {
+	recorder := recordSpans(t)
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	mux := http.NewServeMux()
+	var handlerSpan trace.SpanContext
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		logFrom(r).Info("handled")
+	}
+	mux.HandleFunc("/files", handle)
+	mux.HandleFunc("/healthz", handle)
+	handler := tracingMiddleware(mux, requestMiddleware(mux))
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/files?path=builds", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /files" {
+		t.Errorf("span name = %q, want GET /files", span.Name())
+	}
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span kind = %v, want server", span.SpanKind())
+	}
+	if span.SpanContext().TraceID().String() != traceID || span.Parent().SpanID().String() != spanID || !span.Parent().IsRemote() {
+		t.Errorf("span trace %s parent %s, want trace %s under remote parent %s",
+			span.SpanContext().TraceID(), span.Parent().SpanID(), traceID, spanID)
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("handler context span %s, want the server span %s", handlerSpan.SpanID(), span.SpanContext().SpanID())
+	}
+
+	// 请求日志带有上游的 trace_id
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log output %q: %v", logs.String(), err)
+	}
+	if entry["trace_id"] != traceID || entry["request_id"] == "" {
+		t.Errorf("log entry = %v, want trace_id %s and a request_id", entry, traceID)
+	}
+
+	// 健康检查不创建 span
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if n := len(recorder.Ended()); n != 1 {
+		t.Errorf("recorded %d spans after /healthz, want 1", n)
+	}
+}
+
+func TestInitTracingExporters(t *testing.T) {
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	if _, err := initTracing(TracingConfig{Exporter: "zipkin"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+	shutdown, err := initTracing(TracingConfig{Exporter: "otlp", Endpoint: "localhost:4318", SampleRatio: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
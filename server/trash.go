@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrashConfig 回收站：删除和被覆盖的文件先移入回收站，超过保留期后自动清除
+type TrashConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Retention Duration `json:"retention"` // 保留时长，0 表示只能手动清除
+}
+
+// TrashEntry 回收站中的一项，元数据保存在 <trash>/<id>/meta.json，内容保存在 <trash>/<id>/data，
+// 文件的元数据记录（标签、描述、上传者等）保存在 <trash>/<id>/files.json，恢复时一起恢复
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"` // 原路径（相对上传目录）
+	IsDir     bool      `json:"is_dir"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by"`
+	Reason    string    `json:"reason"` // delete 或 overwrite
+}
+
+const (
+	trashMeta    = "meta.json"
+	trashData    = "data"
+	trashRecords = "files.json"
+)
+
+var (
+	trashDir   = filepath.Join(dataDir, "trash")
+	trashMutex sync.Mutex // 保护 trash 配置以及回收站目录的增删
+	trash      TrashConfig
+)
+
+// applyTrash 应用回收站配置，可热加载
+func applyTrash(cfg TrashConfig) {
+	trashMutex.Lock()
+	trash = cfg
+	trashMutex.Unlock()
+}
+
+func trashEnabled() bool {
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+	return trash.Enabled
+}
+
+// moveToTrash 把上传目录中的文件或目录移入回收站
+func moveToTrash(fullPath, reason, identity string) (*TrashEntry, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if info.IsDir() {
+		if size, err = treeSize(fullPath); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := &TrashEntry{
+		ID:        time.Now().UTC().Format("20060102T150405") + "-" + randomString(6),
+		Path:      uploadRelPath(fullPath),
+		IsDir:     info.IsDir(),
+		Size:      size,
+		DeletedAt: time.Now().UTC(),
+		DeletedBy: identity,
+		Reason:    reason,
+	}
+	dir := filepath.Join(trashDir, entry.ID)
+
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	data, _ := json.MarshalIndent(entry, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, trashMeta), data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if records := metaRecords(entry.Path); len(records) > 0 {
+		data, _ := json.Marshal(records)
+		if err := os.WriteFile(filepath.Join(dir, trashRecords), data, 0600); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	if err := moveAcross(fullPath, filepath.Join(dir, trashData), info); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// moveAcross 移动文件或目录；源和目标不在同一文件系统时改为复制后删除
+func moveAcross(src, dst string, info os.FileInfo) error {
+	err := os.Rename(src, dst)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if info.IsDir() {
+		err = copyDir(src, dst)
+	} else {
+		err = copyFile(src, dst, info.Mode())
+	}
+	if err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// listTrash 按删除时间倒序返回回收站内容，损坏的条目跳过
+func listTrash() ([]TrashEntry, error) {
+	dirs, err := os.ReadDir(trashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TrashEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []TrashEntry{}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		entry, err := readTrashEntry(d.Name())
+		if err != nil {
+			slog.Warn("Skipping invalid trash entry", "id", d.Name(), "error", err)
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DeletedAt.After(entries[j].DeletedAt) })
+	return entries, nil
+}
+
+func readTrashEntry(id string) (*TrashEntry, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return nil, fs.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(trashDir, id, trashMeta))
+	if err != nil {
+		return nil, err
+	}
+	var entry TrashEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	entry.ID = id
+	return &entry, nil
+}
+
+// restoreTrashMeta 恢复条目时把文件的元数据记录写回，路径换成恢复后的位置
+func restoreTrashMeta(entry *TrashEntry, to string) {
+	data, err := os.ReadFile(filepath.Join(trashDir, entry.ID, trashRecords))
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var records []*FileMeta
+	if err == nil {
+		err = json.Unmarshal(data, &records)
+	}
+	if err != nil {
+		slog.Warn("Failed to read metadata of trash entry", "id", entry.ID, "error", err)
+		return
+	}
+	restoreMeta(records, entry.Path, to)
+}
+
+// purgeTrash 永久删除回收站条目。先删除内容、最后删除元数据，
+// 删除中途失败时条目仍然出现在回收站列表中，可以重试
+func purgeTrash(id string) error {
+	if _, err := readTrashEntry(id); err != nil {
+		return err
+	}
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+	dir := filepath.Join(trashDir, id)
+	if err := os.RemoveAll(filepath.Join(dir, trashData)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// purgeExpiredTrash 清除超过保留期的条目
+func purgeExpiredTrash() {
+	trashMutex.Lock()
+	retention := trash.Retention.Duration
+	trashMutex.Unlock()
+	if retention <= 0 {
+		return
+	}
+
+	entries, err := listTrash()
+	if err != nil {
+		slog.Error("Failed to read trash", "error", err)
+		return
+	}
+	cutoff := time.Now().Add(-retention)
+	for _, entry := range entries {
+		if entry.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := purgeTrash(entry.ID); err != nil {
+			slog.Error("Failed to purge trash entry", "id", entry.ID, "error", err)
+			continue
+		}
+		slog.Info("Purged expired trash entry", "id", entry.ID, "path", entry.Path, "deleted_at", entry.DeletedAt)
+	}
+}
+
+// startTrashPurger 启动时和之后每小时清除过期条目
+func startTrashPurger() {
+	go func() {
+		for {
+			purgeExpiredTrash()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// handleTrashList 列出回收站
+//
+//	GET /api/trash
+func handleTrashList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries, err := listTrash()
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleTrashRestore 恢复回收站条目，默认恢复到原路径；目标已存在的文件在 overwrite 时先移入回收站
+//
+//	POST /api/trash/restore {"id": "20240601T101500-abcdefgh", "to": "", "overwrite": false}
+func handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID        string `json:"id"`
+		To        string `json:"to"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+
+	entry, err := readTrashEntry(req.ID)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Trash entry not found", http.StatusNotFound)
+		} else {
+			writeFileOpError(w, r, err)
+		}
+		return
+	}
+	if req.To == "" {
+		req.To = entry.Path
+	}
+	setRequestFile(r, req.To, entry.Size)
+
+	dst, ok := safeUploadPath(req.To)
+	if !ok {
+		http.Error(w, "Invalid destination path", http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Lstat(dst); err == nil {
+		if info.IsDir() || entry.IsDir || !req.Overwrite {
+			http.Error(w, "Destination already exists", http.StatusConflict)
+			return
+		}
+		if err := preserveExisting(r, dst); err != nil {
+			writeFileOpError(w, r, err)
+			return
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+
+	src := filepath.Join(trashDir, entry.ID, trashData)
+	info, err := os.Lstat(src)
+	if err == nil {
+		err = moveAcross(src, dst, info)
+	}
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+	restoreTrashMeta(entry, uploadRelPath(dst))
+	if err := purgeTrash(entry.ID); err != nil {
+		logFrom(r).Warn("Failed to remove restored trash entry", "id", entry.ID, "error", err)
+	}
+
+	logFrom(r).Info("Restored from trash", "id", entry.ID, "path", req.To, "identity", identityFrom(r).Name)
+	writeFileOpResult(w, map[string]interface{}{"id": entry.ID, "path": req.To})
+}
+
+// handleTrashPurge 永久删除指定条目，all 为 true 时清空回收站。
+// 部分条目失败时返回 207，failed 中列出失败的条目和原因
+//
+//	POST /api/trash/purge {"ids": ["20240601T101500-abcdefgh"]}
+//	POST /api/trash/purge {"all": true}
+func handleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+		All bool     `json:"all"`
+	}
+	if !decodeFileOp(w, r, &req) {
+		return
+	}
+	if req.All {
+		entries, err := listTrash()
+		if err != nil {
+			writeFileOpError(w, r, err)
+			return
+		}
+		req.IDs = req.IDs[:0]
+		for _, entry := range entries {
+			req.IDs = append(req.IDs, entry.ID)
+		}
+	} else if len(req.IDs) == 0 {
+		http.Error(w, "No trash entries specified", http.StatusBadRequest)
+		return
+	}
+
+	// 单个条目失败不影响其他条目，结果中分别列出已删除和失败的条目
+	purged := []string{}
+	failed := []trashPurgeFailure{}
+	for _, id := range req.IDs {
+		if err := purgeTrash(id); err != nil {
+			msg := "Failed to remove trash entry"
+			if errors.Is(err, fs.ErrNotExist) {
+				msg = "Trash entry not found"
+			} else {
+				logFrom(r).Error("Failed to purge trash entry", "id", id, "error", err)
+			}
+			failed = append(failed, trashPurgeFailure{ID: id, Error: msg})
+			continue
+		}
+		purged = append(purged, id)
+	}
+
+	logFrom(r).Info("Purged trash", "count", len(purged), "failed", len(failed), "identity", identityFrom(r).Name)
+	if len(failed) == 0 {
+		writeFileOpResult(w, map[string]interface{}{"purged": purged})
+		return
+	}
+	status := "partial"
+	if len(purged) == 0 {
+		status = "failed"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "purged": purged, "failed": failed})
+}
+
+// trashPurgeFailure 清除失败的回收站条目
+type trashPurgeFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// trashFiles 在上传目录中创建文件并移入回收站，返回条目 ID
+func trashFiles(t *testing.T, names ...string) []string {
+	t.Helper()
+	var ids []string
+	for _, name := range names {
+		fullPath := filepath.Join(uploadDir, name)
+		if err := os.WriteFile(fullPath, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := moveToTrash(fullPath, "delete", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestHandleTrashPurge(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+
+	tests := []struct {
+		name   string
+		files  []string
+		extra  []string // 不存在或无效的条目
+		all    bool
+		code   int
+		status string
+	}{
+		{"all purged", []string{"a.txt", "b.txt"}, nil, false, http.StatusOK, "ok"},
+		{"empty all", nil, nil, true, http.StatusOK, "ok"},
+		{"purge all", []string{"c.txt", "d.txt"}, nil, true, http.StatusOK, "ok"},
+		{"continues past missing entries", []string{"e.txt", "f.txt"}, []string{"20240101T000000-missing", "../escape"}, false, http.StatusMultiStatus, "partial"},
+		{"nothing purged", nil, []string{"20240101T000000-missing"}, false, http.StatusMultiStatus, "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := trashFiles(t, tt.files...)
+			body, _ := json.Marshal(map[string]interface{}{"ids": append(append([]string{}, ids...), tt.extra...), "all": tt.all})
+			rec := httptest.NewRecorder()
+			handleTrashPurge(rec, httptest.NewRequest(http.MethodPost, "/api/trash/purge", strings.NewReader(string(body))))
+			if rec.Code != tt.code {
+				t.Fatalf("status code = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+
+			var resp struct {
+				Status string              `json:"status"`
+				Purged []string            `json:"purged"`
+				Failed []trashPurgeFailure `json:"failed"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.status {
+				t.Errorf("status = %q, want %q", resp.Status, tt.status)
+			}
+			sort.Strings(ids)
+			sort.Strings(resp.Purged)
+			if strings.Join(resp.Purged, ",") != strings.Join(ids, ",") {
+				t.Errorf("purged = %v, want %v", resp.Purged, ids)
+			}
+			if len(resp.Failed) != len(tt.extra) {
+				t.Fatalf("failed = %v, want %v", resp.Failed, tt.extra)
+			}
+			for i, f := range resp.Failed {
+				if f.ID != tt.extra[i] || f.Error != "Trash entry not found" {
+					t.Errorf("failure %d = %+v, want %s not found", i, f, tt.extra[i])
+				}
+			}
+
+			entries, err := listTrash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("%d entries left in the trash", len(entries))
+			}
+		})
+	}
+}
+
+func TestPurgeTrashRetry(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	ids := trashFiles(t, "a.txt")
+
+	// 内容已经删除但元数据还在的条目仍可以再次清除
+	if err := os.RemoveAll(filepath.Join(trashDir, ids[0], trashData)); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := listTrash(); len(entries) != 1 {
+		t.Fatalf("trash has %d entries, want 1", len(entries))
+	}
+	if err := purgeTrash(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(trashDir, ids[0])); !os.IsNotExist(err) {
+		t.Errorf("entry directory still exists: %v", err)
+	}
+}
+
+func TestTrashRestoreKeepsMetadata(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	applyTrash(TrashConfig{Enabled: true})
+	t.Cleanup(func() { applyTrash(TrashConfig{}) })
+	writeUploads(t, map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "c"})
+	if _, _, err := reconcileMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"a.txt", "dir/sub/c.txt"} {
+		updateMeta(t, rel, func(m *FileMeta) {
+			m.UploadedBy = "user:alice"
+			m.Tags = map[string]string{"build": rel}
+			m.Description = "kept"
+		})
+	}
+
+	tests := []struct {
+		name   string
+		delete string
+		to     string
+		want   map[string]string // 恢复后的路径 -> build 标签
+	}{
+		{"file", "a.txt", "", map[string]string{"a.txt": "a.txt"}},
+		{"directory to a new path", "dir", "restored", map[string]string{"restored/sub/c.txt": "dir/sub/c.txt", "restored/b.txt": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleDelete(rec, httptest.NewRequest(http.MethodPost, "/api/delete", strings.NewReader(`{"path": "`+tt.delete+`", "recursive": true}`)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+			}
+			var deleted struct {
+				TrashID string `json:"trash_id"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &deleted)
+			if len(metaUnder(tt.delete)) != 0 {
+				t.Error("records of the deleted path were not removed")
+			}
+
+			rec = httptest.NewRecorder()
+			body, _ := json.Marshal(map[string]string{"id": deleted.TrashID, "to": tt.to})
+			handleTrashRestore(rec, httptest.NewRequest(http.MethodPost, "/api/trash/restore", strings.NewReader(string(body))))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("restore: status %d: %s", rec.Code, rec.Body)
+			}
+			for rel, tag := range tt.want {
+				info, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(rel)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				m := lookupMeta(rel, info)
+				if m == nil || m.SHA256 == "" {
+					t.Fatalf("%s has no valid record after restore", rel)
+				}
+				if m.Tags["build"] != tag || (tag != "" && (m.UploadedBy != "user:alice" || m.Description != "kept")) {
+					t.Errorf("%s record = %+v, want tag %q from before the delete", rel, m, tag)
+				}
+			}
+		})
+	}
+}
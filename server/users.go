@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// User 用户文件中的一条记录。
+// 文件格式与 htpasswd -B 兼容：每行 "用户名:bcrypt哈希"，可选第三列指定角色。
+type User struct {
+	Name string
+	Hash string
+	Role string
+}
+
+const defaultUserRole = roleReadWrite
+
+var (
+	users        map[string]*User // nil 表示未启用用户文件
+	usersPath    string           // 当前使用的用户文件，切换后旧文件的监视协程退出
+	usersMutex   sync.RWMutex
+	verifiedAuth = make(map[string]time.Time) // 最近验证成功的凭据摘要，避免每个请求都计算 bcrypt
+	verifiedMu   sync.Mutex
+)
+
+// dummyHash 用户不存在时也执行一次 bcrypt 比较，避免通过耗时判断用户是否存在
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("ctrans"), bcrypt.DefaultCost)
+
+// parseUsersFile 读取用户文件，忽略空行和 # 注释
+func parseUsersFile(path string) (map[string]*User, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string]*User)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash[:role]", path, lineNum)
+		}
+		if _, err := bcrypt.Cost([]byte(fields[1])); err != nil {
+			return nil, fmt.Errorf("%s:%d: user %s does not have a bcrypt hash", path, lineNum, fields[0])
+		}
+
+		user := &User{Name: fields[0], Hash: fields[1], Role: defaultUserRole}
+		if len(fields) == 3 && fields[2] != "" {
+			if !validRole(fields[2]) || fields[2] == roleUpload {
+				return nil, fmt.Errorf("%s:%d: invalid role %q", path, lineNum, fields[2])
+			}
+			user.Role = fields[2]
+		}
+		result[user.Name] = user
+	}
+	return result, scanner.Err()
+}
+
+// writeUsersFile 按用户名排序写回用户文件
+func writeUsersFile(path string, list map[string]*User) error {
+	names := make([]string, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		user := list[name]
+		if user.Role == defaultUserRole {
+			fmt.Fprintf(&b, "%s:%s\n", user.Name, user.Hash)
+		} else {
+			fmt.Fprintf(&b, "%s:%s:%s\n", user.Name, user.Hash, user.Role)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadUsers 加载用户文件并在文件变化时自动重新加载
+func loadUsers(path string) error {
+	apply, err := prepareUsers(path)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// prepareUsers 解析用户文件，返回的函数切换到新的用户列表；path 为空表示关闭 Basic 认证
+func prepareUsers(path string) (func(), error) {
+	var list map[string]*User
+	if path != "" {
+		var err error
+		if list, err = parseUsersFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		usersMutex.Lock()
+		changed := usersPath != path
+		users = list
+		usersPath = path
+		usersMutex.Unlock()
+		refreshUserState(list)
+
+		if changed && path != "" {
+			go watchUsersFile(path)
+		}
+	}, nil
+}
+
+// watchUsersFile 轮询用户文件的修改时间，变化后重新加载；解析失败时保留旧内容
+func watchUsersFile(path string) {
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(path); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		usersMutex.RLock()
+		current := usersPath
+		usersMutex.RUnlock()
+		if current != path {
+			return
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || (info.ModTime().Equal(lastMod) && info.Size() == lastSize) {
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+
+		list, err := parseUsersFile(path)
+		if err != nil {
+			slog.Error("Failed to reload users file, keeping previous users", "file", path, "error", err)
+			continue
+		}
+
+		usersMutex.Lock()
+		if usersPath == path {
+			users = list
+		}
+		usersMutex.Unlock()
+		refreshUserState(list)
+
+		slog.Info("Reloaded users file", "file", path, "users", len(list))
+	}
+}
+
+// refreshUserState 用户列表变化后清空凭据缓存，并结束已删除、改了密码或角色的用户的网页会话
+func refreshUserState(list map[string]*User) {
+	verifiedMu.Lock()
+	verifiedAuth = make(map[string]time.Time)
+	verifiedMu.Unlock()
+
+	dropped := dropSessions(func(id *Identity) bool {
+		name, ok := strings.CutPrefix(id.Name, "user:")
+		if !ok {
+			return false
+		}
+		user := list[name]
+		return user == nil || user.Hash != id.userHash || user.Role != id.Role
+	})
+	if dropped > 0 {
+		slog.Info("Ended web sessions of removed or changed users", "sessions", dropped)
+	}
+}
+
+// usersEnabled 是否启用了用户文件
+func usersEnabled() bool {
+	usersMutex.RLock()
+	defer usersMutex.RUnlock()
+	return users != nil
+}
+
+// checkUserPassword 校验用户名和密码，成功时返回对应身份
+func checkUserPassword(name, password string) (*Identity, bool) {
+	usersMutex.RLock()
+	user, exists := users[name]
+	usersMutex.RUnlock()
+
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, false
+	}
+
+	// 命中缓存时跳过 bcrypt（分片上传等高频请求）
+	digest := sha256.Sum256([]byte(user.Name + "\x00" + user.Hash + "\x00" + password))
+	cacheKey := hex.EncodeToString(digest[:])
+
+	verifiedMu.Lock()
+	expiry, cached := verifiedAuth[cacheKey]
+	verifiedMu.Unlock()
+
+	if !cached || time.Now().After(expiry) {
+		if bcrypt.CompareHashAndPassword([]byte(user.Hash), []byte(password)) != nil {
+			return nil, false
+		}
+		verifiedMu.Lock()
+		verifiedAuth[cacheKey] = time.Now().Add(5 * time.Minute)
+		verifiedMu.Unlock()
+	}
+
+	return &Identity{Name: "user:" + user.Name, Role: user.Role, userHash: user.Hash}, true
+}
+
+// runUserCommand 处理 "ctrans-server user ..." 子命令
+func runUserCommand(args []string) {
+	fs := flag.NewFlagSet("user", flag.ExitOnError)
+	file := fs.String("file", filepath.Join(dataDir, "users.htpasswd"), "Users file to edit")
+	role := fs.String("role", defaultUserRole, "Role for the user: admin, readwrite or readonly")
+	passwordStdin := fs.Bool("password-stdin", false, "Read the password from stdin instead of prompting")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s user add [options] <name>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s user passwd [options] <name>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s user remove [options] <name>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s user list [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	list, err := parseUsersFile(*file)
+	if os.IsNotExist(err) {
+		list = make(map[string]*User)
+	} else if err != nil {
+		fatal("Failed to read users file", "file", *file, "error", err)
+	}
+
+	if action == "list" {
+		names := make([]string, 0, len(list))
+		for name := range list {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-20s %s\n", name, list[name].Role)
+		}
+		return
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
+	if strings.ContainsAny(name, ": \t\n") {
+		fatal("User name must not contain ':' or whitespace")
+	}
+
+	switch action {
+	case "add", "passwd":
+		user, exists := list[name]
+		if action == "add" && exists {
+			fatal("User already exists, use passwd to change the password", "user", name)
+		}
+		if action == "passwd" && !exists {
+			fatal("User does not exist", "user", name)
+		}
+		if action == "add" {
+			if !validRole(*role) || *role == roleUpload {
+				fatal("Invalid role", "role", *role)
+			}
+			user = &User{Name: name, Role: *role}
+			list[name] = user
+		}
+
+		password, err := readPassword(*passwordStdin)
+		if err != nil {
+			fatal("Failed to read password", "error", err)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			fatal("Failed to hash password", "error", err)
+		}
+		user.Hash = string(hash)
+
+	case "remove":
+		if _, exists := list[name]; !exists {
+			fatal("User does not exist", "user", name)
+		}
+		delete(list, name)
+
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if err := writeUsersFile(*file, list); err != nil {
+		fatal("Failed to write users file", "error", err)
+	}
+	fmt.Printf("Users file %s updated\n", *file)
+}
+
+// readPassword 从终端读取密码（输入两次确认），或从标准输入读取一行
+func readPassword(fromStdin bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if fromStdin || !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("empty password")
+		}
+		return line, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("empty password")
+	}
+	return string(first), nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptHash 生成测试用的低成本 bcrypt 哈希
+func bcryptHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+// withStdin 把 input 作为标准输入运行 fn，返回 fn 写到标准输出的内容
+func withStdin(t *testing.T, input string, fn func()) string {
+	t.Helper()
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinR, stdoutW
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	io.WriteString(stdinW, input)
+	stdinW.Close()
+	fn()
+	stdoutW.Close()
+	out, _ := io.ReadAll(stdoutR)
+	stdinR.Close()
+	return string(out)
+}
+
+func TestParseUsersFile(t *testing.T) {
+	hash := bcryptHash(t, "secret")
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string // 用户名 -> 角色
+		err     string
+	}{
+		{"default role", "alice:" + hash + "\n", map[string]string{"alice": roleReadWrite}, ""},
+		{"explicit roles", "alice:" + hash + ":admin\nbob:" + hash + ":readonly\n", map[string]string{"alice": roleAdmin, "bob": roleReadOnly}, ""},
+		{"empty role column", "alice:" + hash + ":\n", map[string]string{"alice": roleReadWrite}, ""},
+		{"comments and blank lines", "# users\n\n  alice:" + hash + "  \n", map[string]string{"alice": roleReadWrite}, ""},
+		{"empty file", "", map[string]string{}, ""},
+		{"missing hash", "alice\n", nil, ":1: expected user:hash[:role]"},
+		{"empty name", ":" + hash + "\n", nil, ":1: expected user:hash[:role]"},
+		{"too many fields", "alice:" + hash + ":admin:extra\n", nil, ":1: expected user:hash[:role]"},
+		{"plain text password", "# ok\nalice:secret\n", nil, ":2: user alice does not have a bcrypt hash"},
+		{"apr1 hash", "alice:$apr1$abc$def\n", nil, "does not have a bcrypt hash"},
+		{"unknown role", "alice:" + hash + ":root\n", nil, `:1: invalid role "root"`},
+		{"upload role", "alice:" + hash + ":upload\n", nil, `:1: invalid role "upload"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "users")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			list, err := parseUsersFile(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != len(tt.want) {
+				t.Fatalf("got %d users, want %d", len(list), len(tt.want))
+			}
+			for name, role := range tt.want {
+				if list[name] == nil || list[name].Role != role || list[name].Hash != hash {
+					t.Errorf("user %s = %+v, want role %s", name, list[name], role)
+				}
+			}
+		})
+	}
+}
+
+func TestUsersReload(t *testing.T) {
+	if err := initSessions(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "users")
+	write := func(list map[string]*User) {
+		t.Helper()
+		if err := writeUsersFile(path, list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := &User{Name: "alice", Hash: bcryptHash(t, "alice-pw"), Role: roleReadWrite}
+	bob := &User{Name: "bob", Hash: bcryptHash(t, "bob-pw"), Role: roleReadOnly}
+	carol := &User{Name: "carol", Hash: bcryptHash(t, "carol-pw"), Role: roleAdmin}
+	dave := &User{Name: "dave", Hash: bcryptHash(t, "dave-pw"), Role: roleReadWrite}
+	write(map[string]*User{"alice": alice, "bob": bob, "carol": carol, "dave": dave})
+	if err := loadUsers(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		loadUsers("")
+		dropSessions(func(*Identity) bool { return true })
+	})
+
+	login := func(name, password string) *Session {
+		t.Helper()
+		id, ok := checkUserPassword(name, password)
+		if !ok {
+			t.Fatalf("%s cannot sign in", name)
+		}
+		return createSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil), id)
+	}
+	sessions := map[string]*Session{
+		"alice": login("alice", "alice-pw"),
+		"bob":   login("bob", "bob-pw"),
+		"carol": login("carol", "carol-pw"),
+		"dave":  login("dave", "dave-pw"),
+	}
+	verifiedMu.Lock()
+	cached := len(verifiedAuth)
+	verifiedMu.Unlock()
+	if cached != 4 {
+		t.Fatalf("%d cached credentials, want 4", cached)
+	}
+
+	// bob 被删除，carol 改了角色，dave 改了密码，alice 不变
+	carol = &User{Name: "carol", Hash: carol.Hash, Role: roleReadOnly}
+	dave = &User{Name: "dave", Hash: bcryptHash(t, "new-pw"), Role: roleReadWrite}
+	write(map[string]*User{"alice": alice, "carol": carol, "dave": dave})
+	if err := loadUsers(path); err != nil {
+		t.Fatal(err)
+	}
+
+	verifiedMu.Lock()
+	cached = len(verifiedAuth)
+	verifiedMu.Unlock()
+	if cached != 0 {
+		t.Errorf("%d cached credentials left after reload", cached)
+	}
+	for name, want := range map[string]bool{"alice": true, "bob": false, "carol": false, "dave": false} {
+		if got := hasSession(sessions[name]); got != want {
+			t.Errorf("%s session valid = %v, want %v", name, got, want)
+		}
+	}
+	if _, ok := checkUserPassword("bob", "bob-pw"); ok {
+		t.Error("removed user can still sign in")
+	}
+	if _, ok := checkUserPassword("dave", "dave-pw"); ok {
+		t.Error("old password still accepted")
+	}
+	if id, ok := checkUserPassword("carol", "carol-pw"); !ok || id.Role != roleReadOnly {
+		t.Errorf("carol = %+v, %v, want role %s", id, ok, roleReadOnly)
+	}
+
+	// 关闭用户文件后所有用户会话失效
+	if err := loadUsers(""); err != nil {
+		t.Fatal(err)
+	}
+	if hasSession(sessions["alice"]) {
+		t.Error("user session still valid after the users file was disabled")
+	}
+}
+
+func TestUserCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+
+	withStdin(t, "first-pw\n", func() { runUserCommand([]string{"add", "-file", path, "-role", roleAdmin, "alice"}) })
+	withStdin(t, "bob-pw\n", func() { runUserCommand([]string{"add", "-file", path, "bob"}) })
+	withStdin(t, "carol-pw\n", func() { runUserCommand([]string{"add", "-file", path, "-role", roleReadOnly, "carol"}) })
+	withStdin(t, "second-pw\n", func() { runUserCommand([]string{"passwd", "-file", path, "alice"}) })
+	withStdin(t, "", func() { runUserCommand([]string{"remove", "-file", path, "carol"}) })
+
+	list, err := parseUsersFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list["alice"] == nil || list["bob"] == nil {
+		t.Fatalf("users = %v, want alice and bob", list)
+	}
+	if list["alice"].Role != roleAdmin || list["bob"].Role != roleReadWrite {
+		t.Errorf("roles = %s, %s, want %s, %s", list["alice"].Role, list["bob"].Role, roleAdmin, roleReadWrite)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(list["alice"].Hash), []byte("second-pw")) != nil {
+		t.Error("passwd did not change the password")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("users file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	out := withStdin(t, "", func() { runUserCommand([]string{"list", "-file", path}) })
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || strings.Fields(lines[0])[0] != "alice" || strings.Fields(lines[1])[1] != roleReadWrite {
+		t.Errorf("list output:\n%s", out)
+	}
+}
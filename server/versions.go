@@ -0,0 +1,473 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionRule 目录的版本保留规则：该目录下的文件被覆盖时保留旧版本。
+// keep_last 和 keep_for 都为 0 时保留所有版本；同时设置时两个条件都满足的版本才保留。
+type VersionRule struct {
+	Path     string   `json:"path"`      // 相对上传目录的目录，空字符串表示整个上传目录
+	KeepLast int      `json:"keep_last"` // 最多保留的版本数
+	KeepFor  Duration `json:"keep_for"`  // 版本保留时长，例如 "720h"
+}
+
+// FileVersion 文件的一个历史版本，保存在 <versions>/<路径的 SHA-256>/<id>，元数据在同目录的 <id>.json
+type FileVersion struct {
+	ID         string    `json:"id"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	Modified   time.Time `json:"modified"`    // 该版本最后一次写入的时间
+	ArchivedAt time.Time `json:"archived_at"` // 被新版本覆盖的时间
+	ArchivedBy string    `json:"archived_by"` // 覆盖它的身份
+}
+
+const (
+	versionsPathFile     = "path"      // 版本目录中记录文件相对路径的文件
+	legacyVersionsSuffix = ".versions" // 旧版本按路径镜像保存时版本目录的后缀
+)
+
+var (
+	versionsDir   = filepath.Join(dataDir, "versions")
+	versionsMutex sync.Mutex // 保护 versionRules 以及版本目录的增删
+	versionRules  []VersionRule
+)
+
+// validateVersionRules 检查规则并规范化目录路径
+func validateVersionRules(rules []VersionRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.KeepLast < 0 || rule.KeepFor.Duration < 0 {
+			return fmt.Errorf("versioning: keep_last and keep_for must not be negative")
+		}
+		rule.Path = strings.Trim(path.Clean("/"+filepath.ToSlash(rule.Path)), "/")
+	}
+	return nil
+}
+
+// applyVersioning 应用版本保留规则，可热加载
+func applyVersioning(rules []VersionRule) {
+	versionsMutex.Lock()
+	versionRules = rules
+	versionsMutex.Unlock()
+}
+
+// versionRule 返回作用于该文件的规则（目录最长匹配），没有规则时返回 nil
+func versionRule(rel string) *VersionRule {
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+
+	var best *VersionRule
+	for i := range versionRules {
+		rule := &versionRules[i]
+		if rule.Path != "" && !strings.HasPrefix(rel, rule.Path+"/") {
+			continue
+		}
+		if best == nil || len(rule.Path) > len(best.Path) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	copied := *best
+	return &copied
+}
+
+// versionDir 保存某个文件所有版本的目录。目录以相对路径的 SHA-256 命名，
+// 和用户的文件名、目录名都不会冲突
+func versionDir(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return filepath.Join(versionsDir, hex.EncodeToString(sum[:]))
+}
+
+// versionedPaths 返回所有保存了版本的文件的相对路径，调用方需持有 versionsMutex
+func versionedPaths() ([]string, error) {
+	entries, err := os.ReadDir(versionsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rels []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(versionsDir, entry.Name(), versionsPathFile))
+		if err != nil {
+			continue
+		}
+		rels = append(rels, string(data))
+	}
+	return rels, nil
+}
+
+// moveVersions 文件或目录移动后，把它们的历史版本移到新路径下；目标已有版本时合并
+func moveVersions(from, to string, isDir bool) error {
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+
+	if !isDir {
+		return moveVersionDir(from, to)
+	}
+	rels, err := versionedPaths()
+	if err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		if sub, ok := strings.CutPrefix(rel, from+"/"); ok {
+			if err := moveVersionDir(rel, path.Join(to, sub)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveVersionDir 把 from 的版本目录改到 to 名下，调用方需持有 versionsMutex
+func moveVersionDir(from, to string) error {
+	src, dst := versionDir(from), versionDir(to)
+	if _, err := os.Lstat(src); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := mergeInto(src, dst); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dst, versionsPathFile), []byte(to), 0600)
+}
+
+// mergeInto 把 src 目录移动到 dst；dst 已存在时逐项合并，版本 ID 唯一，同名文件只会来自同一个版本
+func mergeInto(src, dst string) error {
+	if _, err := os.Lstat(dst); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		return os.Rename(src, dst)
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		from, to := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		if entry.IsDir() {
+			err = mergeInto(from, to)
+		} else {
+			err = os.Rename(from, to)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(src)
+}
+
+// preserveExisting 上传或复制覆盖已有文件前保留旧文件：
+// 目录配置了版本保留时存为历史版本，否则启用回收站时移入回收站；目标不存在时什么也不做
+func preserveExisting(r *http.Request, fullPath string) error {
+	info, err := os.Lstat(fullPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+
+	if rule := versionRule(uploadRelPath(fullPath)); rule != nil {
+		version, err := archiveVersion(fullPath, info, identityFrom(r).Name)
+		if err != nil {
+			return err
+		}
+		logFrom(r).Info("Archived previous version", "path", version.Path, "version", version.ID)
+		pruneVersions(version.Path, *rule)
+		return nil
+	}
+
+	if !trashEnabled() {
+		return nil
+	}
+	entry, err := moveToTrash(fullPath, "overwrite", identityFrom(r).Name)
+	if err != nil {
+		return err
+	}
+	logFrom(r).Info("Moved overwritten file to trash", "path", entry.Path, "trash_id", entry.ID)
+	return nil
+}
+
+// archiveVersion 把当前文件移入版本目录
+func archiveVersion(fullPath string, info os.FileInfo, identity string) (*FileVersion, error) {
+	checksum, err := fileSHA256(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	version := &FileVersion{
+		ID:         time.Now().UTC().Format("20060102T150405") + "-" + randomString(6),
+		Path:       uploadRelPath(fullPath),
+		Size:       info.Size(),
+		SHA256:     checksum,
+		Modified:   info.ModTime().UTC(),
+		ArchivedAt: time.Now().UTC(),
+		ArchivedBy: identity,
+	}
+	dir := versionDir(version.Path)
+	meta := filepath.Join(dir, version.ID+".json")
+
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, versionsPathFile), []byte(version.Path), 0600); err != nil {
+		return nil, err
+	}
+	data, _ := json.MarshalIndent(version, "", "  ")
+	if err := os.WriteFile(meta, data, 0600); err != nil {
+		return nil, err
+	}
+	if err := moveAcross(fullPath, filepath.Join(dir, version.ID), info); err != nil {
+		os.Remove(meta)
+		return nil, err
+	}
+	return version, nil
+}
+
+func fileSHA256(fullPath string) (string, error) {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// listVersions 按覆盖时间倒序返回文件的历史版本
+func listVersions(rel string) ([]FileVersion, error) {
+	files, err := os.ReadDir(versionDir(rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []FileVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []FileVersion{}
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok {
+			continue
+		}
+		version, err := readVersion(rel, id)
+		if err != nil {
+			slog.Warn("Skipping invalid file version", "path", rel, "version", id, "error", err)
+			continue
+		}
+		versions = append(versions, *version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ArchivedAt.After(versions[j].ArchivedAt) })
+	return versions, nil
+}
+
+func readVersion(rel, id string) (*FileVersion, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return nil, fs.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(versionDir(rel), id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var version FileVersion
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+	version.ID, version.Path = id, rel
+	return &version, nil
+}
+
+// versionFile 返回某个版本内容的完整路径
+func versionFile(rel, id string) (string, error) {
+	if _, err := readVersion(rel, id); err != nil {
+		return "", err
+	}
+	return filepath.Join(versionDir(rel), id), nil
+}
+
+// pruneVersions 按规则删除多余和过期的版本
+func pruneVersions(rel string, rule VersionRule) {
+	versions, err := listVersions(rel)
+	if err != nil {
+		slog.Error("Failed to read file versions", "path", rel, "error", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-rule.KeepFor.Duration)
+	dir := versionDir(rel)
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+	for i, version := range versions {
+		if (rule.KeepLast == 0 || i < rule.KeepLast) && (rule.KeepFor.Duration == 0 || version.ArchivedAt.After(cutoff)) {
+			continue
+		}
+		os.Remove(filepath.Join(dir, version.ID))
+		if err := os.Remove(filepath.Join(dir, version.ID+".json")); err != nil {
+			slog.Error("Failed to prune file version", "path", rel, "version", version.ID, "error", err)
+			continue
+		}
+		slog.Info("Pruned file version", "path", rel, "version", version.ID, "archived_at", version.ArchivedAt)
+	}
+	os.Remove(dir) // 只在目录为空时成功
+}
+
+// pruneAllVersions 按当前规则清理所有文件的版本；不再匹配任何规则的版本保持不变
+func pruneAllVersions() {
+	versionsMutex.Lock()
+	rels, err := versionedPaths()
+	versionsMutex.Unlock()
+	if err != nil {
+		slog.Error("Failed to scan file versions", "error", err)
+		return
+	}
+	for _, rel := range rels {
+		if rule := versionRule(rel); rule != nil {
+			pruneVersions(rel, *rule)
+		}
+	}
+}
+
+// migrateLegacyVersions 把旧版本按路径镜像保存的版本（<versions>/<路径>.versions/）
+// 迁移到以路径哈希命名的目录，然后删除留下的空目录
+func migrateLegacyVersions() error {
+	var legacy []string
+	err := filepath.WalkDir(versionsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != versionsDir && strings.HasSuffix(d.Name(), legacyVersionsSuffix) {
+			legacy = append(legacy, p)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+	for _, dir := range legacy {
+		rel, err := filepath.Rel(versionsDir, strings.TrimSuffix(dir, legacyVersionsSuffix))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		// 旧布局中 a.versions/ 下还可能有 a.versions/x 的版本目录，这里只迁移文件
+		dst := versionDir(rel)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if err := os.MkdirAll(dst, 0700); err != nil {
+				return err
+			}
+			if err := os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		if len(entries) > 0 {
+			if err := os.WriteFile(filepath.Join(dst, versionsPathFile), []byte(rel), 0600); err != nil {
+				return err
+			}
+		}
+		slog.Info("Migrated file versions", "path", rel)
+	}
+
+	// 从最深的目录开始删除空目录（非空目录删除失败，忽略）
+	sort.Slice(legacy, func(i, j int) bool { return len(legacy[i]) > len(legacy[j]) })
+	for _, dir := range legacy {
+		for ; dir != versionsDir && strings.HasPrefix(dir, versionsDir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// startVersionPruner 启动时和之后每小时按 keep_for 清理过期版本
+func startVersionPruner() {
+	go func() {
+		for {
+			pruneAllVersions()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// handleVersions 列出文件的历史版本
+//
+//	GET /versions/<path>
+func handleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rel := strings.TrimPrefix(r.URL.Path, "/versions/")
+	if rel == "" {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+	setRequestFile(r, rel, 0)
+
+	fullPath, ok := safeUploadPath(rel)
+	if !ok {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+	rel = uploadRelPath(fullPath)
+
+	versions, err := listVersions(rel)
+	if err != nil {
+		writeFileOpError(w, r, err)
+		return
+	}
+
+	var current map[string]interface{}
+	if info, err := os.Stat(fullPath); err == nil && !info.IsDir() {
+		current = map[string]interface{}{"size": info.Size(), "modified": info.ModTime()}
+	} else if len(versions) == 0 {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":       rel,
+		"versioning": versionRule(rel) != nil,
+		"current":    current,
+		"versions":   versions,
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeVersions 写入文件并覆盖 n 次，每次覆盖都保存一个历史版本
+func writeVersions(t *testing.T, rel string, n int) {
+	t.Helper()
+	fullPath := filepath.Join(uploadDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	for i := 0; i <= n; i++ {
+		if err := preserveExisting(req, fullPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(strings.Repeat("v", i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countVersions(t *testing.T, rel string) int {
+	t.Helper()
+	versions, err := listVersions(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(versions)
+}
+
+func TestMoveKeepsVersions(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	applyVersioning([]VersionRule{{KeepLast: 10}})
+	t.Cleanup(func() { applyVersioning(nil) })
+
+	writeVersions(t, "a.txt", 2)
+	writeVersions(t, "builds/app.bin", 2)
+	writeVersions(t, "builds/sub/lib.so", 1)
+	writeVersions(t, "target.txt", 1)
+	writeVersions(t, "merge.txt", 3)
+
+	tests := []struct {
+		name string
+		body string
+		// 移动后各路径应有的版本数
+		want map[string]int
+	}{
+		{"rename file", `{"from": "a.txt", "to": "renamed/a.txt"}`, map[string]int{"a.txt": 0, "renamed/a.txt": 2}},
+		{"move directory", `{"from": "builds", "to": "archive/builds"}`, map[string]int{
+			"builds/app.bin": 0, "builds/sub/lib.so": 0, "archive/builds/app.bin": 2, "archive/builds/sub/lib.so": 1,
+		}},
+		// 覆盖时目标的旧内容也成为一个版本，和源文件的版本合并
+		{"overwrite merges versions", `{"from": "merge.txt", "to": "target.txt", "overwrite": true}`, map[string]int{"merge.txt": 0, "target.txt": 1 + 1 + 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleMove(rec, httptest.NewRequest(http.MethodPost, "/api/move", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			for rel, want := range tt.want {
+				if got := countVersions(t, rel); got != want {
+					t.Errorf("%s has %d versions, want %d", rel, got, want)
+				}
+			}
+		})
+	}
+
+	// 移动后的版本仍然可以下载
+	versions, err := listVersions("renamed/a.txt")
+	if err != nil || len(versions) == 0 {
+		t.Fatalf("listVersions: %v, %v", versions, err)
+	}
+	rec := httptest.NewRecorder()
+	handleDownload(rec, httptest.NewRequest(http.MethodGet, "/download/renamed/a.txt?version="+versions[len(versions)-1].ID, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "v" {
+		t.Errorf("download oldest version: status %d, body %q", rec.Code, rec.Body)
+	}
+}
+
+func TestVersionsNamesDoNotCollide(t *testing.T) {
+	chdirTemp(t)
+	openTestMetadata(t)
+	applyVersioning([]VersionRule{{KeepLast: 10}})
+	t.Cleanup(func() { applyVersioning(nil) })
+
+	// 旧布局中 a.txt 的版本目录是 a.txt.versions/，会和同名的用户目录重叠
+	writeVersions(t, "a.txt", 2)
+	writeVersions(t, "a.txt.versions/x", 1)
+	for rel, want := range map[string]int{"a.txt": 2, "a.txt.versions/x": 1} {
+		if got := countVersions(t, rel); got != want {
+			t.Errorf("%s has %d versions, want %d", rel, got, want)
+		}
+	}
+
+	// 名称以 .versions 结尾的文件可以正常上传、下载、列出、移动和删除
+	id := &Identity{Name: "test", Role: roleReadWrite}
+	if _, err := resolveUploadPath(id, "a.txt.versions/y"); err != nil {
+		t.Errorf("resolveUploadPath: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handleDownload(rec, httptest.NewRequest(http.MethodGet, "/download/a.txt.versions/x", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "vv" {
+		t.Errorf("download: status %d, body %q", rec.Code, rec.Body)
+	}
+	if paths, _ := listPage(t, url.Values{"path": {"a.txt.versions"}}); strings.Join(paths, ",") != "a.txt.versions/x" {
+		t.Errorf("listing = %v", paths)
+	}
+	for _, op := range []struct {
+		endpoint string
+		handler  http.HandlerFunc
+		body     string
+	}{
+		{"/api/move", handleMove, `{"from": "a.txt.versions", "to": "b.versions"}`},
+		{"/api/delete", handleDelete, `{"path": "b.versions", "recursive": true}`},
+	} {
+		rec := httptest.NewRecorder()
+		op.handler(rec, httptest.NewRequest(http.MethodPost, op.endpoint, strings.NewReader(op.body)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s: status %d: %s", op.endpoint, op.body, rec.Code, rec.Body)
+		}
+	}
+	if got := countVersions(t, "b.versions/x"); got != 1 {
+		t.Errorf("b.versions/x has %d versions after the move, want 1", got)
+	}
+	if got := countVersions(t, "a.txt"); got != 2 {
+		t.Errorf("a.txt has %d versions after moving a.txt.versions, want 2", got)
+	}
+}
+
+func TestMigrateLegacyVersions(t *testing.T) {
+	chdirTemp(t)
+	legacy := map[string]string{
+		"a.txt.versions/20240101T000000-aaaaaa":                 "old a",
+		"a.txt.versions/20240101T000000-aaaaaa.json":            `{"archived_at": "2024-01-01T00:00:00Z"}`,
+		"a.txt.versions/x.versions/20240102T000000-bbbbbb":      "old x",
+		"a.txt.versions/x.versions/20240102T000000-bbbbbb.json": `{"archived_at": "2024-01-02T00:00:00Z"}`,
+		"dir/b.bin.versions/20240103T000000-cccccc":             "old b",
+		"dir/b.bin.versions/20240103T000000-cccccc.json":        `{"archived_at": "2024-01-03T00:00:00Z"}`,
+	}
+	for rel, content := range legacy {
+		fullPath := filepath.Join(versionsDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 迁移可以重复执行
+	for i := 0; i < 2; i++ {
+		if err := migrateLegacyVersions(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for rel, id := range map[string]string{"a.txt": "20240101T000000-aaaaaa", "a.txt.versions/x": "20240102T000000-bbbbbb", "dir/b.bin": "20240103T000000-cccccc"} {
+		versions, err := listVersions(rel)
+		if err != nil || len(versions) != 1 || versions[0].ID != id {
+			t.Errorf("%s versions = %+v, %v, want %s", rel, versions, err, id)
+		}
+	}
+	for _, dir := range []string{"a.txt.versions", "dir"} {
+		if _, err := os.Stat(filepath.Join(versionsDir, dir)); !os.IsNotExist(err) {
+			t.Errorf("legacy directory %s left behind: %v", dir, err)
+		}
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // handleWebUpload 提供网页上传界面
@@ -18,7 +21,11 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	needsAuth := serviceKey != ""
+	needsAuth := authEnabled()
+	ssoButtonText := ""
+	if oidcEnabled() {
+		ssoButtonText = oidcConfig.ButtonText
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	fmt.Fprintf(w, `<!DOCTYPE html>
@@ -116,6 +123,16 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             transform: translateY(0);
         }
         
+        .sso-btn {
+            display: none;
+            margin-top: 0.75rem;
+            background: white;
+            color: #667eea;
+            border: 2px solid #667eea;
+            text-align: center;
+            text-decoration: none;
+        }
+        
         .login-error {
             color: #dc3545;
             margin-top: 1rem;
@@ -273,6 +290,133 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             font-size: 0.9rem;
         }
         
+        .file-tag {
+            display: inline-block;
+            margin-left: 0.4rem;
+            padding: 0 0.4rem;
+            border-radius: 3px;
+            background: #e8f0fe;
+            color: #1a56b0;
+            font-size: 0.8rem;
+            cursor: pointer;
+        }
+        
+        .file-download {
+            color: #666;
+            text-decoration: none;
+        }
+        
+        .file-download:hover {
+            color: #1a56b0;
+        }
+        
+        .file-desc {
+            margin-left: 0.5rem;
+            color: #888;
+            font-size: 0.85rem;
+        }
+        
+        .file-toolbar {
+            display: none;
+            gap: 0.5rem;
+            align-items: center;
+            margin-bottom: 0.75rem;
+            flex-wrap: wrap;
+        }
+        
+        .file-toolbar .selection-count {
+            color: #666;
+            font-size: 0.9rem;
+            margin-left: auto;
+        }
+        
+        .file-btn {
+            padding: 0.25rem 0.6rem;
+            border: 1px solid #ddd;
+            background: white;
+            border-radius: 4px;
+            cursor: pointer;
+            font-size: 0.8rem;
+            color: #555;
+        }
+        
+        .file-btn:hover {
+            border-color: #667eea;
+            color: #667eea;
+        }
+        
+        .file-btn.danger:hover {
+            border-color: #dc3545;
+            color: #dc3545;
+        }
+        
+        .file-btn:disabled {
+            opacity: 0.5;
+            cursor: default;
+        }
+        
+        .file-main {
+            display: flex;
+            align-items: center;
+            gap: 0.5rem;
+            min-width: 0;
+        }
+        
+        .file-meta {
+            display: flex;
+            align-items: center;
+            gap: 0.5rem;
+            flex-shrink: 0;
+        }
+        
+        .file-actions {
+            display: none;
+            gap: 0.25rem;
+        }
+        
+        .file-item:hover .file-actions {
+            display: flex;
+        }
+        
+        .file-item.drop-target {
+            background-color: #f8f9ff;
+            outline: 2px dashed #667eea;
+        }
+        
+        .trash-list {
+            display: none;
+        }
+        
+        .trash-info {
+            color: #999;
+            font-size: 0.8rem;
+        }
+        
+        .dir-toggle {
+            cursor: pointer;
+            user-select: none;
+        }
+        
+        .file-item.root-item {
+            color: #999;
+            font-size: 0.9rem;
+        }
+        
+        .file-search {
+            width: 100%%;
+            box-sizing: border-box;
+            padding: 0.4rem 0.6rem;
+            margin-bottom: 0.75rem;
+            border: 1px solid #ddd;
+            border-radius: 4px;
+            font-size: 0.9rem;
+        }
+        
+        .file-search:focus {
+            outline: none;
+            border-color: #667eea;
+        }
+        
         .upload-options {
             display: flex;
             gap: 0.5rem;
@@ -297,7 +441,7 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
         
         .upload-option-btn.active {
             border-color: #667eea;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
             color: white;
         }
     </style>
@@ -312,8 +456,10 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
         <!-- 登录界面 -->
         <div id="loginSection" class="login-section">
             <h2 class="login-title">🔐 请输入服务密钥</h2>
+            <input type="text" id="loginUser" class="login-input" placeholder="用户名（使用服务密钥时留空）" autocomplete="username" style="display: none;">
             <input type="password" id="loginKey" class="login-input" placeholder="输入密钥..." autocomplete="off">
             <button id="loginBtn" class="login-btn">登录</button>
+            <a id="ssoBtn" class="login-btn sso-btn" href="/oidc/login"></a>
             <div id="loginError" class="login-error">密钥错误，请重试</div>
         </div>
         
@@ -345,19 +491,40 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             
             <div class="file-list" id="fileList">
                 <h3>服务器文件</h3>
+                <input type="search" class="file-search" id="searchInput" placeholder="🔍 搜索文件名，支持 *.tar.gz 这样的通配符，tag:build=1234 按标签搜索">
+                <div class="file-toolbar" id="fileToolbar">
+                    <button class="file-btn" id="newFolderBtn">📁 新建目录</button>
+                    <button class="file-btn" id="bulkMoveBtn" disabled>移动所选</button>
+                    <button class="file-btn danger" id="bulkDeleteBtn" disabled>删除所选</button>
+                    <button class="file-btn" id="trashBtn">🗑️ 回收站</button>
+                    <span class="selection-count" id="selectionCount"></span>
+                </div>
                 <div id="files">加载中...</div>
             </div>
+            
+            <div class="file-list trash-list" id="trashList">
+                <h3>回收站</h3>
+                <div class="file-toolbar" style="display: flex;">
+                    <button class="file-btn danger" id="emptyTrashBtn">清空回收站</button>
+                    <span class="selection-count">超过保留期的条目会被自动清除</span>
+                </div>
+                <div id="trashItems">加载中...</div>
+            </div>
         </div>
     </div>
 
     <script>
         const needsAuth = %t;
-        let currentServiceKey = '';
+        const hasUsers = %t;
+        const ssoButtonText = %q;
+        let csrfToken = '';
+        let canManage = false; // 读写和管理员角色可以删除、重命名、移动文件
         
         // DOM 元素
         const loginSection = document.getElementById('loginSection');
         const mainSection = document.getElementById('mainSection');
         const loginKeyInput = document.getElementById('loginKey');
+        const loginUserInput = document.getElementById('loginUser');
         const loginBtn = document.getElementById('loginBtn');
         const loginError = document.getElementById('loginError');
         const logoutBtn = document.getElementById('logoutBtn');
@@ -370,37 +537,54 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
         const progressFill = document.getElementById('progressFill');
         const progressText = document.getElementById('progressText');
         const result = document.getElementById('result');
+        const filesContainer = document.getElementById('files');
+        const fileToolbar = document.getElementById('fileToolbar');
+        const newFolderBtn = document.getElementById('newFolderBtn');
+        const bulkMoveBtn = document.getElementById('bulkMoveBtn');
+        const bulkDeleteBtn = document.getElementById('bulkDeleteBtn');
+        const selectionCount = document.getElementById('selectionCount');
+        const trashBtn = document.getElementById('trashBtn');
+        const trashList = document.getElementById('trashList');
+        const trashItems = document.getElementById('trashItems');
+        const emptyTrashBtn = document.getElementById('emptyTrashBtn');
+        const searchInput = document.getElementById('searchInput');
         
         let currentUploadMode = 'file'; // 'file' or 'folder'
         
-        // Cookie 操作函数
-        function setCookie(name, value, days) {
-            const expires = new Date();
-            expires.setTime(expires.getTime() + (days * 24 * 60 * 60 * 1000));
-            document.cookie = name + '=' + value + ';expires=' + expires.toUTCString() + ';path=/';
-        }
+        // 脚本发起的请求带上 X-Requested-With，避免浏览器弹出 Basic 认证框
+        const ajaxHeaders = {'X-Requested-With': 'ctrans-web'};
         
-        function getCookie(name) {
-            const nameEQ = name + '=';
-            const ca = document.cookie.split(';');
-            for (let i = 0; i < ca.length; i++) {
-                let c = ca[i];
-                while (c.charAt(0) === ' ') c = c.substring(1, c.length);
-                if (c.indexOf(nameEQ) === 0) return c.substring(nameEQ.length, c.length);
+        // 使用密钥或用户名密码登录，服务器返回 HttpOnly 会话 Cookie 和 CSRF 令牌
+        async function login(username, secret) {
+            const body = username ? {username: username, password: secret} : {key: secret};
+            try {
+                const response = await fetch('/login', {
+                    method: 'POST',
+                    headers: Object.assign({'Content-Type': 'application/json'}, ajaxHeaders),
+                    body: JSON.stringify(body)
+                });
+                if (!response.ok) {
+                    return false;
+                }
+                const data = await response.json();
+                csrfToken = data.csrf_token;
+                canManage = data.role === 'admin' || data.role === 'readwrite';
+                return true;
+            } catch (error) {
+                return false;
             }
-            return null;
         }
         
-        function deleteCookie(name) {
-            document.cookie = name + '=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;';
-        }
-        
-        // 验证密钥
-        async function validateKey(key) {
+        // 查询当前会话
+        async function checkSession() {
             try {
-                const headers = needsAuth ? {'X-Service-Key': key} : {};
-                const response = await fetch('/files', { headers });
-                return response.ok;
+                const response = await fetch('/session', { headers: ajaxHeaders });
+                const data = await response.json();
+                if (data.authenticated) {
+                    csrfToken = data.csrf_token;
+                    canManage = data.role === 'admin' || data.role === 'readwrite';
+                }
+                return data.authenticated;
             } catch (error) {
                 return false;
             }
@@ -410,6 +594,7 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
         function showMainInterface() {
             loginSection.style.display = 'none';
             mainSection.style.display = 'block';
+            fileToolbar.style.display = canManage ? 'flex' : 'none';
             loadFiles();
         }
         
@@ -419,7 +604,11 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             mainSection.style.display = 'none';
             loginError.style.display = 'none';
             loginKeyInput.value = '';
-            currentServiceKey = '';
+            csrfToken = '';
+            canManage = false;
+            trashList.style.display = 'none';
+            searchInput.value = '';
+            searchResults = null;
         }
         
         // 登录处理
@@ -434,11 +623,10 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             loginBtn.textContent = '验证中...';
             loginBtn.disabled = true;
             
-            const isValid = await validateKey(key);
+            const isValid = await login(loginUserInput.value.trim(), key);
+            loginKeyInput.value = '';
             
             if (isValid) {
-                currentServiceKey = key;
-                setCookie('service_key', key, 7); // 保存7天
                 showMainInterface();
             } else {
                 loginError.textContent = '密钥错误，请重试';
@@ -449,28 +637,40 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             loginBtn.disabled = false;
         }
         
-        // 登出处理
-        function handleLogout() {
-            deleteCookie('service_key');
-            showLoginInterface();
+        // 登出处理（服务器端销毁会话）
+        async function handleLogout() {
+            try {
+                await fetch('/logout', {
+                    method: 'POST',
+                    headers: Object.assign({'X-CSRF-Token': csrfToken}, ajaxHeaders)
+                });
+            } finally {
+                showLoginInterface();
+            }
         }
         
         // 初始化
         async function init() {
+            if (ssoButtonText) {
+                const ssoBtn = document.getElementById('ssoBtn');
+                ssoBtn.textContent = ssoButtonText;
+                ssoBtn.style.display = 'block';
+            }
+            
+            if (hasUsers) {
+                loginUserInput.style.display = 'block';
+                loginKeyInput.placeholder = '输入密钥或密码...';
+            }
+            
             if (!needsAuth) {
+                canManage = true;
                 showMainInterface();
                 return;
             }
             
-            const savedKey = getCookie('service_key');
-            if (savedKey) {
-                const isValid = await validateKey(savedKey);
-                if (isValid) {
-                    currentServiceKey = savedKey;
-                    showMainInterface();
-                    return;
-                }
-                deleteCookie('service_key');
+            if (await checkSession()) {
+                showMainInterface();
+                return;
             }
             
             showLoginInterface();
@@ -632,6 +832,8 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
                 const formData = new FormData();
                 formData.append('file', file);
                 
+                formData.append('lastModified', file.lastModified);
+                
                 // 如果有相对路径信息，发送给服务器
                 if (file.webkitRelativePath) {
                     formData.append('relativePath', file.webkitRelativePath);
@@ -660,10 +862,11 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
                 });
                 
                 xhr.open('POST', '/web-upload');
+                xhr.setRequestHeader('X-Requested-With', 'ctrans-web');
                 
-                // 添加认证头（必须在open之后）
-                if (needsAuth && currentServiceKey) {
-                    xhr.setRequestHeader('X-Service-Key', currentServiceKey);
+                // 添加 CSRF 令牌（必须在open之后）
+                if (csrfToken) {
+                    xhr.setRequestHeader('X-CSRF-Token', csrfToken);
                 }
                 
                 xhr.send(formData);
@@ -677,67 +880,624 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
             result.style.display = 'block';
         }
         
-        // 加载文件列表
+        // 目录树：根目录和展开的目录按需分页加载，不再一次取回整个上传目录
+        const pageSize = 200;
+        const expandedDirs = new Set();
+        let dirListings = {}; // 目录路径 -> {entries, cursor}
+        
+        // 获取一页目录内容
+        async function fetchDir(dir, cursor) {
+            let url = '/files?dirs_first=1&limit=' + pageSize + '&path=' + encodeURIComponent(dir);
+            if (cursor) {
+                url += '&cursor=' + encodeURIComponent(cursor);
+            }
+            const response = await fetch(url, { headers: ajaxHeaders });
+            if (response.status === 401) {
+                showLoginInterface();
+                throw new Error('登录已过期');
+            }
+            if (!response.ok) {
+                const error = new Error((await response.text()).trim() || '无法获取文件列表');
+                error.status = response.status;
+                throw error;
+            }
+            const data = await response.json();
+            return {entries: data.entries, cursor: data.next_cursor || ''};
+        }
+        
+        // 加载文件列表：重新加载根目录和所有展开的目录，已不存在的目录自动收起
         async function loadFiles() {
+            if (searchResults) {
+                runSearch();
+            }
             try {
-                const headers = {};
-                if (needsAuth && currentServiceKey) {
-                    headers['X-Service-Key'] = currentServiceKey;
+                const dirs = [''].concat(Array.from(expandedDirs));
+                const results = await Promise.all(dirs.map((dir) => fetchDir(dir, '').catch((error) => {
+                    if (dir !== '' && (error.status === 404 || error.status === 400)) {
+                        expandedDirs.delete(dir);
+                        return null;
+                    }
+                    throw error;
+                })));
+                dirListings = {};
+                dirs.forEach((dir, i) => {
+                    if (results[i]) {
+                        dirListings[dir] = results[i];
+                    }
+                });
+                displayFiles();
+            } catch (error) {
+                filesContainer.textContent = '无法加载文件列表';
+            }
+        }
+        
+        // 展开或收起目录
+        async function toggleDir(dir) {
+            if (expandedDirs.has(dir)) {
+                for (const path of Array.from(expandedDirs)) {
+                    if (path === dir || path.startsWith(dir + '/')) {
+                        expandedDirs.delete(path);
+                    }
+                }
+                displayFiles();
+                return;
+            }
+            try {
+                dirListings[dir] = await fetchDir(dir, '');
+                expandedDirs.add(dir);
+                displayFiles();
+            } catch (error) {
+                showResult('error', '无法打开目录：' + error.message);
+            }
+        }
+        
+        // 加载目录的下一页
+        async function loadMore(dir) {
+            const listing = dirListings[dir];
+            try {
+                const page = await fetchDir(dir, listing.cursor);
+                listing.entries = listing.entries.concat(page.entries);
+                listing.cursor = page.cursor;
+                displayFiles();
+            } catch (error) {
+                showResult('error', '加载失败：' + error.message);
+            }
+        }
+        
+        // 搜索框有内容时显示搜索结果 {entries, truncated}，为 null 时显示目录树
+        let searchResults = null;
+        let searchTimer = null;
+        
+        // 按名称搜索整个上传目录；包含通配符时按 glob 匹配，否则按子串匹配（不区分大小写）
+        async function runSearch() {
+            const text = searchInput.value.trim();
+            if (!text) {
+                searchResults = null;
+                displayFiles();
+                return;
+            }
+            let param = /[*?[]/.test(text) ? 'glob' : 'q';
+            let value = text;
+            if (text.startsWith('tag:')) {
+                param = 'tag';
+                value = text.substring(4);
+            }
+            try {
+                const response = await fetch('/search?limit=' + pageSize + '&' + param + '=' + encodeURIComponent(value), { headers: ajaxHeaders });
+                if (response.status === 401) {
+                    showLoginInterface();
+                    return;
                 }
-                
-                const response = await fetch('/files', { headers });
                 if (!response.ok) {
-                    throw new Error('无法获取文件列表');
+                    throw new Error((await response.text()).trim() || '搜索失败');
                 }
-                
-                const files = await response.json();
-                displayFiles(files);
+                const data = await response.json();
+                if (searchInput.value.trim() !== text) {
+                    return; // 输入已经变了，以后一次搜索为准
+                }
+                searchResults = {entries: data.entries, truncated: data.truncated};
+                displayFiles();
             } catch (error) {
-                document.getElementById('files').textContent = '无法加载文件列表';
+                showResult('error', '搜索失败：' + error.message);
             }
         }
         
+        // 在目录树中展开某个目录（从搜索结果点击目录时）
+        function revealDir(dir) {
+            searchInput.value = '';
+            searchResults = null;
+            const parts = dir.split('/');
+            for (let i = 1; i <= parts.length; i++) {
+                expandedDirs.add(parts.slice(0, i).join('/'));
+            }
+            loadFiles();
+        }
+        
+        // 当前列表中的文件（按路径索引）和已勾选的路径
+        let currentFiles = {};
+        const selectedPaths = new Set();
+        
+        // 转义插入 HTML 的文件名和路径
+        function escapeHtml(text) {
+            return String(text).replace(/[&<>"']/g, (c) => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'})[c]);
+        }
+        
         // 显示文件列表
-        function displayFiles(files) {
-            const filesContainer = document.getElementById('files');
+        function displayFiles() {
+            currentFiles = {};
+            if (searchResults) {
+                displaySearchResults();
+                return;
+            }
+            const root = dirListings[''];
             
-            if (!files || files.length === 0) {
+            if (!root || root.entries.length === 0) {
+                selectedPaths.clear();
+                updateSelection();
                 filesContainer.textContent = '暂无文件';
                 return;
             }
             
-            // 排序：目录在前，文件在后，按路径排序
-            files.sort((a, b) => {
-                if (a.is_dir !== b.is_dir) {
-                    return a.is_dir ? -1 : 1;
+            let html = '';
+            // 拖到这一行表示移动到上传目录根目录
+            if (canManage) {
+                html += '<div class="file-item root-item" data-path="" data-dir="1">⬆️ 拖放到此处移动到根目录</div>';
+            }
+            html += renderDir('', 0);
+            filesContainer.innerHTML = html;
+            pruneSelection();
+        }
+        
+        // 显示搜索结果：平铺显示完整路径
+        function displaySearchResults() {
+            let html = '';
+            for (const file of searchResults.entries) {
+                currentFiles[file.path] = file;
+                html += renderEntry(file, 0, file.path, false);
+            }
+            if (searchResults.truncated) {
+                html += '<div class="file-item file-size">只显示前 ' + searchResults.entries.length + ' 个结果，请输入更精确的名称</div>';
+            }
+            if (html) {
+                filesContainer.innerHTML = html;
+            } else {
+                filesContainer.textContent = '没有匹配的文件';
+            }
+            pruneSelection();
+        }
+        
+        // 丢弃已不在列表中的勾选项
+        function pruneSelection() {
+            for (const path of Array.from(selectedPaths)) {
+                if (!currentFiles[path]) {
+                    selectedPaths.delete(path);
+                }
+            }
+            updateSelection();
+        }
+        
+        // 渲染列表中的一项，label 为显示的名称
+        function renderEntry(file, depth, label, expanded) {
+            const path = escapeHtml(file.path);
+            let html = '<div class="file-item" style="padding-left: ' + (depth * 20) + 'px;" data-path="' + path + '"' +
+                (file.is_dir ? ' data-dir="1"' : '') + (canManage ? ' draggable="true"' : '') + '>';
+            html += '<span class="file-main">';
+            if (canManage) {
+                html += '<input type="checkbox" class="file-select"' + (selectedPaths.has(file.path) ? ' checked' : '') + '>';
+            }
+            if (file.is_dir) {
+                html += '<span class="file-name dir-toggle">' + (expanded ? '▾ 📂 ' : '▸ 📁 ') + escapeHtml(label) + '/</span>';
+            } else {
+                // 点击名称在新标签页中打开（日志、图片、PDF、视频等直接显示，其他类型由服务器作为附件下载）
+                html += '<a href="/download/' + encodeURIComponent(file.path) + '?inline=1" class="file-name" target="_blank">';
+                html += '📄 ' + escapeHtml(label);
+                html += '</a>';
+                for (const tag of formatTags(file.tags)) {
+                    html += '<span class="file-tag" data-tag="' + escapeHtml(tag) + '" title="搜索带有此标签的文件">' + escapeHtml(tag) + '</span>';
+                }
+                if (file.description) {
+                    html += '<span class="file-desc">' + escapeHtml(file.description) + '</span>';
                 }
-                return a.path.localeCompare(b.path);
+            }
+            html += '</span><span class="file-meta">';
+            if (canManage) {
+                html += '<span class="file-actions">';
+                if (!file.is_dir) {
+                    html += '<button class="file-btn" data-action="tags">标签</button>';
+                }
+                html += '<button class="file-btn" data-action="rename">重命名</button>';
+                html += '<button class="file-btn" data-action="move">移动</button>';
+                html += '<button class="file-btn danger" data-action="delete">删除</button>';
+                html += '</span>';
+            }
+            if (!file.is_dir) {
+                html += '<a href="/download/' + encodeURIComponent(file.path) + '" class="file-download" title="下载">⬇</a>';
+            }
+            html += '<span class="file-size">' + (file.is_dir ? '目录' : formatFileSize(file.size)) + '</span>';
+            html += '</span></div>';
+            return html;
+        }
+        
+        // 标签按名称排序，显示为 key=value
+        function formatTags(tags) {
+            return Object.keys(tags || {}).sort().map(key => key + '=' + tags[key]);
+        }
+        
+        // 渲染一个目录的内容，展开的子目录递归渲染
+        function renderDir(dir, depth) {
+            const listing = dirListings[dir];
+            let html = '';
+            for (const file of listing.entries) {
+                currentFiles[file.path] = file;
+                const expanded = file.is_dir && expandedDirs.has(file.path) && dirListings[file.path];
+                html += renderEntry(file, depth, file.name, expanded);
+                if (expanded) {
+                    html += renderDir(file.path, depth + 1);
+                }
+            }
+            if (listing.cursor) {
+                html += '<div class="file-item" style="padding-left: ' + (depth * 20) + 'px;" data-more="' + escapeHtml(dir) + '">';
+                html += '<button class="file-btn" data-action="more">加载更多…</button></div>';
+            }
+            return html;
+        }
+        
+        // 更新批量操作按钮状态
+        function updateSelection() {
+            bulkMoveBtn.disabled = selectedPaths.size === 0;
+            bulkDeleteBtn.disabled = selectedPaths.size === 0;
+            selectionCount.textContent = selectedPaths.size > 0 ? '已选择 ' + selectedPaths.size + ' 项' : '';
+        }
+        
+        // 调用文件管理接口，失败时抛出服务器返回的错误信息
+        async function fileOp(endpoint, body) {
+            const response = await fetch(endpoint, {
+                method: 'POST',
+                headers: Object.assign({'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken}, ajaxHeaders),
+                body: JSON.stringify(body)
             });
-            
+            if (response.status === 401) {
+                showLoginInterface();
+                throw new Error('登录已过期');
+            }
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || response.statusText);
+            }
+            return response.json();
+        }
+        
+        function baseName(path) {
+            return path.substring(path.lastIndexOf('/') + 1);
+        }
+        
+        function parentDir(path) {
+            const i = path.lastIndexOf('/');
+            return i < 0 ? '' : path.substring(0, i);
+        }
+        
+        // 去掉已被勾选的上级目录包含的路径，避免重复操作
+        function topLevelPaths(paths) {
+            return paths.filter((p) => !paths.some((q) => q !== p && currentFiles[q] && currentFiles[q].is_dir && p.startsWith(q + '/')));
+        }
+        
+        // 依次执行批量操作，全部完成后刷新列表并汇总结果
+        async function runBatch(paths, verb, op) {
+            const failures = [];
+            for (const path of paths) {
+                try {
+                    await op(path);
+                    selectedPaths.delete(path);
+                } catch (error) {
+                    failures.push(path + ': ' + error.message);
+                }
+            }
+            await loadFiles();
+            refreshTrash();
+            if (failures.length === 0) {
+                showResult('success', verb + '成功：共 ' + paths.length + ' 项');
+            } else {
+                showResult('error', verb + '失败 ' + failures.length + ' 项：' + failures.join('；'));
+            }
+        }
+        
+        // 删除文件或目录（目录连同内容一起删除）
+        function deletePaths(paths) {
+            paths = topLevelPaths(paths);
+            const dirs = paths.filter((p) => currentFiles[p] && currentFiles[p].is_dir).length;
+            let message = paths.length === 1 ? '确定删除 "' + paths[0] + '" 吗？' : '确定删除选中的 ' + paths.length + ' 项吗？';
+            if (dirs > 0) {
+                message += '\n目录中的所有内容也会被删除。';
+            }
+            if (!confirm(message)) {
+                return;
+            }
+            runBatch(paths, '删除', (path) => fileOp('/api/delete', {path: path, recursive: true}));
+        }
+        
+        // 移动到目标目录，保留原名称；空字符串表示根目录
+        function movePaths(paths, targetDir) {
+            paths = topLevelPaths(paths).filter((p) => parentDir(p) !== targetDir && p !== targetDir);
+            if (paths.length === 0) {
+                return;
+            }
+            const target = targetDir || '根目录';
+            const message = paths.length === 1 ? '确定将 "' + paths[0] + '" 移动到 ' + target + ' 吗？' : '确定将选中的 ' + paths.length + ' 项移动到 ' + target + ' 吗？';
+            if (!confirm(message)) {
+                return;
+            }
+            runBatch(paths, '移动', (path) => fileOp('/api/move', {from: path, to: (targetDir ? targetDir + '/' : '') + baseName(path)}));
+        }
+        
+        function promptMove(paths) {
+            const target = prompt('移动到目录（相对上传目录，留空表示根目录）：', '');
+            if (target !== null) {
+                movePaths(paths, target.trim().replace(/^\/+|\/+$/g, ''));
+            }
+        }
+        
+        async function renamePath(path) {
+            const name = prompt('新名称：', baseName(path));
+            if (name === null || name.trim() === '' || name.trim() === baseName(path)) {
+                return;
+            }
+            if (name.includes('/') || name.includes('\\')) {
+                showResult('error', '名称不能包含路径分隔符');
+                return;
+            }
+            const parent = parentDir(path);
+            const to = (parent ? parent + '/' : '') + name.trim();
+            try {
+                await fileOp('/api/move', {from: path, to: to});
+                selectedPaths.delete(path);
+                showResult('success', '已重命名为 ' + to);
+            } catch (error) {
+                showResult('error', '重命名失败：' + error.message);
+            }
+            loadFiles();
+        }
+        
+        // 编辑文件的标签和描述：输入框中的标签替换文件的全部标签
+        async function editTags(path) {
+            const file = currentFiles[path] || {};
+            const input = prompt('标签（key=value，多个用空格分隔，留空清除所有标签）：', formatTags(file.tags).join(' '));
+            if (input === null) {
+                return;
+            }
+            const tags = {};
+            for (const part of input.split(/\s+/).filter(Boolean)) {
+                const i = part.indexOf('=');
+                if (i <= 0) {
+                    showResult('error', '标签格式应为 key=value：' + part);
+                    return;
+                }
+                tags[part.substring(0, i)] = part.substring(i + 1);
+            }
+            const description = prompt('描述（可留空）：', file.description || '');
+            if (description === null) {
+                return;
+            }
+            try {
+                await fileOp('/api/metadata/update', {path: path, tags: tags, replace_tags: true, description: description});
+                showResult('success', '已更新 ' + path + ' 的标签');
+            } catch (error) {
+                showResult('error', '更新标签失败：' + error.message);
+            }
+            loadFiles();
+        }
+        
+        async function createFolder() {
+            const path = prompt('新目录路径（相对上传目录，可包含多级）：', '');
+            if (path === null || path.trim() === '') {
+                return;
+            }
+            try {
+                await fileOp('/api/mkdir', {path: path.trim().replace(/^\/+|\/+$/g, ''), parents: true});
+                showResult('success', '已创建目录 ' + path.trim());
+            } catch (error) {
+                showResult('error', '创建目录失败：' + error.message);
+            }
+            loadFiles();
+        }
+        
+        // 回收站：列出已删除和被覆盖的文件，可以恢复或永久删除（永久删除需要管理员）
+        async function loadTrash() {
+            try {
+                const response = await fetch('/api/trash', { headers: ajaxHeaders });
+                if (!response.ok) {
+                    throw new Error((await response.text()).trim() || response.statusText);
+                }
+                displayTrash(await response.json());
+            } catch (error) {
+                trashItems.textContent = '无法加载回收站：' + error.message;
+            }
+        }
+        
+        function refreshTrash() {
+            if (trashList.style.display === 'block') {
+                loadTrash();
+            }
+        }
+        
+        function displayTrash(entries) {
+            if (!entries || entries.length === 0) {
+                trashItems.textContent = '回收站为空';
+                return;
+            }
             let html = '';
-            for (let i = 0; i < files.length; i++) {
-                const file = files[i];
-                const depth = (file.path.match(/\//g) || []).length;
-                const indent = '&nbsp;'.repeat(depth * 4);
-                const icon = file.is_dir ? '📁' : '📄';
-                
-                html += '<div class="file-item" style="padding-left: ' + (depth * 20) + 'px;">';
-                
-                if (file.is_dir) {
-                    html += '<span class="file-name">' + indent + icon + ' ' + file.name + '/</span>';
-                    html += '<span class="file-size">目录</span>';
+            for (const entry of entries) {
+                const reason = entry.reason === 'overwrite' ? '被覆盖' : '已删除';
+                html += '<div class="file-item" data-id="' + escapeHtml(entry.id) + '" data-path="' + escapeHtml(entry.path) + '">';
+                html += '<span class="file-main"><span class="file-name">' + (entry.is_dir ? '📁 ' : '📄 ') + escapeHtml(entry.path) + (entry.is_dir ? '/' : '') + '</span>';
+                html += '<span class="trash-info">' + reason + ' · ' + new Date(entry.deleted_at).toLocaleString() + ' · ' + escapeHtml(entry.deleted_by) + '</span></span>';
+                html += '<span class="file-meta"><span class="file-actions">';
+                html += '<button class="file-btn" data-action="restore">恢复</button>';
+                html += '<button class="file-btn danger" data-action="purge">永久删除</button>';
+                html += '</span><span class="file-size">' + formatFileSize(entry.size) + '</span></span></div>';
+            }
+            trashItems.innerHTML = html;
+        }
+        
+        async function restoreTrash(id, path) {
+            if (!confirm('将 "' + path + '" 恢复到原位置吗？')) {
+                return;
+            }
+            try {
+                await fileOp('/api/trash/restore', {id: id});
+                showResult('success', '已恢复 ' + path);
+            } catch (error) {
+                showResult('error', '恢复失败：' + error.message);
+            }
+            loadTrash();
+            loadFiles();
+        }
+        
+        async function purgeTrash(body, message) {
+            if (!confirm(message + '\n此操作无法撤销。')) {
+                return;
+            }
+            try {
+                const result = await fileOp('/api/trash/purge', body);
+                if (result.failed && result.failed.length > 0) {
+                    const failures = result.failed.map(f => f.id + '（' + f.error + '）').join('、');
+                    showResult('error', '已永久删除 ' + result.purged.length + ' 项，以下条目删除失败：' + failures);
                 } else {
-                    html += '<a href="/download/' + encodeURIComponent(file.path) + '" class="file-name" target="_blank">';
-                    html += indent + icon + ' ' + file.name;
-                    html += '</a>';
-                    html += '<span class="file-size">' + formatFileSize(file.size) + '</span>';
+                    showResult('success', '已永久删除');
                 }
-                
-                html += '</div>';
+            } catch (error) {
+                showResult('error', '永久删除失败：' + error.message);
             }
-            filesContainer.innerHTML = html;
+            loadTrash();
         }
         
+        trashBtn.addEventListener('click', () => {
+            const visible = trashList.style.display === 'block';
+            trashList.style.display = visible ? 'none' : 'block';
+            if (!visible) {
+                trashItems.textContent = '加载中...';
+                loadTrash();
+            }
+        });
+        
+        emptyTrashBtn.addEventListener('click', () => purgeTrash({all: true}, '确定清空回收站吗？'));
+        
+        trashItems.addEventListener('click', (e) => {
+            const button = e.target.closest('button[data-action]');
+            if (!button) {
+                return;
+            }
+            const item = button.closest('.file-item');
+            if (button.dataset.action === 'restore') {
+                restoreTrash(item.dataset.id, item.dataset.path);
+            } else {
+                purgeTrash({ids: [item.dataset.id]}, '确定永久删除 "' + item.dataset.path + '" 吗？');
+            }
+        });
+        
+        searchInput.addEventListener('input', () => {
+            clearTimeout(searchTimer);
+            searchTimer = setTimeout(runSearch, 300);
+        });
+        
+        newFolderBtn.addEventListener('click', createFolder);
+        bulkDeleteBtn.addEventListener('click', () => deletePaths(Array.from(selectedPaths)));
+        bulkMoveBtn.addEventListener('click', () => promptMove(Array.from(selectedPaths)));
+        
+        // 列表中的按钮和复选框（事件委托，列表刷新后无需重新绑定）
+        filesContainer.addEventListener('click', (e) => {
+            const toggle = e.target.closest('.dir-toggle');
+            if (toggle) {
+                if (searchResults) {
+                    revealDir(toggle.closest('.file-item').dataset.path);
+                } else {
+                    toggleDir(toggle.closest('.file-item').dataset.path);
+                }
+                return;
+            }
+            const tag = e.target.closest('.file-tag');
+            if (tag) {
+                searchInput.value = 'tag:' + tag.dataset.tag;
+                runSearch();
+                return;
+            }
+            const button = e.target.closest('button[data-action]');
+            if (!button) {
+                return;
+            }
+            if (button.dataset.action === 'more') {
+                loadMore(button.closest('.file-item').dataset.more);
+                return;
+            }
+            const path = button.closest('.file-item').dataset.path;
+            switch (button.dataset.action) {
+                case 'delete':
+                    deletePaths([path]);
+                    break;
+                case 'rename':
+                    renamePath(path);
+                    break;
+                case 'move':
+                    promptMove([path]);
+                    break;
+                case 'tags':
+                    editTags(path);
+                    break;
+            }
+        });
+        
+        filesContainer.addEventListener('change', (e) => {
+            if (!e.target.classList.contains('file-select')) {
+                return;
+            }
+            const path = e.target.closest('.file-item').dataset.path;
+            if (e.target.checked) {
+                selectedPaths.add(path);
+            } else {
+                selectedPaths.delete(path);
+            }
+            updateSelection();
+        });
+        
+        // 拖动文件或目录到另一个目录上即可移动；拖动已勾选的项时移动全部勾选项
+        const dragType = 'application/x-ctrans-path';
+        
+        filesContainer.addEventListener('dragstart', (e) => {
+            const item = e.target.closest('.file-item[draggable]');
+            if (!item) {
+                return;
+            }
+            const path = item.dataset.path;
+            const paths = selectedPaths.has(path) ? Array.from(selectedPaths) : [path];
+            e.dataTransfer.setData(dragType, JSON.stringify(paths));
+            e.dataTransfer.effectAllowed = 'move';
+        });
+        
+        filesContainer.addEventListener('dragover', (e) => {
+            const target = e.target.closest('.file-item[data-dir]');
+            if (!target || !e.dataTransfer.types.includes(dragType)) {
+                return;
+            }
+            e.preventDefault();
+            e.dataTransfer.dropEffect = 'move';
+            target.classList.add('drop-target');
+        });
+        
+        filesContainer.addEventListener('dragleave', (e) => {
+            const target = e.target.closest('.file-item[data-dir]');
+            if (target && !target.contains(e.relatedTarget)) {
+                target.classList.remove('drop-target');
+            }
+        });
+        
+        filesContainer.addEventListener('drop', (e) => {
+            const target = e.target.closest('.file-item[data-dir]');
+            if (!target || !e.dataTransfer.types.includes(dragType)) {
+                return;
+            }
+            e.preventDefault();
+            target.classList.remove('drop-target');
+            movePaths(JSON.parse(e.dataTransfer.getData(dragType)), target.dataset.path);
+        });
+        
         // 格式化文件大小
         function formatFileSize(bytes) {
             if (bytes === 0) return '0 B';
@@ -766,7 +1526,17 @@ func handleWebUpload(w http.ResponseWriter, r *http.Request) {
     </script>
 </body>
 </html>`,
-		needsAuth)
+		needsAuth, usersEnabled(), ssoButtonText)
+}
+
+// formModified 网页上传时浏览器提供的文件修改时间（毫秒时间戳），没有时返回 nil
+func formModified(r *http.Request) *time.Time {
+	ms, err := strconv.ParseInt(r.FormValue("lastModified"), 10, 64)
+	if err != nil || ms <= 0 {
+		return nil
+	}
+	t := time.UnixMilli(ms).UTC()
+	return &t
 }
 
 // handleWebUploadFile 处理网页文件上传
@@ -776,6 +1546,17 @@ func handleWebUploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 令牌上传限制请求体大小（额外留出 multipart 头部的余量）
+	id := identityFrom(r)
+	if id.Token != nil {
+		tokenMutex.Lock()
+		remaining := id.Token.remaining()
+		tokenMutex.Unlock()
+		if remaining >= 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, remaining+1<<20)
+		}
+	}
+
 	// 解析multipart form
 	err := r.ParseMultipartForm(32 << 20) // 32MB max memory
 	if err != nil {
@@ -790,48 +1571,93 @@ func handleWebUploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
+	completed := false
+	defer func() {
+		if completed {
+			uploadsCompleted.WithLabelValues("web").Inc()
+		} else {
+			uploadsFailed.WithLabelValues("web").Inc()
+		}
+	}()
+
+	// 令牌上传在写入前计入额度，上传失败时退回
+	if id.Token != nil {
+		if err := reserveTokenBytes(id.Token, header.Size); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		defer func() {
+			if !completed {
+				releaseTokenBytes(id.Token, header.Size)
+			}
+		}()
+	}
+
 	// 检查磁盘空间
 	if err := checkDiskSpace(header.Size); err != nil {
 		http.Error(w, fmt.Sprintf("Insufficient disk space: %v", err), http.StatusInsufficientStorage)
 		return
 	}
 
-	// 获取相对路径（如果有的话）
+	// 获取相对路径（如果有的话），有相对路径时保持目录结构
 	relativePath := r.FormValue("relativePath")
-	var finalPath string
+	name := relativePath
+	if name == "" {
+		name = header.Filename
+	}
 
-	if relativePath != "" {
-		// 有相对路径，保持目录结构
-		finalPath = filepath.Join(uploadDir, relativePath)
+	setRequestFile(r, name, header.Size)
+	tags, err := parseTagArgs(r.MultipartForm.Value["tag"])
+	if err == nil {
+		err = validateTags(tags, r.FormValue("description"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	finalPath, err := resolveUploadPath(id, name)
+	if err != nil {
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+	setRequestFile(r, uploadRelPath(finalPath), header.Size)
 
-		// 创建必要的目录
-		dir := filepath.Dir(finalPath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			http.Error(w, "Failed to create directory", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// 没有相对路径，直接放在上传目录
-		finalPath = filepath.Join(uploadDir, header.Filename)
+	// 创建必要的目录
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
+		return
 	}
 
-	// 创建目标文件
-	finalFile, err := os.Create(finalPath)
+	// 先写入临时文件
+	pending, err := createPending(finalPath)
 	if err != nil {
 		http.Error(w, "Failed to create file", http.StatusInternalServerError)
 		return
 	}
-	defer finalFile.Close()
+	defer pending.discard()
 
 	// 复制文件并计算校验和
 	hash := sha256.New()
-	_, err = io.Copy(io.MultiWriter(finalFile, hash), file)
+	written, err := io.Copy(io.MultiWriter(pending, hash), file)
+	bytesReceived.Add(float64(written))
 	if err != nil {
 		http.Error(w, "Failed to save file", http.StatusInternalServerError)
 		return
 	}
 
+	// 保留旧文件（历史版本或回收站）后替换
+	if err := pending.commit(r); err != nil {
+		logFrom(r).Error("Failed to store uploaded file", "error", err)
+		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
+
 	checksum := hex.EncodeToString(hash.Sum(nil))
+	if entry := auditFrom(r); entry != nil {
+		entry.Checksum = checksum
+	}
+	recordUpload(r, finalPath, checksum, formModified(r), tags, strings.TrimSpace(r.FormValue("description")))
+	completed = true
 
 	// 返回成功响应
 	response := map[string]interface{}{
@@ -845,3 +1671,149 @@ func handleWebUploadFile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// handleDropPage 上传令牌专用页面：只允许上传，不展示服务器文件
+func handleDropPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if rejectLockedOut(w, r) {
+		return
+	}
+
+	token, err := lookupToken(strings.TrimPrefix(r.URL.Path, "/drop/"))
+	if err != nil {
+		recordAuthFailure(clientIP(r))
+		http.Error(w, "Upload link is invalid or has expired", http.StatusNotFound)
+		return
+	}
+
+	limit := "不限"
+	if token.MaxBytes > 0 {
+		limit = fmt.Sprintf("%.1f MB", float64(token.MaxBytes)/(1024*1024))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>ctrans - 文件投递</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            color: #333;
+        }
+        .container {
+            background: white;
+            padding: 2rem;
+            border-radius: 10px;
+            box-shadow: 0 20px 40px rgba(0,0,0,0.1);
+            max-width: 500px;
+            width: 90%%;
+            text-align: center;
+        }
+        h1 { font-size: 1.6rem; margin-bottom: 0.5rem; }
+        .hint { color: #666; font-size: 0.9rem; margin-bottom: 1.5rem; }
+        .upload-area {
+            border: 2px dashed #ddd;
+            border-radius: 8px;
+            padding: 3rem 2rem;
+            cursor: pointer;
+            color: #666;
+        }
+        .upload-area.dragover { border-color: #667eea; background-color: #f8f9ff; }
+        .progress { margin-top: 1rem; color: #666; font-size: 0.9rem; }
+        .result { margin-top: 1rem; font-size: 0.9rem; }
+        .result.error { color: #dc3545; }
+        .result.success { color: #28a745; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>📤 文件投递</h1>
+        <p class="hint">容量上限：%s ・ 有效期至：%s</p>
+        <div class="upload-area" id="uploadArea">点击选择文件或拖拽文件到此处</div>
+        <input type="file" id="fileInput" multiple style="display:none">
+        <div class="progress" id="progress"></div>
+        <div class="result" id="result"></div>
+    </div>
+    <script>
+        const token = '%s';
+        const uploadArea = document.getElementById('uploadArea');
+        const fileInput = document.getElementById('fileInput');
+        const progress = document.getElementById('progress');
+        const result = document.getElementById('result');
+
+        uploadArea.addEventListener('click', () => fileInput.click());
+        uploadArea.addEventListener('dragover', (e) => {
+            e.preventDefault();
+            uploadArea.classList.add('dragover');
+        });
+        uploadArea.addEventListener('dragleave', () => uploadArea.classList.remove('dragover'));
+        uploadArea.addEventListener('drop', (e) => {
+            e.preventDefault();
+            uploadArea.classList.remove('dragover');
+            uploadFiles(Array.from(e.dataTransfer.files));
+        });
+        fileInput.addEventListener('change', (e) => uploadFiles(Array.from(e.target.files)));
+
+        async function uploadFiles(files) {
+            result.textContent = '';
+            result.className = 'result';
+            try {
+                for (let i = 0; i < files.length; i++) {
+                    await uploadFile(files[i], i + 1, files.length);
+                }
+                result.className = 'result success';
+                result.textContent = '上传成功！共上传 ' + files.length + ' 个文件。';
+            } catch (error) {
+                result.className = 'result error';
+                result.textContent = '上传失败：' + error.message;
+            } finally {
+                progress.textContent = '';
+                fileInput.value = '';
+            }
+        }
+
+        function uploadFile(file, index, total) {
+            return new Promise((resolve, reject) => {
+                const formData = new FormData();
+                formData.append('file', file);
+                formData.append('lastModified', file.lastModified);
+
+                const xhr = new XMLHttpRequest();
+                xhr.upload.addEventListener('progress', (e) => {
+                    if (e.lengthComputable) {
+                        progress.textContent = index + '/' + total + ' ' + file.name + ' (' + (e.loaded / e.total * 100).toFixed(1) + '%%)';
+                    }
+                });
+                xhr.addEventListener('load', () => {
+                    if (xhr.status === 200) {
+                        resolve();
+                    } else {
+                        reject(new Error(xhr.responseText || '上传失败'));
+                    }
+                });
+                xhr.addEventListener('error', () => reject(new Error('网络错误')));
+                xhr.open('POST', '/web-upload');
+                xhr.setRequestHeader('X-Upload-Token', token);
+                xhr.send(formData);
+            });
+        }
+    </script>
+</body>
+</html>`,
+		limit, token.ExpiresAt.Format("2006-01-02 15:04"), token.Token)
+}